@@ -26,6 +26,15 @@ var (
 	sProgressFile     string // Progress Status File
 	sStopFlagFile     string // Stop Flag File Path
 	sDownloadURI      string // URI 4 Download
+	bUseTLS           bool   // Connect 2 Server With https
+	sTLSCA            string // CA File (PEM) 4 Verifying Server
+	sTLSPin           string // Pinned SHA256 Fingerprint Of Server Certificate
+	sTLSCert          string // Client Certificate File (PEM) 4 Mutual TLS
+	sTLSKey           string // Client Private Key File (PEM) 4 Mutual TLS
+	sManifestPubKey   string // Ed25519 Public Key (hex string or file) 4 Verifying Resource List
+	bStrictManifest   bool   // Refuse Unsigned Or Mis-signed Resource List
+	bDeepVerify       bool   // Rehash All Cache Files (Ignore Hash Index)
+	sHolidayFolder    string // Folder Of Holiday Calendars (<mkid>.txt 4 each market)
 )
 
 // Package Initialization
@@ -40,7 +49,16 @@ func init() {
 	flag.StringVar(&sUncompressFolder, "dir", "./FileData/", "data folder path (default :./FileData/)")
 	flag.StringVar(&sProgressFile, "progress", "./Progress.xml", "progress file path (default :./Progress.xml)")
 	flag.StringVar(&sStopFlagFile, "stopflagfile", "", "stopflag file path (default : NULL)")
-	flag.StringVar(&sDownloadURI, "uri", "", "resource's URI 4 download (default : ''; example : SSE/MIN1_TODAY/MIN1_TODAY, SZSE/MIN1_TODAY/MIN1_TODAY)")
+	flag.StringVar(&sDownloadURI, "uri", "", "alias URI of live resource 4 download, see /live of server (default : ''; example : SSE/MIN1_TODAY/MIN1_TODAY, SZSE/MIN5_TODAY/MIN5_TODAY)")
+	flag.BoolVar(&bUseTLS, "tls", false, "connect 2 server with https (default:false, implied by -tls-ca/-tls-pin/-tls-cert)")
+	flag.StringVar(&sTLSCA, "tls-ca", "", "CA file (PEM) 4 verifying server certificate (default : system CAs)")
+	flag.StringVar(&sTLSPin, "tls-pin", "", "sha256 fingerprint of pinned server certificate (default : '')")
+	flag.StringVar(&sTLSCert, "tls-cert", "", "client certificate file (PEM) 4 mutual tls (default : '')")
+	flag.StringVar(&sTLSKey, "tls-key", "", "client private key file (PEM) 4 mutual tls (default : '')")
+	flag.StringVar(&sManifestPubKey, "manifest-pubkey", "", "ed25519 public key (hex string or file) 4 verifying resource list (default : '', no verification)")
+	flag.BoolVar(&bStrictManifest, "manifest-strict", false, "refuse unsigned or mis-signed resource list (default:false)")
+	flag.BoolVar(&bDeepVerify, "deep-verify", false, "rehash all cache files instead of trusting the hash index (default:false)")
+	flag.StringVar(&sHolidayFolder, "holidays", "./cfg/holidays/", "folder of holiday calendars, one <mkid>.txt 4 each market (default:./cfg/holidays/)")
 
 	// [Mandatory]
 	flag.StringVar(&sAccount, "account", "", "login user name (default: '') ")
@@ -66,15 +84,24 @@ func main() {
 
 	for i := 0; i < 6; i++ {
 		objSyncClient := &fclient.FileSyncClient{
-			DownloadURI:    sDownloadURI,
-			StopFlagFile:   sStopFlagFile,
-			ServerHost:     fmt.Sprintf("%s:%d", sIP, nPort),
-			Account:        sAccount,
-			Password:       sPassword,
-			TTL:            nTTL,
-			ProgressFile:   sProgressFile,
-			TotalTaskCount: 1,
-			CompleteCount:  0,
+			DownloadURI:       sDownloadURI,
+			StopFlagFile:      sStopFlagFile,
+			ServerHost:        fmt.Sprintf("%s:%d", sIP, nPort),
+			Account:           sAccount,
+			Password:          sPassword,
+			TTL:               nTTL,
+			ProgressFile:      sProgressFile,
+			TotalTaskCount:    1,
+			CompleteCount:     0,
+			UseTLS:            bUseTLS || "" != sTLSCA || "" != sTLSPin || "" != sTLSCert,
+			TLSCAFile:         sTLSCA,
+			TLSPinnedSHA256:   sTLSPin,
+			TLSCertFile:       sTLSCert,
+			TLSKeyFile:        sTLSKey,
+			ManifestPublicKey: sManifestPubKey,
+			StrictManifest:    bStrictManifest,
+			DeepVerify:        bDeepVerify,
+			HolidayFolder:     sHolidayFolder,
 		}
 
 		if false == objSyncClient.Initialize() {
@@ -58,11 +58,26 @@ type I_BufferFile interface {
 const (
 	sMin1Title   string = "date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
 	sMin5Title   string = "date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
+	sMin15Title  string = "date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
+	sMin30Title  string = "date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
 	sMin60Title  string = "date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
+	sMin120Title string = "date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
 	sDay1Title   string = "date,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
+	sWeek1Title  string = "date,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
+	sMonth1Title string = "date,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip\n"
 	sStaticTitle string = "code,name,lotsize,contractmult,contractunit,startdate,enddate,xqdate,deliverydate,expiredate,underlyingcode,underlyingname,optiontype,callorput,exercisepx\n"
 )
 
+var (
+	lstFolderTitles = []struct {
+		Folder string // 数据文件所在的子目录
+		Title  string // 新建数据文件时写入的title
+	}{
+		{"/MIN/", sMin1Title}, {"/MIN1_TODAY/", sMin1Title}, {"/MIN5/", sMin5Title}, {"/MIN15/", sMin15Title}, {"/MIN30/", sMin30Title},
+		{"/MIN60/", sMin60Title}, {"/MIN120/", sMin120Title}, {"/DAY/", sDay1Title}, {"/WEEK/", sWeek1Title}, {"/MONTH/", sMonth1Title}, {"/STATIC/", sStaticTitle},
+	} // 各类数据文件的title (按子目录判断数据类型)
+)
+
 /**
  * @class			BufferFile
  * @brief			缓存文件类
@@ -96,20 +111,11 @@ func (pSelf *BufferFile) Open(sFilePath string, nFileOpenMode int) bool {
 		objStatus, _ := pSelf.FilePtr.Stat()
 		if objStatus.Size() < 10 {
 			sFilePath = strings.Replace(sFilePath, "\\", "/", -1)
-			if strings.LastIndex(sFilePath, "/MIN/") > 0 || strings.LastIndex(sFilePath, "/MIN1_TODAY/") > 0 {
-				pSelf.FilePtr.WriteString(sMin1Title)
-			}
-			if strings.LastIndex(sFilePath, "/MIN5/") > 0 {
-				pSelf.FilePtr.WriteString(sMin5Title)
-			}
-			if strings.LastIndex(sFilePath, "/MIN60/") > 0 {
-				pSelf.FilePtr.WriteString(sMin60Title)
-			}
-			if strings.LastIndex(sFilePath, "/DAY/") > 0 {
-				pSelf.FilePtr.WriteString(sDay1Title)
-			}
-			if strings.LastIndex(sFilePath, "/STATIC/") > 0 {
-				pSelf.FilePtr.WriteString(sStaticTitle)
+			for _, objFolderTitle := range lstFolderTitles {
+				if strings.LastIndex(sFilePath, objFolderTitle.Folder) > 0 {
+					pSelf.FilePtr.WriteString(objFolderTitle.Title)
+					break
+				}
 			}
 		}
 	}
@@ -22,6 +22,7 @@ package fclient
 import (
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -30,7 +31,8 @@ import (
 )
 
 var (
-	GlobalCombinationFileJudgement CombinationFileJudgement // 全局“只下载文件”判定记录器
+	GlobalCombinationFileJudgement CombinationFileJudgement                                                                                   // 全局“只下载文件”判定记录器
+	MergedDataTypes                map[string]bool          = map[string]bool{"d1": true, "w1": true, "mn1": true, "m60": true, "m120": true} // 按 年/月/日 分包压缩(会合并出新资源包)的数据类型，不限市场
 )
 
 //////////////////// 判断某新合并出来的资源文件是否为只需要下载
@@ -52,14 +54,45 @@ type DownloadOnlyFile struct {
  */
 type CombinationFileJudgement struct {
 	objDownloadOnlyFileTable map[string]DownloadOnlyFile // 只需下载，不用解压的资源清单表
+	mapHolidays              map[string]*HolidayCalendar // 各市场的休市日历(市场编号 -> 休市日历)
 }
 
 ///< ---------------------- [Public 方法] -----------------------------
 /**
- * @brief		初始化
+ * @brief		初始化 + 加载各市场的休市日历
+ * @param[in]	sHolidayFolder	休市日历目录(每个市场一个文件: <市场编号>.txt)，目录不存在时只按周末判断交易日
  */
-func (pSelf *CombinationFileJudgement) Initialize() bool {
+func (pSelf *CombinationFileJudgement) Initialize(sHolidayFolder string) bool {
 	pSelf.objDownloadOnlyFileTable = make(map[string]DownloadOnlyFile)
+	pSelf.mapHolidays = make(map[string]*HolidayCalendar)
+	if "" == sHolidayFolder {
+		return true
+	}
+
+	lstFiles, err := ioutil.ReadDir(sHolidayFolder)
+	if nil != err {
+		if false == os.IsNotExist(err) {
+			log.Println("[WARN] CombinationFileJudgement.Initialize() : cannot read holiday folder : ", err.Error())
+		}
+
+		return true
+	}
+
+	for _, objFileInfo := range lstFiles {
+		if true == objFileInfo.IsDir() || ".txt" != strings.ToLower(filepath.Ext(objFileInfo.Name())) {
+			continue
+		}
+
+		objCalendar, err := LoadHolidayCalendar(filepath.Join(sHolidayFolder, objFileInfo.Name()))
+		if nil != err {
+			log.Println("[ERR] CombinationFileJudgement.Initialize() : cannot load holidays : ", err.Error())
+			return false
+		}
+
+		sMkID := strings.ToLower(strings.TrimSuffix(objFileInfo.Name(), filepath.Ext(objFileInfo.Name())))
+		pSelf.mapHolidays[sMkID] = objCalendar
+		log.Printf("[INF] CombinationFileJudgement.Initialize() : holidays of %s loaded, count = %d", sMkID, len(objCalendar.mapHolidays))
+	}
 
 	return true
 }
@@ -93,8 +126,8 @@ func (pSelf *CombinationFileJudgement) JudgeDownloadOnly(resFile *ResDownload, s
 	sMkID := strings.Split(resFile.TYPE, ".")[0]
 	sDataType := strings.Split(resFile.TYPE, ".")[1]
 
-	//////////////// 沪、深市场的日线、60分钟线的比较策略 定义如下: ///////////////////////////
-	if (sMkID == "sse" || sMkID == "szse") && (sDataType == "d1" || sDataType == "m60") {
+	//////////////// 各市场的日线、60分钟线(按 年/月/日 分包压缩的数据类型)的比较策略 定义如下: ///////////////////////////
+	if true == MergedDataTypes[sDataType] {
 		sExpiredDate, _ := ioutil.ReadFile(sLoadFile)                    // 某数据类型的数据的写盘的最后日期string
 		nFileDate, _ := strconv.Atoi(strings.Split(resFile.URI, ".")[1]) // 资源文件代表的数据日期(部分数据文件可能只代表到年，所以后面的月和日都为0,最后几天代表日数据的文件精确到月/日)
 		nExpiredDate, _ := strconv.Atoi(string(sExpiredDate))            // 某数据类型的数据的写盘的最后日期
@@ -103,18 +136,8 @@ func (pSelf *CombinationFileJudgement) JudgeDownloadOnly(resFile *ResDownload, s
 			var objToday time.Time = time.Now()
 
 			if nFileDate%10000 == 0 && (objToday.Year()-1) == nFileDate/10000 {
-				/////////////// 如果文件名是"前一年"的情况： 数据文件日期只代表到年，所以后面的月和日都为0 --> 需要取到该年最后一个工作日的日期后进行比较
-				objDateOfLastYear := time.Date(objToday.Year(), 1, 1, 8, 1, 2, 0, time.Local)
-
-				for {
-					dDiff, _ := time.ParseDuration("-24h")
-					objDateOfLastYear = objDateOfLastYear.Add(dDiff)
-					if objDateOfLastYear.Weekday().String() != "Saturday" && objDateOfLastYear.Weekday().String() != "Sunday" {
-						break
-					} else {
-						continue
-					}
-				}
+				/////////////// 如果文件名是"前一年"的情况： 数据文件日期只代表到年，所以后面的月和日都为0 --> 需要取到该年最后一个交易日的日期后进行比较(跳过周末 + 该市场的休市日)
+				objDateOfLastYear := pSelf.mapHolidays[sMkID].LastTradingDayBefore(time.Date(objToday.Year(), 1, 1, 8, 1, 2, 0, time.Local))
 				// 此时的objDateOfLastYear为前一年的最后一个交易日，并计算出这一年最后一个需要下载的文件名日期(nFileDate)，以此判断是否已经下载全
 				if objDateOfLastYear.Year()*10000 == nFileDate { // 新合并生成的去年的资源包，因为文件名不含月/日，需要补足这块信息后再比较
 					nFileDate = objDateOfLastYear.Year()*10000 + int(objDateOfLastYear.Month())*100 + objDateOfLastYear.Day()
@@ -165,10 +188,9 @@ func (pSelf *CombinationFileJudgement) RecordExpiredDate4DataType(resFile *Downl
 	sLocalFolder = strings.Replace(sLocalFolder, "\\", "/", -1)       // 把'\\'替换成'/',避免下面的path.Dir()出错
 	sLocalFolder = path.Dir(sLocalFolder)                             // 生成缓存的Resources File Root目录
 	sDumpFile := filepath.Join(sLocalFolder, resFile.DataType+".txt") // 生成某类型数据文件的最后日期备案文件的路径
-	sMkID := strings.Split(resFile.DataType, ".")[0]                  // 市场代码
 	sDataType := strings.Split(resFile.DataType, ".")[1]              // 数据类型码
 
-	if (sMkID == "sse" || sMkID == "szse") && (sDataType == "d1" || sDataType == "m60") {
+	if true == MergedDataTypes[sDataType] {
 		sExpiredDate := strings.Split(resFile.URI, ".")[1]             // 某数据类型的数据的写盘的最后日期
 		err := ioutil.WriteFile(sDumpFile, []byte(sExpiredDate), 0644) // 存盘最后一个数据文件的日期
 		if nil != err {
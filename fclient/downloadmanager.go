@@ -8,6 +8,7 @@ package fclient
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -197,12 +198,14 @@ type DownloadTask struct {
  * @param[in]	sDataType 		资源类型
  * @param[in]	sTargetFolder	资源解压根目录
  * @param[in]	lstDownloadTask	这一类资源文件的下载清单表
- * @note 		给每个下载任务标一个时序号，然后解压的时候，就按这个顺序来一个一个的解压(保证该类别内资源文件的解压顺序)
+ * @note 		给每个下载任务标一个时序号，然后解压的时候，就按这个顺序来一个一个的解压(保证该类别内资源文件的解压顺序);
+ 				清单中的墓碑项(已删除的资源)不下载，在该类别全部解压完成后，删除对应的本地缓存文件
  */
 func (pSelf *DownloadTask) DownloadResourcesByCategory(sDataType string, sTargetFolder string, lstDownloadTask []ResDownload) {
 	var sMkID string = strings.Split(sDataType, ".")[0]     // 市场简称
 	var sFileType string = strings.Split(sDataType, ".")[1] // 数据类型
 	var nExtractedFileNum int = 0                           // 在本资源文件类别中，已经解压文件的数量
+	lstDownloadTask, lstObsoleteRes := splitObsoleteRes(lstDownloadTask)
 	///// 跳过已经下载过的任务，若下载过的任务表中间有“脏数据”则清空这个类型的资源后全新下载 /////
 	_, lstSkipDownload, lstValidDownload := pSelf.ClearInvalidHistorayCacheAndData(sTargetFolder, lstDownloadTask)
 	if len(lstSkipDownload) > 0 {
@@ -243,10 +246,46 @@ func (pSelf *DownloadTask) DownloadResourcesByCategory(sDataType string, sTarget
 		}
 	}
 
+	////////////////////////// 该类别全部完成后，清理已经作废的缓存文件 /////////////////////
+	if len(lstObsoleteRes) > 0 && nExtractedFileNum >= len(lstValidDownload) {
+		pSelf.CollectObsoleteCacheFiles(lstObsoleteRes)
+		pSelf.I_Downloader.DumpProgress(len(lstObsoleteRes))
+	}
+
 	runtime.GC()
 	log.Printf("[INF] FileSyncClient.DownloadResourcesByCategory() : [Release Downloader] %s : CompleteCount = %d, TotalCount = %d, (%s.%s)", sDataType, nExtractedFileNum, len(lstSkipDownload)+len(lstValidDownload), sMkID, sFileType)
 }
 
+/**
+ * @brief		删除已经作废的资源(墓碑项)的本地缓存文件(含未下载完的 .part 文件及其ETag)
+ * @detail		只删除墓碑项对应的缓存文件，不清空整个分类的缓存目录和数据目录(已经解压的数据仍然有效，已包含在取代它的资源包中)
+ * @param[in]	lstObsoleteRes		墓碑项列表
+ * @return		删除的缓存文件数量
+ */
+func (pSelf *DownloadTask) CollectObsoleteCacheFiles(lstObsoleteRes []ResDownload) int {
+	var nRemovedCount int = 0
+
+	for _, objRes := range lstObsoleteRes {
+		sLocalFile := filepath.Join(CacheFolder, objRes.URI)
+		if sRelPath, err := filepath.Rel(CacheFolder, sLocalFile); nil != err || strings.HasPrefix(sRelPath, "..") {
+			log.Println("[WARN] DownloadTask.CollectObsoleteCacheFiles() : invalid uri, ignored :", objRes.URI)
+			continue
+		}
+
+		GlobalHashIndex.Remove(objRes.URI)
+		for _, sFile := range []string{sLocalFile, sLocalFile + ".part", sLocalFile + ".part.etag"} {
+			if err := os.Remove(sFile); nil == err {
+				nRemovedCount++
+				log.Printf("[INF] DownloadTask.CollectObsoleteCacheFiles() : obsolete cache file deleted -> %s (superseded by: %s)", sFile, objRes.SupersededBy)
+			} else if false == os.IsNotExist(err) {
+				log.Println("[WARN] DownloadTask.CollectObsoleteCacheFiles() : cannot delete obsolete cache file :", sFile, err.Error())
+			}
+		}
+	}
+
+	return nRemovedCount
+}
+
 ///< ---------------------- [Pivate 方法] -----------------------------
 /**
  * @brief		如果历史缓存和数据中，只允许末尾有连续且未下载的资源文件，如果中间断也出现有不一致的资源文件则被视为“脏数据”，需要删除光该分类下的数据后做全新下载
@@ -264,7 +303,7 @@ func (pSelf *DownloadTask) ClearInvalidHistorayCacheAndData(sTargetFolder string
 	var nFS FileDescType = FD_IsNotExist
 
 	for _, objRes := range lstDownloadTask {
-		var objFCompare FComparison = FComparison{TargetFolder: sTargetFolder, URI: objRes.URI, MD5: objRes.MD5, DateTime: objRes.UPDATE} // 待下载资源与本地缓存文件的差异比较对象
+		var objFCompare FComparison = FComparison{TargetFolder: sTargetFolder, URI: objRes.URI, MD5: objRes.MD5, SHA256: objRes.SHA256, SIZE: objRes.SIZE, DateTime: objRes.UPDATE} // 待下载资源与本地缓存文件的差异比较对象
 		bIsIdentical, nFS = objFCompare.Compare()                                                                                         // 比较资源文件和本地缓存中的是否一致或存在
 		if nFileStatus == FD_IsNotExist {
 			nFileStatus = nFS
@@ -314,6 +353,25 @@ func (pSelf *DownloadTask) ClearInvalidHistorayCacheAndData(sTargetFolder string
 	}
 }
 
+/**
+ * @brief		从下载任务列表中拆分出墓碑项
+ * @return		需要下载的资源列表 + 墓碑项列表
+ */
+func splitObsoleteRes(lstDownloadTask []ResDownload) ([]ResDownload, []ResDownload) {
+	var lstLiveRes []ResDownload
+	var lstObsoleteRes []ResDownload
+
+	for _, objRes := range lstDownloadTask {
+		if true == objRes.Removed {
+			lstObsoleteRes = append(lstObsoleteRes, objRes)
+		} else {
+			lstLiveRes = append(lstLiveRes, objRes)
+		}
+	}
+
+	return lstLiveRes, lstObsoleteRes
+}
+
 /**
  * @brief		把参数的下载任务列表里的任务全部发派出去
  * @param[in]	lstDownloadTask		下载任务列表
@@ -324,7 +382,7 @@ func (pSelf *DownloadTask) DownloadTaskDispatch(lstDownloadTask []ResDownload) {
 		/////////////// 申请下载任务栈的一个占用名额 ///////////////
 		pSelf.ParallelDownloadChannel <- i
 		/////////////// 以同步有序的方式启动下线线程 ///////////////
-		go pSelf.StartDataSafetyDownloader(objRes.TYPE, objRes.URI, objRes.MD5, objRes.UPDATE, i, pSelf.ParallelDownloadChannel, pSelf.ResFileChannel, pSelf.RetryTimes)
+		go pSelf.StartDataSafetyDownloader(objRes.TYPE, objRes.URI, objRes.MD5, objRes.SHA256, objRes.UPDATE, i, pSelf.ParallelDownloadChannel, pSelf.ResFileChannel, pSelf.RetryTimes)
 	}
 }
 
@@ -364,15 +422,17 @@ func (pSelf *DownloadTask) ExtractResData(sTargetFolder string, objResInfo Downl
  * @param[in]	sDataType 		资源文件类型
  * @param[in]	sUri			资源URI标识
  * @param[in]	sMD5			资源文件MD5校验码
+ * @param[in]	sSHA256			资源文件SHA256校验码(为空时，用MD5校验)
  * @param[in]	sDateTime		服务端资源文件生成时间
  * @param[in]	nSeqNo			本次下载任务的任务编号
  * @param[in]	objParallelDownloadChannel	下载任务的同步管理
  * @param[in]	nRetryTimes		下载失败重试的最大次数
- * @note		如果多次重试下载后，还是失败，就是中断程序!
+ * @note		FetchResource()已对下载文件做过SHA256/MD5校验，只有校验通过的资源才会被标记为ST_Completed;
+ 				如果多次重试下载后，还是失败，就是中断程序!
  */
-func (pSelf *DownloadTask) StartDataSafetyDownloader(sDataType, sUri, sMD5, sDateTime string, nSeqNo int, objParallelDownloadChannel chan int, objResFileChannel chan DownloadStatus, nRetryTimes int) {
+func (pSelf *DownloadTask) StartDataSafetyDownloader(sDataType, sUri, sMD5, sSHA256, sDateTime string, nSeqNo int, objParallelDownloadChannel chan int, objResFileChannel chan DownloadStatus, nRetryTimes int) {
 	for n := 0; n < nRetryTimes; n++ { // 资源下载、解压（带任务的失败重试尝试循环）
-		if nTaskStatus, sLocalPath := pSelf.I_Downloader.FetchResource(sDataType, sUri, sMD5, sDateTime); nTaskStatus == ST_Completed {
+		if nTaskStatus, sLocalPath := pSelf.I_Downloader.FetchResource(sDataType, sUri, sMD5, sSHA256, sDateTime); nTaskStatus == ST_Completed {
 			pSelf.I_CacheMgr.NewResource(sUri, sLocalPath, nSeqNo)
 
 			for {
@@ -6,7 +6,11 @@
 package fclient
 
 import (
-	"bytes"
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/ed25519"
+	"crypto/tls"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -15,6 +19,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -43,11 +48,16 @@ func init() {
  * @author		barry
  */
 type ResDownload struct {
-	XMLName xml.Name `xml:"download"`
-	TYPE    string   `xml:"type,attr"`   // 数据类型 sse.d1 / szse.m60
-	URI     string   `xml:"uri,attr"`    // 资源URI路径
-	MD5     string   `xml:"md5,attr"`    // 资源文件的MD5
-	UPDATE  string   `xml:"update,attr"` // 资源文件的生成日期
+	XMLName      xml.Name `xml:"download"`
+	TYPE         string   `xml:"type,attr"`                   // 数据类型 sse.d1 / szse.m60
+	URI          string   `xml:"uri,attr"`                    // 资源URI路径
+	MD5          string   `xml:"md5,attr"`                    // 资源文件的MD5
+	SHA256       string   `xml:"sha256,attr,omitempty"`       // 资源文件的SHA256(有时优先使用，旧版本服务器没有)
+	SIZE         int64    `xml:"size,attr,omitempty"`         // 资源文件的长度(字节)
+	UPDATE       string   `xml:"update,attr"`                 // 资源文件的生成日期
+	STATUS       string   `xml:"status,attr,omitempty"`       // 增量清单中的变化类型: added / changed / removed
+	Removed      bool     `xml:"removed,attr,omitempty"`      // 墓碑项: 资源已经删除，本地缓存文件已作废
+	SupersededBy string   `xml:"supersededby,attr,omitempty"` // 墓碑项: 取代该资源的资源URI(如合并后的年资源包)
 }
 
 /**
@@ -57,7 +67,9 @@ type ResDownload struct {
  */
 type ResourceList struct {
 	XMLName  xml.Name      `xml:"resource"`
-	Download []ResDownload `xml:"download"` // 可下载资源清单表
+	Version  uint64        `xml:"version,attr,omitempty"` // 清单版本号
+	Since    uint64        `xml:"since,attr,omitempty"`   // 增量清单的基准版本号(为0时，是全量清单)
+	Download []ResDownload `xml:"download"`               // 可下载资源清单表
 }
 
 ///////////////////////////////////// 资源下载同步类 /////////////////////////////
@@ -80,9 +92,10 @@ type I_Downloader interface {
 	 * @param[in]	sDataType 		资源文件类型
 	 * @param[in]	sUri			资源文件URI标识
 	 * @param[in]	sMD5			资源文件MD5串
+	 * @param[in]	sSHA256			资源文件SHA256串(为空时，用MD5校验)
 	 * @param[in]	sDateTime		资源文件在服务端的生成时间
 	 */
-	FetchResource(sDataType, sUri, sMD5, sDateTime string) (TaskStatusType, string)
+	FetchResource(sDataType, sUri, sMD5, sSHA256, sDateTime string) (TaskStatusType, string)
 
 	/**
 	 * @brief		获取资源下载任务的完成度百分比
@@ -96,19 +109,32 @@ type I_Downloader interface {
  * @author		barry
  */
 type FileSyncClient struct {
-	ServerHost       string                  // Server IP + Port
-	Account          string                  // Server Login Username
-	Password         string                  // Server Login Password
-	TTL              int                     // Time To Live
-	nRetryTimes      int                     // Retry Times
-	objCacheTable    CacheFileTable          // Table Of Download Resources
-	ProgressFile     string                  // Progress File Path
-	objCountLock     *sync.Mutex             // CompleteCount锁
-	TotalTaskCount   int                     // 同步任务文件总数
-	CompleteCount    int                     // 同步任务完成数
-	StopFlagFile     string                  // Stop Flag File Path
-	DownloadURI      string                  // Resource's URI 4 Download
-	objSyncTaskTable map[string]DownloadTask // Map Of Last Sequence No
+	ServerHost        string                  // Server IP + Port
+	Account           string                  // Server Login Username
+	Password          string                  // Server Login Password
+	TTL               int                     // Time To Live
+	nRetryTimes       int                     // Retry Times
+	objCacheTable     CacheFileTable          // Table Of Download Resources
+	ProgressFile      string                  // Progress File Path
+	objCountLock      *sync.Mutex             // CompleteCount锁
+	TotalTaskCount    int                     // 同步任务文件总数
+	CompleteCount     int                     // 同步任务完成数
+	StopFlagFile      string                  // Stop Flag File Path
+	DownloadURI       string                  // Resource's URI 4 Download
+	objSyncTaskTable  map[string]DownloadTask // Map Of Last Sequence No
+	sAccessToken      string                  // Login Token (Authorization: Bearer)
+	UseTLS            bool                    // Connect 2 Server With https
+	TLSCAFile         string                  // CA Certificate File (PEM) 4 Verifying Server
+	TLSPinnedSHA256   string                  // Pinned SHA256 Fingerprint Of Server Certificate
+	TLSCertFile       string                  // Client Certificate File (PEM) 4 Mutual TLS
+	TLSKeyFile        string                  // Client Private Key File (PEM) 4 Mutual TLS
+	objTLSConfig      *tls.Config             // TLS Configuration (nil while using http)
+	objNewManifest    ResourceList            // Full Manifest 2 Be Saved After All Tasks Completed
+	ManifestPublicKey string                  // Ed25519 Public Key (hex string or file) 4 Verifying Resource List
+	StrictManifest    bool                    // Refuse Unsigned Or Mis-signed Resource List
+	objManifestKey    ed25519.PublicKey       // Loaded Public Key (nil means no verification)
+	DeepVerify        bool                    // Rehash All Cache Files (Ignore Hash Index && Local Manifest)
+	HolidayFolder     string                  // Folder Of Holiday Calendars (<mkid>.txt 4 each market)
 }
 
 ///< ---------------------- [Public 方法] -----------------------------
@@ -121,7 +147,35 @@ func (pSelf *FileSyncClient) Initialize() bool {
 	pSelf.objSyncTaskTable = make(map[string]DownloadTask)
 	pSelf.objCacheTable.Initialize()
 
-	if false == GlobalCombinationFileJudgement.Initialize() {
+	if true == pSelf.UseTLS {
+		objTLSConfig, err := buildTLSConfig(pSelf.TLSCAFile, pSelf.TLSPinnedSHA256, pSelf.TLSCertFile, pSelf.TLSKeyFile)
+		if nil != err {
+			log.Println("[ERR] FileSyncClient.Initialize() : cannot build tls configuration : ", err.Error())
+			return false
+		}
+
+		pSelf.objTLSConfig = objTLSConfig
+	}
+
+	if "" != pSelf.ManifestPublicKey {
+		objManifestKey, err := loadManifestPublicKey(pSelf.ManifestPublicKey)
+		if nil != err {
+			log.Println("[ERR] FileSyncClient.Initialize() : cannot load manifest public key : ", err.Error())
+			return false
+		}
+
+		pSelf.objManifestKey = objManifestKey
+	} else if true == pSelf.StrictManifest {
+		log.Println("[ERR] FileSyncClient.Initialize() : strict manifest mode needs a manifest public key")
+		return false
+	}
+
+	if false == GlobalHashIndex.Initialize(pSelf.DeepVerify) {
+		log.Println("[ERR] FileSyncClient.Initialize() : cannot initialize object of GlobalHashIndex ")
+		return false
+	}
+
+	if false == GlobalCombinationFileJudgement.Initialize(pSelf.HolidayFolder) {
 		log.Println("[ERR] FileSyncClient.DoTasks() : cannot initialize object of GlobalCombinationFileJudgement ")
 		return false
 	}
@@ -168,6 +222,15 @@ func (pSelf *FileSyncClient) DoTasks(sTargetFolder string) bool {
 		return false
 	}
 
+	if 0 == len(objResourceList.Download) { ///////////////// 清单没有变化(增量清单为空)，不需要再比对本地缓存文件
+		log.Println("[INF] FileSyncClient.DoTasks() : resources r up to date, manifest version =", pSelf.objNewManifest.Version)
+		saveLocalManifest(&pSelf.objNewManifest)
+		pSelf.TotalTaskCount = 1
+		pSelf.DumpProgress(1)
+		log.Println("[INF] FileSyncClient.DoTasks() : ................ Mission Completed ................... ")
+		return true
+	}
+
 	///////////////////// 启动下载器 & 分配下载任务 ///////////////////////
 	pSelf.TotalTaskCount = len(objResourceList.Download)
 	for i, objRes := range objResourceList.Download {
@@ -225,7 +288,11 @@ func (pSelf *FileSyncClient) DoTasks(sTargetFolder string) bool {
 	}
 
 	objCacheFileTable.FlushBuffer2File()
+	GlobalHashIndex.Save()
 	pSelf.DumpProgress(0)
+	if pSelf.CompleteCount >= pSelf.TotalTaskCount && pSelf.objNewManifest.Version > 0 { // 全部同步完成，记录已经应用的清单版本
+		saveLocalManifest(&pSelf.objNewManifest)
+	}
 	log.Println("[INF] FileSyncClient.DoTasks() : ................ Mission Completed ................... ")
 	return true
 }
@@ -235,13 +302,18 @@ func (pSelf *FileSyncClient) DoTasks(sTargetFolder string) bool {
  * @param[in]	sDataType 		资源文件类型
  * @param[in]	sUri			资源文件URI标识
  * @param[in]	sMD5			资源文件MD5串
+ * @param[in]	sSHA256			资源文件SHA256串(为空时，用MD5校验)
  * @param[in]	sDateTime		资源文件在服务端的生成时间
+ * @note		支持断点续传: 数据先写到缓存目录中的 .part 文件，下载中断后，下一次从 .part 的末尾用 Range 续传;
+ 				下载 .part 时服务端应答的ETag存在 .part.etag 中，续传时作为 If-Range，服务端文件已经变化(如同一URI重新生成)时，会返回整个新文件;
+ 				非200/206应答、服务端xml出错应答、校验不一致(有SHA256时校验SHA256，否则校验MD5)，都返回ST_Error，由调用方重试
  */
-func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sDateTime string) (TaskStatusType, string) {
-	var sUrl string = fmt.Sprintf("http://%s/get?uri=%s", pSelf.ServerHost, sUri) // 资源下载的URL串
-	var sLocalPath string = ""                                                    // 下载资源的本地缓存文件路径
-	var httpRes *http.Response = nil                                              // 下载资源的请求返回对象(Response)
-	var nTaskStatus TaskStatusType = ST_Error                                     // 下载任务成功状态（返回值）
+func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sSHA256, sDateTime string) (TaskStatusType, string) {
+	var sUrl string = pSelf.serverURL("/get?uri=" + sUri) // 资源下载的URL串
+	var sLocalPath string = ""                            // 下载资源的本地缓存文件路径
+	var httpRes *http.Response = nil                      // 下载资源的请求返回对象(Response)
+	var nTaskStatus TaskStatusType = ST_Error             // 下载任务成功状态（返回值）
+	var nPartSize int64 = 0                               // 已经下载到 .part 文件中的数据长度
 
 	defer func() {
 		if pObjPanic := recover(); pObjPanic != nil { // 异常恢复，以至于程序不会异常中断
@@ -252,6 +324,31 @@ func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sDateTime stri
 		}
 	}()
 
+	////////////// 为下载的资源文件准备好目录结构进行存放 ////
+	sLocalFolder, err := filepath.Abs((filepath.Dir("./")))
+	if err != nil {
+		log.Println("[WARN] FileSyncClient.FetchResource() : failed 2 fetch absolute path of program", sUrl, sMD5, sDateTime)
+		return ST_Error, ""
+	}
+
+	sLocalFolder = filepath.Join(sLocalFolder, CacheFolder)
+	sLocalFile := filepath.Join(sLocalFolder, sUri)
+	sPartFile := sLocalFile + ".part"
+	sETagFile := sPartFile + ".etag" // .part 文件下载时的ETag
+	sMkFolder := path.Dir(sLocalFile)
+	if "windows" == runtime.GOOS {
+		sMkFolder = sLocalFile[:strings.LastIndex(sLocalFile, "\\")]
+	}
+	err = os.MkdirAll(sMkFolder, 0711)
+	if err != nil {
+		log.Printf("[WARN] FileSyncClient.FetchResource() : failed 2 create folder : %s : %s", sLocalFile, err.Error())
+		return ST_Error, ""
+	}
+
+	if objPartInfo, err := os.Stat(sPartFile); nil == err {
+		nPartSize = objPartInfo.Size()
+	}
+
 	// 和本地缓存文件不同（或缓存文件不存在），需要从服务器下载
 	httpClient := http.Client{
 		CheckRedirect: nil,
@@ -262,7 +359,8 @@ func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sDateTime stri
 				Timeout:   30 * time.Second,
 				KeepAlive: 6 * 60 * time.Second,
 			}).Dial,
-			// TLSHandshakeTimeout:time.Second * 10,
+			TLSClientConfig:     pSelf.objTLSConfig,
+			TLSHandshakeTimeout: time.Second * 30,
 			// IdleConnTimeout:    time.Second * 30 * 1,
 			ResponseHeaderTimeout: time.Second * 30 * 1,
 			ExpectContinueTimeout: time.Second * 30 * 1,
@@ -270,6 +368,12 @@ func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sDateTime stri
 	}
 	/////////////// 请求下载的资源数据 /////////////////////
 	httpReq, err := http.NewRequest("GET", sUrl, nil)
+	if bytesETag, err := ioutil.ReadFile(sETagFile); nPartSize > 0 && nil == err && len(bytesETag) > 0 { // 有未下载完的 .part 文件，从末尾续传(没有ETag的 .part 不知道来自哪个版本，从头下载)
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", nPartSize))
+		httpReq.Header.Set("If-Range", string(bytesETag))
+		log.Printf("[INF] FileSyncClient.FetchResource() : resuming %s from byte %d, etag = %s", sUri, nPartSize, string(bytesETag))
+	}
+	pSelf.setAuthorization(httpReq)
 	httpRes, err = httpClient.Do(httpReq)
 	if err != nil {
 		log.Println("[ERR] FileSyncClient.FetchResource() : error in response : ", err.Error())
@@ -277,39 +381,83 @@ func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sDateTime stri
 	}
 
 	defer httpRes.Body.Close()
-	////////////// 为下载的资源文件准备好目录结构进行存放 ////
-	sLocalFolder, err := filepath.Abs((filepath.Dir("./")))
-	if err != nil {
-		log.Println("[WARN] FileSyncClient.FetchResource() : failed 2 fetch absolute path of program", sUrl, sMD5, sDateTime)
+	////////////// 根据应答决定是续写 .part，还是从头写 ////////
+	nFileOpenMode := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if http.StatusPartialContent == httpRes.StatusCode {
+		nFileOpenMode = os.O_RDWR | os.O_CREATE | os.O_APPEND
+	} else if http.StatusRequestedRangeNotSatisfiable == httpRes.StatusCode {
+		log.Println("[WARN] FileSyncClient.FetchResource() : range not satisfiable, discard .part file : ", sPartFile)
+		os.Remove(sPartFile)
+		os.Remove(sETagFile)
 		return ST_Error, ""
-	}
-
-	sLocalFolder = filepath.Join(sLocalFolder, CacheFolder)
-	sLocalFile := filepath.Join(sLocalFolder, sUri)
-	sMkFolder := path.Dir(sLocalFile)
-	if "windows" == runtime.GOOS {
-		sMkFolder = sLocalFile[:strings.LastIndex(sLocalFile, "\\")]
-	}
-	err = os.MkdirAll(sMkFolder, 0711)
-	if err != nil {
-		log.Printf("[WARN] FileSyncClient.FetchResource() : failed 2 create folder : %s : %s", sLocalFile, err.Error())
+	} else if http.StatusOK != httpRes.StatusCode {
+		log.Printf("[WARN] FileSyncClient.FetchResource() : unexpected http status (%s) : %s", httpRes.Status, sUri)
 		return ST_Error, ""
 	}
-	////////////// 从网卡读出资源文件数据，并存盘 ////////////
-	objDataBuf := &bytes.Buffer{}
-	_, err2 := objDataBuf.ReadFrom(httpRes.Body)
-	if err2 != nil {
-		log.Println("[ERR] FileSyncClient.FetchResource() :  cannot read response : ", sUrl, sMD5, sDateTime, err.Error())
+	////////////// 服务端的失败应答是xml串(<download><result status="failure">)，不能当作资源文件存盘 ////////
+	objBodyReader := bufio.NewReader(httpRes.Body)
+	if bytesHead, _ := objBodyReader.Peek(len("<?xml")); strings.Contains(httpRes.Header.Get("Content-Type"), "xml") || "<?xml" == string(bytesHead) {
+		bytesErrMsg, _ := ioutil.ReadAll(io.LimitReader(objBodyReader, 1024))
+		log.Println("[WARN] FileSyncClient.FetchResource() : server responded with an error : ", sUri, string(bytesErrMsg))
 		return ST_Error, ""
 	}
 
-	objFile, _ := os.Create(sLocalFile)
+	objFile, err := os.OpenFile(sPartFile, nFileOpenMode, 0644)
+	if err != nil {
+		log.Println("[ERR] FileSyncClient.FetchResource() :  cannot open .part file : ", sPartFile, err.Error())
+		return ST_Error, ""
+	}
 	defer objFile.Close()
-	_, err = io.Copy(objFile, objDataBuf)
+	////////////// 从头下载时，记下本次应答的ETag(下次续传时作为 If-Range; 没有ETag时不续传) ////////////
+	if http.StatusOK == httpRes.StatusCode {
+		if sETag := httpRes.Header.Get("ETag"); "" != sETag {
+			ioutil.WriteFile(sETagFile, []byte(sETag), 0644)
+		} else {
+			os.Remove(sETagFile)
+		}
+	}
+	////////////// 续传时，先把 .part 中已有的数据计入MD5/SHA256（读完后文件位置恰好在末尾） ////////////
+	objMD5Hash := md5.New()
+	objSHA256Hash := sha256.New()
+	objHashWriter := io.MultiWriter(objMD5Hash, objSHA256Hash)
+	if http.StatusPartialContent == httpRes.StatusCode {
+		if _, err = io.Copy(objHashWriter, objFile); err != nil {
+			log.Println("[ERR] FileSyncClient.FetchResource() :  cannot read .part file : ", sPartFile, err.Error())
+			return ST_Error, ""
+		}
+	}
+	////////////// 从网卡边读边存盘，同时计算MD5/SHA256(中断时，已收到的数据留在 .part 中，供下次续传) ////////////
+	_, err = io.Copy(objFile, io.TeeReader(objBodyReader, objHashWriter))
 	if err != nil {
 		log.Println("[ERR] FileSyncClient.FetchResource() :  cannot save 2 file : ", sUri, sMD5, sDateTime, err.Error())
 		return ST_Error, ""
 	}
+	////////////// 校验下载文件的SHA256(清单中有时优先)或MD5(旧版本服务器的实时资源MD5为"none"，不做校验)，不一致时删除 .part 文件后重新下载 ////////////
+	sDownloadSHA256 := fmt.Sprintf("%x", objSHA256Hash.Sum(nil))
+	sDownloadMD5 := fmt.Sprintf("%x", objMD5Hash.Sum(nil))
+	if "" != sSHA256 && strings.ToLower(sSHA256) != sDownloadSHA256 {
+		log.Printf("[WARN] FileSyncClient.FetchResource() : sha256 mismatch, %s : server(sha256:%s) != local(sha256:%s)", sUri, strings.ToLower(sSHA256), sDownloadSHA256)
+		objFile.Close()
+		os.Remove(sPartFile)
+		os.Remove(sETagFile)
+		return ST_Error, ""
+	} else if "" == sSHA256 && "" != sMD5 && "none" != sMD5 && strings.ToLower(sMD5) != sDownloadMD5 {
+		log.Printf("[WARN] FileSyncClient.FetchResource() : md5 mismatch, %s : server(md5:%s) != local(md5:%s)", sUri, strings.ToLower(sMD5), sDownloadMD5)
+		objFile.Close()
+		os.Remove(sPartFile)
+		os.Remove(sETagFile)
+		return ST_Error, ""
+	}
+	//////////// 下载完整后，.part 文件转正为缓存文件
+	objFile.Close()
+	if err = os.Rename(sPartFile, sLocalFile); err != nil {
+		log.Println("[ERR] FileSyncClient.FetchResource() :  cannot rename .part file : ", sPartFile, err.Error())
+		return ST_Error, ""
+	}
+	os.Remove(sETagFile)
+	if objFileInfo, err := os.Stat(sLocalFile); nil == err { // 已经校验过的文件，记入摘要索引(下次同步时不用再计算)
+		GlobalHashIndex.Update(sUri, objFileInfo, sDownloadMD5, sDownloadSHA256)
+	}
 	//////////// 设置下载的资源文件信息，并待返回
 	sLocalPath = sLocalFile    // 本地资源文件存放路径
 	nTaskStatus = ST_Completed // 本次下载成功标识
@@ -317,21 +465,51 @@ func (pSelf *FileSyncClient) FetchResource(sDataType, sUri, sMD5, sDateTime stri
 	return nTaskStatus, sLocalPath
 }
 
+/**
+ * @brief		生成服务器接口的完整url (http:// 或 https://)
+ * @param[in]	sPathAndQuery	接口路径 + 参数，如: /list
+ */
+func (pSelf *FileSyncClient) serverURL(sPathAndQuery string) string {
+	if true == pSelf.UseTLS {
+		return fmt.Sprintf("https://%s%s", pSelf.ServerHost, sPathAndQuery)
+	}
+
+	return fmt.Sprintf("http://%s%s", pSelf.ServerHost, sPathAndQuery)
+}
+
+/**
+ * @brief		给请求加上登录令牌(Authorization: Bearer <token>)
+ */
+func (pSelf *FileSyncClient) setAuthorization(httpReq *http.Request) {
+	if "" != pSelf.sAccessToken {
+		httpReq.Header.Set("Authorization", "Bearer "+pSelf.sAccessToken)
+	}
+}
+
 /**
  * @brief		登录到服务器
+ * @detail		POST帐号密码(不放在url中)，登录成功后保存服务器签发的令牌，用于之后的 /list 和 /get 请求
  */
 func (pSelf *FileSyncClient) login2Server() bool {
 	// generate Login Url string
-	var sUrl string = fmt.Sprintf("http://%s/login?account=%s&password=%s", pSelf.ServerHost, pSelf.Account, pSelf.Password)
-	log.Printf("[INF] FileSyncClient.login2Server() : http://%s/login?account=%s", pSelf.ServerHost, pSelf.Account)
+	var sUrl string = pSelf.serverURL("/login")
+	log.Printf("[INF] FileSyncClient.login2Server() : [POST] %s, account=%s", sUrl, pSelf.Account)
 
 	// declare http request variable
 	httpClient := http.Client{
 		CheckRedirect: nil,
 		Jar:           globalCurrentCookieJar,
 		Timeout:       8 * time.Second,
+		Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: pSelf.objTLSConfig},
 	}
-	httpReq, err := http.NewRequest("GET", sUrl, nil)
+	objForm := url.Values{"account": {pSelf.Account}, "password": {pSelf.Password}}
+	httpReq, err := http.NewRequest("POST", sUrl, strings.NewReader(objForm.Encode()))
+	if err != nil {
+		log.Println("[ERR] FileSyncClient.login2Server() :  cannot build request : ", sUrl, err.Error())
+		return false
+	}
+
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	httpRes, err := httpClient.Do(httpReq)
 
 	if err != nil {
@@ -357,6 +535,7 @@ func (pSelf *FileSyncClient) login2Server() bool {
 			XMLName xml.Name `xml:"result"`
 			Status  string   `xml:"status,attr"`
 			Desc    string   `xml:"desc,attr"`
+			Token   string   `xml:"token,attr"`
 		}
 	} // Build Response Xml Structure
 
@@ -365,7 +544,8 @@ func (pSelf *FileSyncClient) login2Server() bool {
 		log.Println("[ERR] FileSyncClient.login2Server() : ", err.Error())
 		log.Println("[ERR] FileSyncClient.login2Server() : ", string(body))
 	} else {
-		if strings.ToLower(xmlRes.Result.Status) == "success" {
+		if strings.ToLower(xmlRes.Result.Status) == "success" && http.StatusOK == httpRes.StatusCode && "" != xmlRes.Result.Token {
+			pSelf.sAccessToken = xmlRes.Result.Token
 			return true
 		}
 
@@ -377,42 +557,155 @@ func (pSelf *FileSyncClient) login2Server() bool {
 }
 
 /**
- * @brief		获取可下载的资源清单表
- * @param[out]	objResourceList		资源清单表
+ * @brief		验证资源清单的签名
+ * @detail		未配置公钥时，不验证; 签名缺失或不正确时: 严格模式下拒绝该清单，否则只记录警告
+ * @param[in]	sEndpoint		请求的接口路径(/list 或 /live)
+ * @param[in]	nVersion		应答体中清单的版本号
+ * @param[in]	bytesBody		/list 或 /live 的完整应答体
+ * @param[in]	sSignature		应答头 X-Manifest-Signature
+ * @return		true			可以使用该清单
  */
-func (pSelf *FileSyncClient) fetchResList(objResourceList *ResourceList) bool {
-	if pSelf.DownloadURI != "" {
-		// download uri resource only
-		var objDownload ResDownload
+func (pSelf *FileSyncClient) verifyResList(sEndpoint string, nVersion uint64, bytesBody []byte, sSignature string) bool {
+	if nil == pSelf.objManifestKey {
+		return true
+	}
 
-		if strings.Contains(pSelf.DownloadURI, "MIN1_TODAY") == true && strings.Contains(pSelf.DownloadURI, "SSE") {
-			objDownload.TYPE = "sse.real_m1"
-			objDownload.URI = "SyncFolder/SSE/MIN1_TODAY/MIN1_TODAY"
-			objDownload.MD5 = "none"
-			objResourceList.Download = append(objResourceList.Download, objDownload)
-			return true
-		} else if strings.Contains(pSelf.DownloadURI, "MIN1_TODAY") == true && strings.Contains(pSelf.DownloadURI, "SZSE") {
-			objDownload.TYPE = "szse.real_m1"
-			objDownload.URI = "SyncFolder/SZSE/MIN1_TODAY/MIN1_TODAY"
-			objDownload.MD5 = "none"
+	err := verifyManifest(pSelf.objManifestKey, sEndpoint, nVersion, bytesBody, sSignature)
+	if nil == err {
+		log.Println("[INF] FileSyncClient.verifyResList() : [OK] signature of resource list verified")
+		return true
+	}
+
+	if true == pSelf.StrictManifest {
+		log.Println("[SECURITY] FileSyncClient.verifyResList() : resource list refused : ", err.Error())
+		return false
+	}
+
+	log.Println("[WARN] FileSyncClient.verifyResList() : resource list accepted in non-strict mode : ", err.Error())
+	return true
+}
+
+/**
+ * @brief		获取指定的实时资源(DownloadURI，如: SSE/MIN5_TODAY/MIN5_TODAY)
+ * @detail		从 /live 取服务器上的实时资源列表(同资源列表一样验证签名)，按别名URI匹配(可以省略前面的SyncFolder等目录);
+ 				列表中是当前一代文件的URI(<别名>.<date>.<hhmm>)，取列表后服务器又发布了新一代文件，下载到的仍是列表中的那一代
+ * @param[out]	objResourceList		资源清单表(只有该实时资源一项，带当前一代文件的MD5/SHA256，下载后校验)
+ * @note		实时资源的数据类型、时间窗口等都由服务器配置，客户端不再区分沪深1分钟线;
+ 				本地缓存的其它代文件已经过期，一并删除
+ */
+func (pSelf *FileSyncClient) fetchLiveRes(objResourceList *ResourceList) bool {
+	var objLiveList ResourceList
+	var sUrl string = pSelf.serverURL("/live")
+	var sAliasURI string = strings.Trim(strings.Replace(pSelf.DownloadURI, "\\", "/", -1), "/")
+	log.Println("[INF] FileSyncClient.fetchLiveRes() : [GET]", sUrl)
+
+	httpClient := http.Client{
+		CheckRedirect: nil,
+		Jar:           globalCurrentCookieJar,
+		Timeout:       time.Second * 10,
+		Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: pSelf.objTLSConfig},
+	}
+	httpReq, err := http.NewRequest("GET", sUrl, nil)
+	if err != nil {
+		log.Println("[ERR] FileSyncClient.fetchLiveRes() : invalid request : ", sUrl, err.Error())
+		return false
+	}
+
+	pSelf.setAuthorization(httpReq)
+	httpRes, err := httpClient.Do(httpReq)
+	if err != nil {
+		log.Println("[ERR] FileSyncClient.fetchLiveRes() : error in response : ", sUrl, err.Error())
+		return false
+	}
+
+	defer httpRes.Body.Close()
+	body, err := ioutil.ReadAll(httpRes.Body)
+	if err != nil {
+		log.Println("[ERR] FileSyncClient.fetchLiveRes() : cannot read response : ", sUrl, err.Error())
+		return false
+	}
+
+	if http.StatusOK != httpRes.StatusCode {
+		log.Printf("[ERR] FileSyncClient.fetchLiveRes() : unexpected http status (%s) : %s", httpRes.Status, string(body))
+		return false
+	}
+
+	if err := xml.Unmarshal(body, &objLiveList); err != nil {
+		log.Println("[ERR] FileSyncClient.fetchLiveRes() : ", err.Error(), string(body))
+		return false
+	}
+
+	if false == pSelf.verifyResList("/live", objLiveList.Version, body, httpRes.Header.Get(ManifestSignatureHeader)) {
+		return false
+	}
+
+	for _, objDownload := range objLiveList.Download {
+		if sLiveAlias := liveAliasOf(objDownload.URI); sLiveAlias == sAliasURI || true == strings.HasSuffix(sLiveAlias, "/"+sAliasURI) {
+			removeLiveCacheFiles(sLiveAlias, objDownload.URI)
 			objResourceList.Download = append(objResourceList.Download, objDownload)
 			return true
 		}
+	}
 
-		return false
+	log.Println("[ERR] FileSyncClient.fetchLiveRes() : live resource is not available on server : ", pSelf.DownloadURI)
+	return false
+}
+
+/**
+ * @brief		删除本地缓存的实时资源其它代的文件(含未下载完的 .part / .part.etag)
+ * @param[in]	sAliasURI		实时资源的别名URI
+ * @param[in]	sCurrentURI		当前一代文件的URI(保留)
+ */
+func removeLiveCacheFiles(sAliasURI string, sCurrentURI string) {
+	lstFiles, _ := filepath.Glob(filepath.Join(CacheFolder, sAliasURI) + ".*")
+	for _, sFile := range lstFiles {
+		sRelPath, err := filepath.Rel(CacheFolder, strings.TrimSuffix(strings.TrimSuffix(sFile, ".etag"), ".part"))
+		sURI := filepath.ToSlash(sRelPath)
+		if nil != err || filepath.ToSlash(filepath.Clean(sCurrentURI)) == sURI || filepath.ToSlash(filepath.Clean(sAliasURI)) != liveAliasOf(sURI) {
+			continue
+		}
+
+		if err = os.Remove(sFile); nil == err {
+			GlobalHashIndex.Remove(sURI)
+			log.Println("[INF] FileSyncClient.fetchLiveRes() : expired cache file of live resource deleted :", sFile)
+		}
+	}
+}
+
+/**
+ * @brief		获取可下载的资源清单表
+ * @detail		本地有已经应用过的清单版本时，请求 /list?since=<版本号>:
+ 				服务器返回增量清单时，应用到本地清单上，只返回有变化的资源类型下的资源项(清单没有变化时，返回空表);
+ 				服务器返回全量清单时(版本太旧等)，按全量清单同步
+ * @param[out]	objResourceList		资源清单表(待同步的)
+ * @note		清单版本比本地清单旧时(镜像重放旧的签名清单等)，严格模式下拒绝该清单，否则只记录警告
+ */
+func (pSelf *FileSyncClient) fetchResList(objResourceList *ResourceList) bool {
+	if pSelf.DownloadURI != "" {
+		// download uri resource only (live resource)
+		return pSelf.fetchLiveRes(objResourceList)
 	}
 
 	// generate list Url string
-	var sUrl string = fmt.Sprintf("http://%s/list", pSelf.ServerHost)
-	log.Println("[INF] FileSyncClient.fetchResList() : [GET] /list")
+	var objLocalManifest ResourceList
+	var objRemoteList ResourceList
+	var bHasLocalManifest bool = loadLocalManifest(&objLocalManifest)
+	var bUseDelta bool = false == pSelf.DeepVerify && bHasLocalManifest // 深度校验时，取全量清单逐个比对
+	var sUrl string = pSelf.serverURL("/list")
+	if true == bUseDelta {
+		sUrl = pSelf.serverURL(fmt.Sprintf("/list?since=%d", objLocalManifest.Version))
+	}
+	log.Println("[INF] FileSyncClient.fetchResList() : [GET]", sUrl)
 
 	// declare http request variable
 	httpClient := http.Client{
 		CheckRedirect: nil,
 		Jar:           globalCurrentCookieJar,
 		Timeout:       time.Second * 10,
+		Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: pSelf.objTLSConfig},
 	}
 	httpReq, err := http.NewRequest("GET", sUrl, nil)
+	pSelf.setAuthorization(httpReq)
 	httpRes, err := httpClient.Do(httpReq)
 
 	if err != nil {
@@ -428,20 +721,50 @@ func (pSelf *FileSyncClient) fetchResList(objResourceList *ResourceList) bool {
 		return false
 	}
 
+	if http.StatusOK != httpRes.StatusCode {
+		log.Printf("[ERR] FileSyncClient.fetchResList() : unexpected http status (%s) : %s", httpRes.Status, string(body))
+		return false
+	}
+
 	// unmarshal obj. from xml string
-	if err := xml.Unmarshal(body, &objResourceList); err != nil {
+	if err := xml.Unmarshal(body, &objRemoteList); err != nil {
 		log.Println("[ERR] FileSyncClient.fetchResList() : ", err.Error())
 		log.Println("[ERR] FileSyncClient.fetchResList() : ", string(body))
 
 		return false
-	} else {
-		if len(objResourceList.Download) <= 0 {
-			log.Println("[WARN] FileSyncClient.fetchResList() : resource list is empty : ", string(body))
+	}
+
+	if false == pSelf.verifyResList("/list", objRemoteList.Version, body, httpRes.Header.Get(ManifestSignatureHeader)) {
+		return false
+	}
+
+	// version rollback (an older signed manifest replayed by a mirror, etc.)
+	if true == bHasLocalManifest && objRemoteList.Version < objLocalManifest.Version {
+		if true == pSelf.StrictManifest {
+			log.Printf("[SECURITY] FileSyncClient.fetchResList() : resource list refused, version %d is older than local manifest %d", objRemoteList.Version, objLocalManifest.Version)
 			return false
 		}
 
+		log.Printf("[WARN] FileSyncClient.fetchResList() : resource list version %d is older than local manifest %d", objRemoteList.Version, objLocalManifest.Version)
+	}
+
+	// incremental manifest
+	if true == bUseDelta && objRemoteList.Since > 0 && objRemoteList.Since == objLocalManifest.Version {
+		pSelf.objNewManifest, *objResourceList = applyDeltaResList(&objLocalManifest, &objRemoteList)
+		log.Printf("[INF] FileSyncClient.fetchResList() : manifest version %d -> %d, changes = %d, tasks = %d", objRemoteList.Since, objRemoteList.Version, len(objRemoteList.Download), len(objResourceList.Download))
 		return true
 	}
+
+	// full manifest
+	if len(objRemoteList.Download) <= 0 {
+		log.Println("[WARN] FileSyncClient.fetchResList() : resource list is empty : ", string(body))
+		return false
+	}
+
+	pSelf.objNewManifest = objRemoteList
+	*objResourceList = objRemoteList
+
+	return true
 }
 
 /**
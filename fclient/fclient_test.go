@@ -0,0 +1,219 @@
+/**
+ * @brief		资源文件下载的测试(断点续传)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		切换到临时工作目录(缓存目录 ./FileCache 在当前目录下)
+ * @return		临时目录 + 恢复工作目录的函数
+ */
+func enterTempWorkDir(t *testing.T) (string, func()) {
+	sOldDir, err := os.Getwd()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sTempDir, err := ioutil.TempDir("", "fclient_test")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(sTempDir); nil != err {
+		t.Fatal(err)
+	}
+
+	return sTempDir, func() {
+		os.Chdir(sOldDir)
+		os.RemoveAll(sTempDir)
+	}
+}
+
+/**
+ * @brief		测试用的资源下载服务: 按内容的MD5作为ETag，支持 Range / If-Range; 可以让下一次应答只发一半就断开连接
+ */
+type testResServer struct {
+	objLock   sync.Mutex
+	bytesData []byte   // 当前的资源文件内容
+	lstRanges []string // 收到的各请求的 Range 请求头
+	bCutOnce  bool     // 下一次整个文件的应答只发一半就断开
+}
+
+/**
+ * @brief		/get 的应答
+ */
+func (pSelf *testResServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	pSelf.objLock.Lock()
+	bytesData, bCut := pSelf.bytesData, pSelf.bCutOnce && "" == req.Header.Get("Range")
+	pSelf.lstRanges = append(pSelf.lstRanges, req.Header.Get("Range"))
+	pSelf.bCutOnce = pSelf.bCutOnce && false == bCut
+	pSelf.objLock.Unlock()
+
+	resp.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(bytesData)))
+	if true == bCut {
+		resp.Header().Set("Content-Length", fmt.Sprint(len(bytesData)))
+		resp.WriteHeader(http.StatusOK)
+		resp.Write(bytesData[:len(bytesData)/2])
+		resp.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	http.ServeContent(resp, req, "res", time.Time{}, bytes.NewReader(bytesData))
+}
+
+/**
+ * @brief		重新生成资源文件(同一URI)
+ */
+func (pSelf *testResServer) setData(bytesData []byte) {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	pSelf.bytesData = bytesData
+}
+
+/**
+ * @brief		取出(并清空)收到的 Range 请求头
+ */
+func (pSelf *testResServer) takeRanges() []string {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	lstRanges := pSelf.lstRanges
+	pSelf.lstRanges = nil
+
+	return lstRanges
+}
+
+/**
+ * @brief		生成一个测试用的资源文件内容
+ */
+func makeTestResData(sVersion string) []byte {
+	return []byte(strings.Repeat(sVersion+" resource data\n", 4096))
+}
+
+/**
+ * @brief		下载中断后，用 .part 下载时的ETag续传; 同一URI的文件已经重新生成时，不续传旧的 .part，而是下载整个新文件
+ */
+func TestFetchResourceResumes(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objResServer := &testResServer{bytesData: makeTestResData("v1"), bCutOnce: true}
+	objHttpServer := httptest.NewServer(objResServer)
+	defer objHttpServer.Close()
+
+	sUri := "SyncFolder/SSE/DAY/DAY.20180000"
+	sPartFile := filepath.Join(sTempDir, CacheFolder, sUri) + ".part"
+	objClient := &FileSyncClient{ServerHost: strings.TrimPrefix(objHttpServer.URL, "http://")}
+	fnFetch := func(bytesExpect []byte) TaskStatusType {
+		nTaskStatus, sLocalPath := objClient.FetchResource("sse.d1", sUri, fmt.Sprintf("%x", md5.Sum(bytesExpect)), fmt.Sprintf("%x", sha256.Sum256(bytesExpect)), "")
+		if ST_Completed == nTaskStatus {
+			if bytesData, _ := ioutil.ReadFile(sLocalPath); false == bytes.Equal(bytesExpect, bytesData) {
+				t.Errorf("unexpected content of downloaded file, length = %d", len(bytesData))
+			}
+		}
+
+		return nTaskStatus
+	}
+
+	// 下载中断: 已收到的数据 和 应答的ETag 留在 .part / .part.etag 中
+	if nTaskStatus := fnFetch(makeTestResData("v1")); ST_Error != nTaskStatus {
+		t.Fatalf("interrupted download should fail : %v", nTaskStatus)
+	}
+
+	objPartInfo, err := os.Stat(sPartFile)
+	if nil != err || 0 == objPartInfo.Size() || false == fileExists(sPartFile+".etag") {
+		t.Fatalf("partial download should be kept with its etag : %v", err)
+	}
+
+	// 续传: 只请求 .part 之后的数据
+	objResServer.takeRanges()
+	if nTaskStatus := fnFetch(makeTestResData("v1")); ST_Completed != nTaskStatus {
+		t.Fatalf("resumed download should succeed : %v", nTaskStatus)
+	}
+
+	if lstRanges := objResServer.takeRanges(); 1 != len(lstRanges) || fmt.Sprintf("bytes=%d-", objPartInfo.Size()) != lstRanges[0] {
+		t.Errorf("unexpected range requests : %v", lstRanges)
+	}
+
+	if true == fileExists(sPartFile) || true == fileExists(sPartFile+".etag") {
+		t.Error(".part and its etag should be removed after download")
+	}
+
+	// 旧版本的 .part(ETag不同): 服务器返回整个新文件，不拼接到旧数据后面
+	os.MkdirAll(filepath.Dir(sPartFile), 0755)
+	ioutil.WriteFile(sPartFile, makeTestResData("v1")[:1000], 0644)
+	ioutil.WriteFile(sPartFile+".etag", []byte(fmt.Sprintf("\"%x\"", md5.Sum(makeTestResData("v1")))), 0644)
+	objResServer.setData(makeTestResData("v2"))
+	if nTaskStatus := fnFetch(makeTestResData("v2")); ST_Completed != nTaskStatus {
+		t.Fatalf("download of the new version should succeed : %v", nTaskStatus)
+	}
+
+	// 没有ETag的 .part(不知道来自哪个版本): 不续传
+	ioutil.WriteFile(sPartFile, makeTestResData("v2")[:1000], 0644)
+	objResServer.takeRanges()
+	if nTaskStatus := fnFetch(makeTestResData("v2")); ST_Completed != nTaskStatus {
+		t.Fatalf("download should succeed : %v", nTaskStatus)
+	}
+
+	if lstRanges := objResServer.takeRanges(); 1 != len(lstRanges) || "" != lstRanges[0] {
+		t.Errorf(".part without etag should not be resumed : %v", lstRanges)
+	}
+}
+
+/**
+ * @brief		/live 下发的是实时资源某一代文件的URI: 识别为实时资源(解压时覆盖写)，本地缓存的其它代文件被删除
+ */
+func TestLiveResourceURI(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	for sURI, sAlias := range map[string]string{
+		"SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY":              "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY",
+		"SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.930": "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY",
+		"SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410":     "", // 未发布的文件名
+		"SyncFolder/SSE/DAY/DAY.20180000":                   "",
+		"SyncFolder/SSE/MIN60/MIN60.20180410":               "",
+	} {
+		if bIsLive := "" != sAlias; bIsLive != isLiveURI(sURI) || (true == bIsLive && sAlias != liveAliasOf(sURI)) {
+			t.Errorf("%s : unexpected live alias %s", sURI, liveAliasOf(sURI))
+		}
+	}
+
+	sCacheFolder := filepath.Join(CacheFolder, "SyncFolder/SSE/MIN5_TODAY")
+	os.MkdirAll(sCacheFolder, 0755)
+	for _, sFile := range []string{"MIN5_TODAY.20180410.100", "MIN5_TODAY.20180410.1000", "MIN5_TODAY.20180410.1000.part", "MIN5_TODAY.20180410.1000.part.etag", "MIN5_TODAY.20180410.1005", "MIN5_TODAY.20180410.1005.part", "OTHER.20180410.1000"} {
+		ioutil.WriteFile(filepath.Join(sCacheFolder, sFile), []byte("cache"), 0644)
+	}
+
+	removeLiveCacheFiles("SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY", "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.1005")
+	if lstFiles, _ := filepath.Glob(filepath.Join(sCacheFolder, "*")); 3 != len(lstFiles) || false == fileExists(filepath.Join(sCacheFolder, "MIN5_TODAY.20180410.1005.part")) {
+		t.Errorf("only cache files of the current generation should be kept : %v", lstFiles)
+	}
+}
+
+/**
+ * @brief		判断文件是否存在
+ */
+func fileExists(sFile string) bool {
+	_, err := os.Stat(sFile)
+
+	return nil == err
+}
@@ -6,9 +6,6 @@
 package fclient
 
 import (
-	"crypto/md5"
-	"fmt"
-	"io"
 	"log"
 	"os"
 	"path"
@@ -35,12 +32,15 @@ func init() {
 type FComparison struct {
 	URI          string // Resource URI in server
 	MD5          string // MD5 of Res
+	SHA256       string // SHA256 of Res (preferred if not empty)
+	SIZE         int64  // Size of Res (compared before hashing if not zero)
 	DateTime     string // UpdateTime Of Res
 	TargetFolder string // Target folder 4 extracted data
 }
 
 ///////////////////////////////////// [OutterMethod]
-// [method] Compare Resource Files Between Server & Client
+// [method] Compare Resource Files Between Server & Client (SHA256 preferred, MD5 4 old servers)
+// digests r taken from GlobalHashIndex while size && mtime of the cache file r unchanged
 func (pSelf *FComparison) Compare() (bool, FileDescType) {
 	var nFileDescType FileDescType = FD_IsNotExist
 	// get absolute path of current working folder && build it
@@ -60,17 +60,31 @@ func (pSelf *FComparison) Compare() (bool, FileDescType) {
 	}
 
 	nFileDescType = FD_IsExist
-	// parepare 2 generate md5
 	defer objFile.Close()
-	objMD5Hash := md5.New()
-	if _, err := io.Copy(objMD5Hash, objFile); err != nil {
-		log.Printf("[WARN] FComparison.Compare() : failed 2 generate MD5 : %s : %s", sLocalFile)
+	// compare size first (avoid hashing the whole file)
+	if pSelf.SIZE > 0 {
+		if objFileInfo, err := objFile.Stat(); nil == err && objFileInfo.Size() != pSelf.SIZE {
+			log.Printf("[INF] FComparison.Compare() : found a discrepancy of size between server(url:%s, size:%d) && client(size:%d)", pSelf.URI, pSelf.SIZE, objFileInfo.Size())
+			return false, nFileDescType
+		}
+	}
+
+	// fetch digests (from hash index, or by reading the file)
+	sMD5Str, sSHA256Str, err := GlobalHashIndex.Digest(pSelf.URI, objFile)
+	if err != nil {
+		log.Printf("[WARN] FComparison.Compare() : failed 2 generate MD5/SHA256 : %s : %s", sLocalFile, err.Error())
 		return false, nFileDescType
 	}
 
-	// generate MD5 string
-	var byteMD5 []byte
-	var sMD5Str string = fmt.Sprintf("%x", objMD5Hash.Sum(byteMD5))
+	// compare sha256 if server provides it
+	if "" != pSelf.SHA256 {
+		if strings.ToLower(pSelf.SHA256) != sSHA256Str {
+			log.Printf("[INF] FComparison.Compare() : found a discrepancy of sha256 between server(url:%s) && client(sha256:%s)", strings.ToLower(pSelf.URI), sSHA256Str)
+			return false, nFileDescType
+		}
+
+		return true, nFileDescType
+	}
 
 	// result
 	if strings.ToLower(pSelf.MD5) != strings.ToLower(sMD5Str) {
@@ -0,0 +1,194 @@
+/**
+ * @brief		本地缓存文件的摘要索引
+ * @detail		缓存目录中的 hashindex.xml 记录每个缓存文件(按URI)的 长度 + 修改时间 + MD5/SHA256;
+ 				长度和修改时间都没有变化的缓存文件，直接使用索引中的摘要，不用每次同步都把整个缓存目录重新读一遍计算摘要
+ * @note		-deep-verify 时不信任索引，全部重新计算(并刷新索引)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var (
+	HashIndexFileName string    = "hashindex.xml" // 摘要索引的文件名(在CacheFolder中)
+	GlobalHashIndex   HashIndex                   // 全局缓存文件摘要索引
+)
+
+/**
+ * @Class 		HashIndexItem
+ * @brief		某个缓存文件的摘要记录
+ * @author		barry
+ */
+type HashIndexItem struct {
+	XMLName xml.Name `xml:"file"`
+	URI     string   `xml:"uri,attr"`    // 资源URI路径
+	SIZE    int64    `xml:"size,attr"`   // 缓存文件长度
+	MTIME   int64    `xml:"mtime,attr"`  // 缓存文件修改时间(UnixNano)
+	MD5     string   `xml:"md5,attr"`    // 缓存文件的MD5
+	SHA256  string   `xml:"sha256,attr"` // 缓存文件的SHA256
+}
+
+/**
+ * @Class 		HashIndex
+ * @brief		缓存文件摘要索引(各资源类别的下载任务并发访问)
+ * @author		barry
+ */
+type HashIndex struct {
+	objLock     sync.Mutex               // 索引锁
+	mapItems    map[string]HashIndexItem // URI -> 摘要记录
+	bDeepVerify bool                     // 不信任索引，全部重新计算摘要
+}
+
+///< ---------------------- [Public 方法] -----------------------------
+/**
+ * @brief		初始化 + 加载缓存目录中的摘要索引(不存在或无法解析时，从空索引开始)
+ * @param[in]	bDeepVerify		true: 不信任索引中的摘要
+ */
+func (pSelf *HashIndex) Initialize(bDeepVerify bool) bool {
+	var objIndexFile struct {
+		XMLName xml.Name        `xml:"hashindex"`
+		Files   []HashIndexItem `xml:"file"`
+	}
+
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	pSelf.bDeepVerify = bDeepVerify
+	pSelf.mapItems = make(map[string]HashIndexItem)
+	bytesData, err := ioutil.ReadFile(filepath.Join(CacheFolder, HashIndexFileName))
+	if nil != err {
+		return true
+	}
+
+	if err = xml.Unmarshal(bytesData, &objIndexFile); nil != err {
+		log.Println("[WARN] HashIndex.Initialize() : invalid hash index, ignore it : ", err.Error())
+		return true
+	}
+
+	for _, objItem := range objIndexFile.Files {
+		pSelf.mapItems[objItem.URI] = objItem
+	}
+
+	log.Printf("[INF] HashIndex.Initialize() : %d items loaded, deep verify = %v", len(pSelf.mapItems), bDeepVerify)
+
+	return true
+}
+
+/**
+ * @brief		取缓存文件的摘要(索引命中时直接返回，否则读文件计算并更新索引)
+ * @param[in]	sURI			资源URI路径
+ * @param[in]	objFile			已经打开的缓存文件
+ * @return		MD5串 + SHA256串 + 错误
+ */
+func (pSelf *HashIndex) Digest(sURI string, objFile *os.File) (string, string, error) {
+	objFileInfo, err := objFile.Stat()
+	if nil != err {
+		return "", "", err
+	}
+
+	pSelf.objLock.Lock()
+	objItem, ok := pSelf.mapItems[sURI]
+	bDeepVerify := pSelf.bDeepVerify
+	pSelf.objLock.Unlock()
+	if true == ok && false == bDeepVerify && objItem.SIZE == objFileInfo.Size() && objItem.MTIME == objFileInfo.ModTime().UnixNano() {
+		return objItem.MD5, objItem.SHA256, nil
+	}
+
+	objMD5Hash := md5.New()
+	objSHA256Hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(objMD5Hash, objSHA256Hash), objFile); nil != err {
+		return "", "", err
+	}
+
+	sMD5 := fmt.Sprintf("%x", objMD5Hash.Sum(nil))
+	sSHA256 := fmt.Sprintf("%x", objSHA256Hash.Sum(nil))
+	pSelf.Update(sURI, objFileInfo, sMD5, sSHA256)
+
+	return sMD5, sSHA256, nil
+}
+
+/**
+ * @brief		更新某个缓存文件的摘要记录(如: 刚下载完成、已经校验过的文件)
+ */
+func (pSelf *HashIndex) Update(sURI string, objFileInfo os.FileInfo, sMD5, sSHA256 string) {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	if nil == pSelf.mapItems {
+		pSelf.mapItems = make(map[string]HashIndexItem)
+	}
+
+	pSelf.mapItems[sURI] = HashIndexItem{URI: sURI, SIZE: objFileInfo.Size(), MTIME: objFileInfo.ModTime().UnixNano(), MD5: sMD5, SHA256: sSHA256}
+}
+
+/**
+ * @brief		删除某个缓存文件的摘要记录
+ */
+func (pSelf *HashIndex) Remove(sURI string) {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	delete(pSelf.mapItems, sURI)
+}
+
+/**
+ * @brief		索引存盘(先写临时文件再改名)
+ * @note		缓存文件已经不存在的记录(如被清空的分类目录)，不再存盘
+ */
+func (pSelf *HashIndex) Save() bool {
+	var objIndexFile struct {
+		XMLName xml.Name        `xml:"hashindex"`
+		Files   []HashIndexItem `xml:"file"`
+	}
+
+	var lstSortKeys []string
+
+	pSelf.objLock.Lock()
+	for sURI := range pSelf.mapItems {
+		if _, err := os.Stat(filepath.Join(CacheFolder, sURI)); nil != err {
+			delete(pSelf.mapItems, sURI)
+			continue
+		}
+
+		lstSortKeys = append(lstSortKeys, sURI)
+	}
+
+	sort.Strings(lstSortKeys)
+	for _, sURI := range lstSortKeys {
+		objIndexFile.Files = append(objIndexFile.Files, pSelf.mapItems[sURI])
+	}
+	pSelf.objLock.Unlock()
+
+	bytesData, err := xml.Marshal(&objIndexFile)
+	if nil != err {
+		log.Println("[WARN] HashIndex.Save() : cannot marshal hash index : ", err.Error())
+		return false
+	}
+
+	sIndexFile := filepath.Join(CacheFolder, HashIndexFileName)
+	os.MkdirAll(CacheFolder, 0755)
+	if err = ioutil.WriteFile(sIndexFile+".tmp", bytesData, 0644); nil != err {
+		log.Println("[WARN] HashIndex.Save() : cannot save hash index : ", err.Error())
+		return false
+	}
+
+	if err = os.Rename(sIndexFile+".tmp", sIndexFile); nil != err {
+		log.Println("[WARN] HashIndex.Save() : cannot save hash index : ", err.Error())
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,119 @@
+/**
+ * @brief		交易所休市日历
+ * @detail		HolidayFolder 目录中每个市场一个休市日历文件(<市场编号>.txt，如: sse.txt)，与服务端的休市日历文件格式相同:
+ 				每行一个日期(yyyymmdd)，或一个日期段(yyyymmdd~yyyymmdd)，'#'后为注释
+ * @note		周六、周日总是休市; 没有休市日历文件的市场，只按周末判断交易日
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * @Class 		HolidayCalendar
+ * @brief		某市场的休市日历
+ * @note 		nil 日历只按周末判断交易日
+ * @author		barry
+ */
+type HolidayCalendar struct {
+	mapHolidays map[int]bool // 休市日(yyyymmdd，不含周末)
+}
+
+/**
+ * @brief		从文件加载休市日历
+ * @param[in]	sFile			休市日历文件路径
+ */
+func LoadHolidayCalendar(sFile string) (*HolidayCalendar, error) {
+	objFile, err := os.Open(sFile)
+	if nil != err {
+		return nil, err
+	}
+
+	defer objFile.Close()
+	objCalendar := &HolidayCalendar{mapHolidays: make(map[int]bool)}
+	objScanner := bufio.NewScanner(objFile)
+	for nLineNo := 1; objScanner.Scan(); nLineNo++ {
+		sLine := objScanner.Text()
+		if nPos := strings.Index(sLine, "#"); nPos >= 0 {
+			sLine = sLine[:nPos]
+		}
+
+		if sLine = strings.TrimSpace(sLine); "" == sLine {
+			continue
+		}
+
+		lstDateStr := strings.Split(sLine, "~")
+		objBegin, err := parseHolidayDate(lstDateStr[0])
+		objEnd := objBegin
+		if nil == err && 2 == len(lstDateStr) {
+			objEnd, err = parseHolidayDate(lstDateStr[1])
+		}
+
+		if nil != err || len(lstDateStr) > 2 || objEnd.Before(objBegin) {
+			return nil, fmt.Errorf("invalid holiday (yyyymmdd or yyyymmdd~yyyymmdd) at %s:%d : %s", sFile, nLineNo, sLine)
+		}
+
+		for objDate := objBegin; false == objDate.After(objEnd); objDate = objDate.AddDate(0, 0, 1) {
+			objCalendar.mapHolidays[objDate.Year()*10000+int(objDate.Month())*100+objDate.Day()] = true
+		}
+	}
+
+	if err := objScanner.Err(); nil != err {
+		return nil, err
+	}
+
+	return objCalendar, nil
+}
+
+/**
+ * @brief		判断某天是否为交易日(非周末，且不是休市日)
+ * @param[in]	objDate			日期
+ */
+func (pSelf *HolidayCalendar) IsTradingDay(objDate time.Time) bool {
+	if time.Saturday == objDate.Weekday() || time.Sunday == objDate.Weekday() {
+		return false
+	}
+
+	return nil == pSelf || false == pSelf.mapHolidays[objDate.Year()*10000+int(objDate.Month())*100+objDate.Day()]
+}
+
+/**
+ * @brief		某天之前(不含)的最后一个交易日
+ * @param[in]	objDate			日期
+ */
+func (pSelf *HolidayCalendar) LastTradingDayBefore(objDate time.Time) time.Time {
+	for i := 0; i < 3660; i++ { // 最多向前找10年(防止休市日历配置错误时死循环)
+		objDate = objDate.AddDate(0, 0, -1)
+		if true == pSelf.IsTradingDay(objDate) {
+			break
+		}
+	}
+
+	return objDate
+}
+
+/**
+ * @brief		把yyyymmdd串转成日期
+ */
+func parseHolidayDate(sDate string) (time.Time, error) {
+	sDate = strings.TrimSpace(sDate)
+	nDate, err := strconv.Atoi(sDate)
+	if nil != err || 8 != len(sDate) {
+		return time.Time{}, fmt.Errorf("invalid date : %s", sDate)
+	}
+
+	objDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 12, 0, 0, 0, time.Local)
+	if objDate.Year()*10000+int(objDate.Month())*100+objDate.Day() != nDate {
+		return time.Time{}, fmt.Errorf("invalid date : %s", sDate)
+	}
+
+	return objDate, nil
+}
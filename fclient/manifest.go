@@ -0,0 +1,157 @@
+/**
+ * @brief		本地资源清单(最后一次完整应用的清单版本)
+ * @detail		同步完成后，把服务器的清单(含版本号)存到缓存目录; 下次同步时用 /list?since=<版本号> 只取增量清单，
+ 				清单没有变化时，跳过对本地缓存文件的逐个MD5比对
+ * @note		删除缓存目录中的 manifest.xml，可强制做一次全量比对
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ManifestFileName string = "manifest.xml" // 本地资源清单的文件名(在CacheFolder中)
+)
+
+const (
+	RS_Added   string = "added"   // 新增的资源
+	RS_Changed string = "changed" // 变化的资源
+	RS_Removed string = "removed" // 已经删除的资源
+)
+
+/**
+ * @brief		加载本地资源清单
+ * @param[out]	objResourceList		本地资源清单
+ * @return		true				加载成功(且有版本号)
+ */
+func loadLocalManifest(objResourceList *ResourceList) bool {
+	bytesData, err := ioutil.ReadFile(filepath.Join(CacheFolder, ManifestFileName))
+	if nil != err {
+		return false
+	}
+
+	if err = xml.Unmarshal(bytesData, objResourceList); nil != err {
+		log.Println("[WARN] loadLocalManifest() : invalid local manifest, ignore it : ", err.Error())
+		return false
+	}
+
+	return objResourceList.Version > 0
+}
+
+/**
+ * @brief		保存本地资源清单(先写临时文件再改名，避免写一半的清单)
+ * @param[in]	refResourceList		已经完整应用的资源清单
+ */
+func saveLocalManifest(refResourceList *ResourceList) bool {
+	sManifestFile := filepath.Join(CacheFolder, ManifestFileName)
+	bytesData, err := xml.Marshal(refResourceList)
+	if nil != err {
+		log.Println("[WARN] saveLocalManifest() : cannot marshal manifest : ", err.Error())
+		return false
+	}
+
+	os.MkdirAll(CacheFolder, 0755)
+	if err = ioutil.WriteFile(sManifestFile+".tmp", bytesData, 0644); nil != err {
+		log.Println("[WARN] saveLocalManifest() : cannot save manifest : ", err.Error())
+		return false
+	}
+
+	if err = os.Rename(sManifestFile+".tmp", sManifestFile); nil != err {
+		log.Println("[WARN] saveLocalManifest() : cannot save manifest : ", err.Error())
+		return false
+	}
+
+	return true
+}
+
+/**
+ * @brief		把增量清单应用到本地清单上
+ * @param[in]	refBaseList		本地资源清单(版本 = 增量清单的Since)
+ * @param[in]	refDeltaList	服务器返回的增量清单
+ * @return		应用后的完整清单(版本 = 增量清单的Version) + 需要同步的任务清单(有变化的资源类型下的全部资源项 + 删除的资源的墓碑项)
+ * @note		变化的项原位替换; 新增的项插在同类型的最后一项之后(保证同一类型的资源在清单中连续且有序);
+ 				本地清单中的墓碑项，不再保留
+ */
+func applyDeltaResList(refBaseList, refDeltaList *ResourceList) (ResourceList, ResourceList) {
+	var objMergedList ResourceList = ResourceList{Version: refDeltaList.Version}
+	var objTaskList ResourceList = ResourceList{Version: refDeltaList.Version}
+	var mapDelta map[string]ResDownload = make(map[string]ResDownload)
+	var mapChangedType map[string]bool = make(map[string]bool)
+
+	for _, objRes := range refDeltaList.Download {
+		mapDelta[objRes.URI] = objRes
+		mapChangedType[objRes.TYPE] = true
+	}
+
+	// 删除 + 原位替换
+	for _, objRes := range refBaseList.Download {
+		if objDelta, ok := mapDelta[objRes.URI]; true == ok {
+			delete(mapDelta, objRes.URI)
+			mapChangedType[objRes.TYPE] = true
+			if RS_Removed == objDelta.STATUS {
+				continue
+			}
+
+			objRes = objDelta
+		} else if true == objRes.Removed {
+			continue
+		}
+
+		objRes.STATUS = ""
+		objMergedList.Download = append(objMergedList.Download, objRes)
+	}
+
+	// 新增
+	for _, objRes := range refDeltaList.Download {
+		if _, ok := mapDelta[objRes.URI]; false == ok || RS_Removed == objRes.STATUS {
+			continue
+		}
+
+		objRes.STATUS = ""
+		objMergedList.Download = insertAfterSameType(objMergedList.Download, objRes)
+	}
+
+	for _, objRes := range objMergedList.Download {
+		if true == mapChangedType[objRes.TYPE] {
+			objTaskList.Download = append(objTaskList.Download, objRes)
+		}
+	}
+
+	// 删除的资源: 以墓碑项加入任务清单，由下载任务清理本地缓存
+	for _, objRes := range refDeltaList.Download {
+		if RS_Removed == objRes.STATUS {
+			objRes.STATUS = ""
+			objRes.Removed = true
+			objTaskList.Download = insertAfterSameType(objTaskList.Download, objRes)
+		}
+	}
+
+	return objMergedList, objTaskList
+}
+
+/**
+ * @brief		把资源项插入到同类型的最后一项之后(没有同类型的项时，追加到末尾)
+ * @note		下载任务按类型连续分组，同一类型的资源项必须在清单中连续
+ */
+func insertAfterSameType(lstDownload []ResDownload, objRes ResDownload) []ResDownload {
+	var nInsertPos int = len(lstDownload)
+	for i := len(lstDownload) - 1; i >= 0; i-- {
+		if lstDownload[i].TYPE == objRes.TYPE {
+			nInsertPos = i + 1
+			break
+		}
+	}
+
+	lstDownload = append(lstDownload, ResDownload{})
+	copy(lstDownload[nInsertPos+1:], lstDownload[nInsertPos:])
+	lstDownload[nInsertPos] = objRes
+
+	return lstDownload
+}
@@ -0,0 +1,146 @@
+/**
+ * @brief		本地资源清单的测试(增量清单的应用)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+ * @brief		生成一个测试用的资源项
+ * @param[in]	sDesc			资源描述: 类型 uri md5 [变化类型(added/changed/removed) 或 tombstone(本地清单中的墓碑项)]，如: "sse.d1 a 2 changed"
+ */
+func makeTestRes(sDesc string) ResDownload {
+	lstFields := strings.Fields(sDesc)
+	objRes := ResDownload{TYPE: lstFields[0], URI: lstFields[1], MD5: lstFields[2]}
+	if len(lstFields) > 3 {
+		if "tombstone" == lstFields[3] {
+			objRes.Removed = true
+		} else {
+			objRes.STATUS = lstFields[3]
+		}
+	}
+
+	return objRes
+}
+
+/**
+ * @brief		生成一个测试用的资源清单
+ */
+func makeTestResList(nVersion, nSince uint64, lstDesc ...string) ResourceList {
+	objResourceList := ResourceList{Version: nVersion, Since: nSince}
+	for _, sDesc := range lstDesc {
+		objResourceList.Download = append(objResourceList.Download, makeTestRes(sDesc))
+	}
+
+	return objResourceList
+}
+
+/**
+ * @brief		资源清单的描述(uri:md5，墓碑项前面加'!'; 带有变化类型的项后面加'?')
+ */
+func descResList(refResourceList *ResourceList) string {
+	var lstDesc []string
+	for _, objRes := range refResourceList.Download {
+		sDesc := objRes.URI + ":" + objRes.MD5
+		if true == objRes.Removed {
+			sDesc = "!" + sDesc
+		}
+
+		if "" != objRes.STATUS {
+			sDesc += "?"
+		}
+
+		lstDesc = append(lstDesc, sDesc)
+	}
+
+	return strings.Join(lstDesc, " ")
+}
+
+/**
+ * @brief		增量清单应用到本地清单: 合并后的完整清单 + 需要同步的任务清单
+ * @detail		任务清单 = 有变化的资源类型下的全部资源项 + 删除的资源的墓碑项; 没有变化的类型不再逐个比对
+ */
+func TestApplyDeltaResList(t *testing.T) {
+	objBaseList := makeTestResList(7, 0, "sse.d1 a 1", "sse.d1 b 1", "sse.m5 c 1", "sse.m60 e 1")
+
+	for _, objCase := range []struct {
+		sDesc    string       // 用例说明
+		objBase  ResourceList // 本地资源清单
+		objDelta ResourceList // 服务器返回的增量清单
+		sMerged  string       // 合并后的完整清单
+		sTasks   string       // 需要同步的任务清单
+	}{
+		{
+			"empty delta : no tasks (fast path)", objBaseList, makeTestResList(8, 7),
+			"a:1 b:1 c:1 e:1", "",
+		},
+		{
+			"added + changed + removed", objBaseList, makeTestResList(8, 7, "sse.d1 a 2 changed", "sse.m5 d 1 added", "sse.d1 b 1 removed"),
+			"a:2 c:1 d:1 e:1", "a:2 !b:1 c:1 d:1",
+		},
+		{
+			"added items are kept after the same type", objBaseList, makeTestResList(8, 7, "sse.m5 c2 1 added", "sse.d1 a2 1 added", "sse.w1 f 1 added"),
+			"a:1 b:1 a2:1 c:1 c2:1 e:1 f:1", "a:1 b:1 a2:1 c:1 c2:1 f:1",
+		},
+		{
+			"removed item is the last of its type", objBaseList, makeTestResList(8, 7, "sse.m60 e 1 removed"),
+			"a:1 b:1 c:1", "!e:1",
+		},
+		{
+			"local tombstone is not carried over", makeTestResList(7, 0, "sse.d1 a 1", "sse.d1 x 1 tombstone", "sse.m5 c 1"), makeTestResList(8, 7, "sse.m5 c 2 changed"),
+			"a:1 c:2", "c:2",
+		},
+		{
+			"local tombstone is dropped by an empty delta", makeTestResList(7, 0, "sse.d1 a 1", "sse.d1 x 1 tombstone"), makeTestResList(8, 7),
+			"a:1", "",
+		},
+		{
+			"local tombstone of a changed type is not a task", makeTestResList(7, 0, "sse.d1 a 1", "sse.d1 x 1 tombstone"), makeTestResList(8, 7, "sse.d1 y 1 added"),
+			"a:1 y:1", "a:1 y:1",
+		},
+	} {
+		objMerged, objTasks := applyDeltaResList(&objCase.objBase, &objCase.objDelta)
+		if 8 != objMerged.Version || 8 != objTasks.Version || 0 != objMerged.Since {
+			t.Errorf("%s : unexpected version, merged=%d(since %d), tasks=%d", objCase.sDesc, objMerged.Version, objMerged.Since, objTasks.Version)
+		}
+
+		if sMerged := descResList(&objMerged); objCase.sMerged != sMerged {
+			t.Errorf("%s : unexpected merged list [%s], expect [%s]", objCase.sDesc, sMerged, objCase.sMerged)
+		}
+
+		if sTasks := descResList(&objTasks); objCase.sTasks != sTasks {
+			t.Errorf("%s : unexpected task list [%s], expect [%s]", objCase.sDesc, sTasks, objCase.sTasks)
+		}
+	}
+
+	if "a:1 b:1 c:1 e:1" != descResList(&objBaseList) {
+		t.Errorf("local manifest has been modified : [%s]", descResList(&objBaseList))
+	}
+}
+
+/**
+ * @brief		资源项插入到同类型的最后一项之后，没有同类型的项时追加到末尾
+ */
+func TestInsertAfterSameType(t *testing.T) {
+	for _, objCase := range []struct {
+		objList ResourceList // 原清单
+		sInsert string       // 插入的资源项
+		sExpect string       // 插入后的清单
+	}{
+		{makeTestResList(1, 0), "sse.d1 a 1", "a:1"},
+		{makeTestResList(1, 0, "sse.d1 a 1", "sse.m5 c 1"), "sse.d1 b 1", "a:1 b:1 c:1"},
+		{makeTestResList(1, 0, "sse.d1 a 1", "sse.m5 c 1"), "sse.m5 d 1", "a:1 c:1 d:1"},
+		{makeTestResList(1, 0, "sse.d1 a 1", "sse.m5 c 1"), "sse.w1 f 1", "a:1 c:1 f:1"},
+		{makeTestResList(1, 0, "sse.d1 a 1", "sse.m5 c 1", "sse.d1 b 1"), "sse.d1 x 1", "a:1 c:1 b:1 x:1"},
+	} {
+		objCase.objList.Download = insertAfterSameType(objCase.objList.Download, makeTestRes(objCase.sInsert))
+		if sResult := descResList(&objCase.objList); objCase.sExpect != sResult {
+			t.Errorf("insert %s : unexpected list [%s], expect [%s]", objCase.sInsert, sResult, objCase.sExpect)
+		}
+	}
+}
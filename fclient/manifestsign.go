@@ -0,0 +1,83 @@
+/**
+ * @brief		资源清单签名验证
+ * @detail		服务器用Ed25519私钥对 /list 和 /live 的应答体签名(应答头 X-Manifest-Signature，base64)，
+ 				客户端用配置的公钥验证，确认清单(及其中各资源的MD5)确实来自服务器，而不是被代理/镜像篡改过的
+ * @note		签名内容为 前缀 + 接口 + 清单版本号 + 应答体(见 manifestMessage())，其它接口的应答、篡改了版本号的清单都验证不通过
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	ManifestSignatureHeader string = "X-Manifest-Signature" // 清单签名的应答头
+	ManifestSignContext     string = "filesync-manifest-v1" // 签名内容的前缀(与服务器一致)
+)
+
+/**
+ * @brief		加载清单签名公钥
+ * @param[in]	sPublicKey		公钥的hex串，或者保存公钥hex串的文件路径(服务器生成的 <密钥文件>.pub)
+ */
+func loadManifestPublicKey(sPublicKey string) (ed25519.PublicKey, error) {
+	sHexKey := strings.TrimSpace(sPublicKey)
+	if bytesKey, err := hex.DecodeString(sHexKey); nil == err && ed25519.PublicKeySize == len(bytesKey) {
+		return ed25519.PublicKey(bytesKey), nil
+	}
+
+	bytesContent, err := ioutil.ReadFile(sPublicKey)
+	if nil != err {
+		return nil, err
+	}
+
+	bytesKey, err := hex.DecodeString(strings.TrimSpace(string(bytesContent)))
+	if nil != err || ed25519.PublicKeySize != len(bytesKey) {
+		return nil, fmt.Errorf("invalid manifest public key (hex string of %d bytes) : %s", ed25519.PublicKeySize, sPublicKey)
+	}
+
+	return ed25519.PublicKey(bytesKey), nil
+}
+
+/**
+ * @brief		清单签名的内容: 前缀 + 接口 + 清单版本号 + 应答体(同服务器)
+ * @param[in]	sEndpoint		接口路径(/list 或 /live)
+ * @param[in]	nVersion		应答体中清单的版本号(/live 为0)
+ * @param[in]	bytesBody		完整的应答体
+ */
+func manifestMessage(sEndpoint string, nVersion uint64, bytesBody []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s\n%s\n%d\n", ManifestSignContext, sEndpoint, nVersion)), bytesBody...)
+}
+
+/**
+ * @brief		验证清单应答体的签名
+ * @param[in]	objPublicKey	签名公钥
+ * @param[in]	sEndpoint		请求的接口路径(/list 或 /live)
+ * @param[in]	nVersion		应答体中清单的版本号
+ * @param[in]	bytesBody		完整的应答体
+ * @param[in]	sSignature		应答头中的base64签名串
+ * @return		nil				签名正确
+ */
+func verifyManifest(objPublicKey ed25519.PublicKey, sEndpoint string, nVersion uint64, bytesBody []byte, sSignature string) error {
+	if "" == sSignature {
+		return errors.New("resource list is not signed")
+	}
+
+	bytesSignature, err := base64.StdEncoding.DecodeString(sSignature)
+	if nil != err {
+		return fmt.Errorf("invalid signature of resource list : %s", err.Error())
+	}
+
+	if false == ed25519.Verify(objPublicKey, manifestMessage(sEndpoint, nVersion, bytesBody), bytesSignature) {
+		return errors.New("signature of resource list mismatch")
+	}
+
+	return nil
+}
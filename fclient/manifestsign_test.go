@@ -0,0 +1,96 @@
+/**
+ * @brief		资源清单签名验证的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/**
+ * @brief		签名绑定了接口和清单版本号: 其它接口的应答、改动了版本号的清单都验证不通过
+ */
+func TestVerifyManifest(t *testing.T) {
+	objPublicKey, objPrivateKey, err := ed25519.GenerateKey(nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	bytesBody := []byte(`<resource version="3"><download type="sse.d1" uri="a" md5="1" update=""></download></resource>`)
+	sSignature := base64.StdEncoding.EncodeToString(ed25519.Sign(objPrivateKey, manifestMessage("/list", 3, bytesBody)))
+	for _, objCase := range []struct {
+		sDesc      string
+		sEndpoint  string
+		nVersion   uint64
+		sSignature string
+		bValid     bool
+	}{
+		{"signed list", "/list", 3, sSignature, true},
+		{"list replayed as live list", "/live", 3, sSignature, false},
+		{"another version", "/list", 4, sSignature, false},
+		{"body only signature", "/list", 3, base64.StdEncoding.EncodeToString(ed25519.Sign(objPrivateKey, bytesBody)), false},
+		{"not signed", "/list", 3, "", false},
+		{"invalid base64", "/list", 3, "#" + sSignature, false},
+	} {
+		if err := verifyManifest(objPublicKey, objCase.sEndpoint, objCase.nVersion, bytesBody, objCase.sSignature); objCase.bValid != (nil == err) {
+			t.Errorf("%s : unexpected result : %v", objCase.sDesc, err)
+		}
+	}
+}
+
+/**
+ * @brief		严格模式下，拒绝比本地清单旧的清单(即使签名正确)，以及用其它接口的应答冒充的清单
+ */
+func TestStrictManifestRejectsReplay(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objPublicKey, objPrivateKey, err := ed25519.GenerateKey(nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var sEndpoint string           // 服务器签名时用的接口
+	var objServerList ResourceList // 服务器返回的清单
+	objHttpServer := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		bytesBody, _ := xml.Marshal(&objServerList)
+		resp.Header().Set(ManifestSignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(objPrivateKey, manifestMessage(sEndpoint, objServerList.Version, bytesBody))))
+		resp.Write(bytesBody)
+	}))
+	defer objHttpServer.Close()
+
+	saveLocalManifest(&ResourceList{Version: 5, Download: []ResDownload{makeTestRes("sse.d1 a 2")}})
+	objClient := &FileSyncClient{ServerHost: strings.TrimPrefix(objHttpServer.URL, "http://"), objManifestKey: objPublicKey, StrictManifest: true}
+	for _, objCase := range []struct {
+		sDesc     string
+		sEndpoint string
+		objList   ResourceList
+		bStrictOk bool // 严格模式下是否接受
+	}{
+		{"newer full list", "/list", makeTestResList(6, 0, "sse.d1 a 3"), true},
+		{"same version", "/list", makeTestResList(5, 0, "sse.d1 a 2"), true},
+		{"older signed list", "/list", makeTestResList(3, 0, "sse.d1 a 1"), false},
+		{"live list replayed as resource list", "/live", makeTestResList(6, 0, "sse.d1 a 3"), false},
+	} {
+		var objResourceList ResourceList
+
+		sEndpoint, objServerList = objCase.sEndpoint, objCase.objList
+		objClient.StrictManifest = true
+		if bIsOk := objClient.fetchResList(&objResourceList); objCase.bStrictOk != bIsOk {
+			t.Errorf("%s : unexpected result in strict mode : %v", objCase.sDesc, bIsOk)
+		}
+
+		objClient.StrictManifest = false
+		if false == objClient.fetchResList(&objResourceList) {
+			t.Errorf("%s : list should be accepted in non-strict mode", objCase.sDesc)
+		}
+	}
+}
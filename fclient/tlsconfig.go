@@ -0,0 +1,82 @@
+/**
+ * @brief		https(TLS)连接配置
+ * @detail		自定义CA证书 + 服务器证书指纹锁定(pin) + 客户端证书(双向认证)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+/**
+ * @brief		生成TLS客户端配置
+ * @param[in]	sCAFile			信任的CA证书文件(PEM)，为空时使用系统CA
+ * @param[in]	sPinnedSHA256	服务器证书(DER)的sha256指纹(hex，可带':')，为空时不锁定;
+ 								只指定指纹、不指定CA时，不再校验证书链(适用于自签名证书)，只比对指纹
+ * @param[in]	sCertFile		客户端证书文件(PEM)，双向认证时使用
+ * @param[in]	sKeyFile		客户端私钥文件(PEM)，双向认证时使用
+ */
+func buildTLSConfig(sCAFile, sPinnedSHA256, sCertFile, sKeyFile string) (*tls.Config, error) {
+	objTLSConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// 信任的CA证书
+	if "" != sCAFile {
+		bytesPem, err := ioutil.ReadFile(sCAFile)
+		if nil != err {
+			return nil, err
+		}
+
+		objCertPool := x509.NewCertPool()
+		if false == objCertPool.AppendCertsFromPEM(bytesPem) {
+			return nil, fmt.Errorf("no certificate found in CA file : %s", sCAFile)
+		}
+
+		objTLSConfig.RootCAs = objCertPool
+	}
+
+	// 客户端证书(双向认证)
+	if "" != sCertFile || "" != sKeyFile {
+		objCert, err := tls.LoadX509KeyPair(sCertFile, sKeyFile)
+		if nil != err {
+			return nil, err
+		}
+
+		objTLSConfig.Certificates = []tls.Certificate{objCert}
+	}
+
+	// 锁定服务器证书指纹
+	if "" != sPinnedSHA256 {
+		sPinned := strings.ToLower(strings.Replace(sPinnedSHA256, ":", "", -1))
+		if bytesPinned, err := hex.DecodeString(sPinned); nil != err || len(bytesPinned) != sha256.Size {
+			return nil, fmt.Errorf("invalid sha256 fingerprint of pinned certificate : %s", sPinnedSHA256)
+		}
+
+		if "" == sCAFile {
+			objTLSConfig.InsecureSkipVerify = true // 不校验证书链，由下面的指纹比对代替
+		}
+
+		objTLSConfig.VerifyPeerCertificate = func(lstRawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(lstRawCerts) == 0 {
+				return errors.New("server did not present a certificate")
+			}
+
+			bytesDigest := sha256.Sum256(lstRawCerts[0])
+			if hex.EncodeToString(bytesDigest[:]) != sPinned {
+				return fmt.Errorf("server certificate (sha256=%x) does not match the pinned fingerprint", bytesDigest)
+			}
+
+			return nil
+		}
+	}
+
+	return objTLSConfig, nil
+}
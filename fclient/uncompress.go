@@ -27,6 +27,36 @@ func init() {
 	objCacheFileTable.Initialize()
 }
 
+/**
+* @brief			取实时资源某一代文件的别名URI
+* @detail			实时资源的每一代文件名为 <别名>.<date>.<hhmm>(如: SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.930，见 /live 的应答)
+* @return			别名URI(不是实时资源某一代文件的URI时，原样返回)
+*/
+func liveAliasOf(sURI string) string {
+	sURI = strings.Replace(sURI, "\\", "/", -1)
+	sAlias := path.Dir(sURI) + "/" + path.Base(path.Dir(sURI))
+	lstParts := strings.Split(strings.TrimPrefix(sURI, sAlias+"."), ".")
+	if true == strings.HasPrefix(sURI, sAlias+".") && 2 == len(lstParts) {
+		_, errDate := strconv.Atoi(lstParts[0])
+		_, errTime := strconv.Atoi(lstParts[1])
+		if nil == errDate && nil == errTime {
+			return sAlias
+		}
+	}
+
+	return sURI
+}
+
+/**
+* @brief			判断是否为实时资源的URI(别名URI，如: SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY; 或其某一代文件的URI)
+* @note				别名URI的文件名与所在目录名相同(其它资源的文件名都带日期); 实时资源每次下发今天的全部数据，解压时覆盖写
+*/
+func isLiveURI(sURI string) bool {
+	sURI = liveAliasOf(sURI)
+
+	return path.Base(sURI) == path.Base(path.Dir(sURI))
+}
+
 ////////////////////////// 解压类 /////////////////////////////////////
 type Uncompress struct {
 	TargetFolder string // 解压数据文件存放的根目录
@@ -58,7 +88,7 @@ func (pSelf *Uncompress) Unzip(sZipSrcPath, sSubPath, sDataType string) bool {
 	}(objBufFile)
 	//////////// 对不同的文件类型，使用不同的写文件方式 ////////////////////////
 	nFileOpenMode := os.O_RDWR | os.O_CREATE
-	if false == strings.Contains(sSubPath, "HKSE") && false == strings.Contains(sSubPath, "QLFILE") && false == strings.Contains(sSubPath, "MIN1_TODAY") && false == strings.Contains(sSubPath, "STATIC.") && false == strings.Contains(sSubPath, "WEIGHT.") {
+	if false == strings.Contains(sSubPath, "HKSE") && false == strings.Contains(sSubPath, "QLFILE") && false == isLiveURI(sSubPath) && false == strings.Contains(sSubPath, "STATIC.") && false == strings.Contains(sSubPath, "WEIGHT.") {
 		nFileOpenMode |= os.O_APPEND
 	} else {
 		nFileOpenMode |= os.O_TRUNC
@@ -14,8 +14,18 @@ import (
 	"time"
 )
 
-// Package Initialization
+// Package Initialization (register record formats of hkse files)
 func init() {
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"hkse"}, DataType: "participant", DestPrefix: "Participant.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &ParticipantRecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"hkse"}, DataType: "shase_rzrq_by_date", DestPrefix: "shase_rzrq_by_date/shase_rzrq_by_date.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &Shase_rzrq_by_date{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"hkse"}, DataType: "sznse_rzrq_by_date", DestPrefix: "sznse_rzrq_by_date/sznse_rzrq_by_date.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &Sznse_rzrq_by_date{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"hkse"}, DataType: "shsz_idx_by_date", DestPrefix: "shsz_idx_by_date/shsz_idx_by_date.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &Shsz_idx_by_date{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"hkse"}, DataType: "shsz_detail", DestPrefix: "shsz_detail/shsz_detail.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &Shsz_detail{BaseRecordIO: objBase} }})
 }
 
 ///////////////////////// Participant Lines ///////////////////////////////////////////
@@ -63,10 +73,7 @@ func (pSelf *Shase_rzrq_by_date) GrapWriter(sFilePath string, nDate int, sSrcFil
 		return nil
 	}
 
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-	if nDays <= 16 { ////// Current Month
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays) { ////// Recent Trading Days
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { ////////////////////////// Not Current Month
 		if nDate/10000 < objToday.Year() { // Not Current Year
@@ -82,22 +89,7 @@ func (pSelf *Shase_rzrq_by_date) GrapWriter(sFilePath string, nDate int, sSrcFil
 		}
 	}
 
-	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
-		return objHandles.TarWriter
-	} else {
-		var objCompressHandles CompressHandles
-
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
-			pSelf.mapFileHandle[sFile] = objCompressHandles
-
-			return pSelf.mapFileHandle[sFile].TarWriter
-		} else {
-			log.Println("[ERR] Shase_rzrq_by_date.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
-		}
-
-	}
-
-	return nil
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
 }
 
 ///////////////////////// sznse_rzrq_by_date Lines ///////////////////////////////////////////
@@ -126,10 +118,7 @@ func (pSelf *Sznse_rzrq_by_date) GrapWriter(sFilePath string, nDate int, sSrcFil
 		return nil
 	}
 
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-	if nDays <= 16 { ////// Current Month
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays) { ////// Recent Trading Days
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { ////////////////////////// Not Current Month
 		if nDate/10000 < objToday.Year() { // Not Current Year
@@ -145,22 +134,7 @@ func (pSelf *Sznse_rzrq_by_date) GrapWriter(sFilePath string, nDate int, sSrcFil
 		}
 	}
 
-	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
-		return objHandles.TarWriter
-	} else {
-		var objCompressHandles CompressHandles
-
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
-			pSelf.mapFileHandle[sFile] = objCompressHandles
-
-			return pSelf.mapFileHandle[sFile].TarWriter
-		} else {
-			log.Println("[ERR] Sznse_rzrq_by_date.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
-		}
-
-	}
-
-	return nil
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
 }
 
 ///////////////////////// shsz_idx_by_date Lines ///////////////////////////////////////////
@@ -189,10 +163,7 @@ func (pSelf *Shsz_idx_by_date) GrapWriter(sFilePath string, nDate int, sSrcFile
 		return nil
 	}
 
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-	if nDays <= 16 { ////// Current Month
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays) { ////// Recent Trading Days
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { ////////////////////////// Not Current Month
 		if nDate/10000 < objToday.Year() { // Not Current Year
@@ -208,22 +179,7 @@ func (pSelf *Shsz_idx_by_date) GrapWriter(sFilePath string, nDate int, sSrcFile
 		}
 	}
 
-	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
-		return objHandles.TarWriter
-	} else {
-		var objCompressHandles CompressHandles
-
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
-			pSelf.mapFileHandle[sFile] = objCompressHandles
-
-			return pSelf.mapFileHandle[sFile].TarWriter
-		} else {
-			log.Println("[ERR] Shsz_idx_by_date.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
-		}
-
-	}
-
-	return nil
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
 }
 
 ///////////////////////// shsz_detail Lines ///////////////////////////////////////////
@@ -252,10 +208,7 @@ func (pSelf *Shsz_detail) GrapWriter(sFilePath string, nDate int, sSrcFile strin
 		return nil
 	}
 
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-	if nDays <= 16 { ////// Current Month
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays) { ////// Recent Trading Days
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { ////////////////////////// Not Current Month
 		if nDate/10000 < objToday.Year() { // Not Current Year
@@ -271,20 +224,5 @@ func (pSelf *Shsz_detail) GrapWriter(sFilePath string, nDate int, sSrcFile strin
 		}
 	}
 
-	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
-		return objHandles.TarWriter
-	} else {
-		var objCompressHandles CompressHandles
-
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
-			pSelf.mapFileHandle[sFile] = objCompressHandles
-
-			return pSelf.mapFileHandle[sFile].TarWriter
-		} else {
-			log.Println("[ERR] Shsz_detail.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
-		}
-
-	}
-
-	return nil
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
 }
@@ -15,19 +15,77 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-// Package Initialization
+// Package Initialization (register record formats of k-lines, 4 all markets)
 func init() {
+	registerMinuteBars("m5", 5, "MIN5/", 1, false, parseMinuteRecord, formatMinuteBar)
+	registerMinuteBars("m15", 15, "MIN15/", 1, false, parseMinuteRecord, formatMinuteBar)
+	registerMinuteBars("m30", 30, "MIN30/", 2, false, parseMinuteRecord, formatMinuteBar)
+	registerMinuteBars("m60", 60, "MIN60/", 3, true, parseMinuteCloseRecord, formatCompactMinuteBar)
+	registerMinuteBars("m120", 120, "MIN120/", 3, true, parseMinuteRecord, formatMinuteBar)
+	registerPeriodBars("w1", "WEEK/", weekOf)
+	registerPeriodBars("mn1", "MONTH/", monthOf)
+	RegisterRecordFormat(RecordFormat{DataType: "m1", DestPrefix: "MIN/MIN.", UseCodeRange: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &Minutes1RecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{DataType: "d1", DestPrefix: "DAY/DAY.", UseCodeRange: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &Day1RecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{DataType: "wt", DestPrefix: "WEIGHT/WEIGHT.", UseCodeRange: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &WeightRecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{DataType: "st", DestPrefix: "STATIC/STATIC.", UseCodeRange: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &StaticRecordIO{BaseRecordIO: objBase} }})
 }
 
-///////////////////////// 60Minutes Lines ///////////////////////////////////////////
-type Minutes60RecordIO struct {
+/**
+ * @brief		注册由1分钟线合成的n分钟线
+ * @param[in]	sDataType		数据类型 (如: m15)
+ * @param[in]	nPeriod			k线周期(分钟)
+ * @param[in]	sFolder			目标子目录 (如: MIN15/)
+ * @param[in]	nHistoryYears	只合成最近n年的数据
+ * @param[in]	bMergeByYear	往年的数据按年合并压缩
+ * @param[in]	fnParse			1分钟线记录的解析方法
+ * @param[in]	fnFormat		k线的输出格式
+ */
+func registerMinuteBars(sDataType string, nPeriod int, sFolder string, nHistoryYears int, bMergeByYear bool, fnParse func(sLine string) (KBar, bool), fnFormat func(refBar *KBar) string) {
+	RegisterRecordFormat(RecordFormat{DataType: sDataType, DestPrefix: sFolder + strings.TrimSuffix(sFolder, "/") + ".", UseCodeRange: true, NeedSessions: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO {
+			return &MinuteBarsRecordIO{BaseRecordIO: objBase, Period: nPeriod, Folder: sFolder, HistoryYears: nHistoryYears, MergeByYear: bMergeByYear, ParseRecord: fnParse, FormatBar: fnFormat}
+		}})
+}
+
+/**
+ * @brief		注册由日线合成的周线、月线
+ * @param[in]	sDataType		数据类型 (如: w1)
+ * @param[in]	sFolder			目标子目录 (如: WEEK/)
+ * @param[in]	fnPeriodOf		日期所属周期的键值
+ */
+func registerPeriodBars(sDataType string, sFolder string, fnPeriodOf func(nDate int) int) {
+	RegisterRecordFormat(RecordFormat{DataType: sDataType, DestPrefix: sFolder + strings.TrimSuffix(sFolder, "/") + ".", UseCodeRange: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO {
+			return &PeriodBarsRecordIO{Day1RecordIO: Day1RecordIO{BaseRecordIO: objBase}, Folder: sFolder, PeriodOf: fnPeriodOf}
+		}})
+}
+
+///////////////////////// N Minutes Lines (5/15/30/60/120) ////////////////////////
+/**
+ * @Class 		MinuteBarsRecordIO
+ * @brief		由1分钟线(MIN目录)合成的n分钟线，按市场的交易时段切分(k线不跨越交易时段)
+ * @note 		今天的数据在收盘后一段时间才参与合成(盘中的k线还未完成); 实时资源(LiveDate)包括盘中未完成的k线
+ * @author		barry
+ */
+type MinuteBarsRecordIO struct {
 	BaseRecordIO
+	Period       int                             // k线周期(分钟)
+	Folder       string                          // 目标子目录 (如: MIN15/)
+	HistoryYears int                             // 只合成最近n年的数据
+	MergeByYear  bool                            // 往年的数据按年合并压缩(同日线)，否则按半个月合并压缩
+	ParseRecord  func(sLine string) (KBar, bool) // 1分钟线记录的解析方法
+	FormatBar    func(refBar *KBar) string       // k线的输出格式
 }
 
-func (pSelf *Minutes60RecordIO) CodeInWhiteTable(sFileName string) bool {
+func (pSelf *MinuteBarsRecordIO) CodeInWhiteTable(sFileName string) bool {
 	if pSelf.CodeRangeFilter == nil {
 		return true
 	}
@@ -35,28 +93,37 @@ func (pSelf *Minutes60RecordIO) CodeInWhiteTable(sFileName string) bool {
 	nEnd := strings.LastIndexAny(sFileName, ".")
 	nFileYear, err := strconv.Atoi(sFileName[nEnd-4 : nEnd])
 	if nil != err {
-		log.Println("[ERR] Minutes1RecordIO.CodeInWhiteTable() : Year In FileName is not digital: ", sFileName, nFileYear)
+		log.Println("[ERR] MinuteBarsRecordIO.CodeInWhiteTable() : Year In FileName is not digital: ", sFileName, nFileYear)
 		return false
 	}
-	if time.Now().Year()-nFileYear >= 4 {
+	if time.Now().Year()-nFileYear > pSelf.HistoryYears {
 		return false
 	}
-	nBegin := strings.LastIndexAny(sFileName, "MIN")
-	nEnd = nEnd - 5
-	sCodeNum := sFileName[nBegin+1 : nEnd]
+	sCodeNum := codeOfFileName(sFileName, "MIN", 5)
 
 	return pSelf.CodeRangeFilter.CodeInRange(sCodeNum)
 }
 
-func (pSelf *Minutes60RecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile string) *tar.Writer {
+/**
+ * @brief		历史数据的起始日期(只合成最近n年的数据)
+ */
+func (pSelf *MinuteBarsRecordIO) HistoryBegin() int {
+	return dateOf(time.Now().AddDate(-pSelf.HistoryYears, 0, 0))
+}
+
+func (pSelf *MinuteBarsRecordIO) GenFilePath(sFileName string) string {
+	return strings.Replace(sFileName, "MIN/", pSelf.Folder, -1)
+}
+
+func (pSelf *MinuteBarsRecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile string) *tar.Writer {
+	if false == pSelf.MergeByYear {
+		return pSelf.BaseRecordIO.GrapWriter(sFilePath, nDate, sSrcFile)
+	}
+
 	var sFile string = ""
 	var objToday time.Time = time.Now()
 
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-
-	if nDays <= 17 { ////// Current Month
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays4KLine) { ////// Recent Trading Days
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { ////////////////////////// Not Current Month'
 		if nDate/10000 < objToday.Year() { // Not Current Year
@@ -72,26 +139,7 @@ func (pSelf *Minutes60RecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile
 		}
 	}
 
-	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
-		return objHandles.TarWriter
-	} else {
-		var objCompressHandles CompressHandles
-
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
-			pSelf.mapFileHandle[sFile] = objCompressHandles
-
-			return pSelf.mapFileHandle[sFile].TarWriter
-		} else {
-			log.Println("[ERR] Day1RecordIO.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
-		}
-
-	}
-
-	return nil
-}
-
-func (pSelf *Minutes60RecordIO) GenFilePath(sFileName string) string {
-	return strings.Replace(sFileName, "MIN/", "MIN60/", -1)
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
 }
 
 func TrimRZero( sFloatStr string ) string {
@@ -104,293 +152,62 @@ func TrimRZero( sFloatStr string ) string {
 	return sNewFloatStr
 }
 
-func (pSelf *Minutes60RecordIO) LoadFromFile(bytesData []byte) ([]byte, int, int) {
-	var err error
-	var nLastDate int = 0
-	var nOffset int = 0
+
+/**
+ * @brief		合成一个交易日的n分钟线
+ * @detail		记录按所属的交易日分组(期货夜盘的记录属于下一个交易日，见 TradingSessions.TradingDayOf())
+ * @return		k线数据 + 交易日 + 已处理的数据长度(下一个交易日的第一条记录，留给下一次调用)
+ */
+func (pSelf *MinuteBarsRecordIO) LoadFromFile(bytesData []byte) ([]byte, int, int) {
 	var nReturnDate int = -100
 	var objToday time.Time = time.Now()
-	var nToday int = objToday.Year()*10000 + int(objToday.Month())*100 + objToday.Day()
 	var nNowTime int = objToday.Hour()*10000 + objToday.Minute()*100 + objToday.Second()
-	var bLoadTodayData bool = false
-	var rstr string = ""
-	var lstPeriods = [4]int{103000, 130000, 140000, 150000}
-	var nLastIndex int = -1
-	var nCurIndex int = 0
-	var objMin60 struct {
-		Date         int     // date
-		Time         int     // time
-		Open         float64 // open price
-		High         float64 // high price
-		Low          float64 // low price
-		Close        float64 // close price
-		Settle       float64 // settle price
-		Amount       float64 // Amount
-		Volume       int64   // Volume
-		OpenInterest int64   // Open Interest
-		NumTrades    int64   // Trade Number
-		Voip         float64 // Voip
-	} // 60 minutes k-line
-
-	nLastOffset := 0
-	bSep := byte('\n')
-	nBytesLen := len(bytesData)
-	if nNowTime < 70101 || nNowTime >= 220010 { // exclude current data of today in working time
+	var nToday int = pSelf.Sessions.TradingDayOf(dateOf(objToday), nNowTime, pSelf.Holidays) // 当前的交易日
+	var nOldestDate int = pSelf.HistoryBegin()
+	var bLoadTodayData bool = pSelf.Sessions.IsDayClosed(nNowTime)        // exclude current data of today in working time
+	var objBars BarCalendar = pSelf.Sessions.NewBarCalendar(pSelf.Period) // 按市场交易时段切分的k线时间表
+	var objAggregator BarAggregator = BarAggregator{FormatBar: pSelf.FormatBar}
+
+	if 0 != pSelf.LiveDate { // live resource : include current data of today
 		bLoadTodayData = true
 	}
 
-	for nOffset = 0; nOffset < nBytesLen; nOffset++ {
-		if bytesData[nOffset] != bSep {
+	for nOffset := 0; nOffset < len(bytesData); {
+		bLine, nNextOffset := nextLine(bytesData, nOffset)
+		objRecord, bIsValid := pSelf.ParseRecord(string(bLine))
+		if false == bIsValid {
+			nOffset = nNextOffset
 			continue
 		}
 
-		lstRecords := strings.Split(string(bytesData[nLastOffset:nOffset]), ",")
-		nLastOffset = nOffset + 1
-		if len(lstRecords[0]) <= 0 {
-			continue
-		}
-
-		objMin60.Date, err = strconv.Atoi(lstRecords[0])
-		if err != nil {
-			continue
-		}
-
-		objRecordDate := time.Date(objMin60.Date/10000, time.Month(objMin60.Date%10000/100), objMin60.Date%100, 21, 6, 9, 0, time.Local)
-		subHours := objToday.Sub(objRecordDate)
-		nDays := subHours.Hours() / 24
-		if nDays > 366*3 {
-			continue
-		}
-
-		if nToday == objMin60.Date && false == bLoadTodayData {
+		nTradingDay := pSelf.Sessions.TradingDayOf(objRecord.Date, objRecord.Time, pSelf.Holidays) // 记录所属的交易日
+		if nTradingDay < nOldestDate || (nToday == nTradingDay && false == bLoadTodayData) {
+			nOffset = nNextOffset
 			continue
 		}
 
 		if -100 == nReturnDate {
-			nReturnDate = objMin60.Date
-		}
-
-		// cal. 60 minutes k-lines
-		nCurTime, _ := strconv.Atoi(lstRecords[1])
-		nClosePx, _ := strconv.ParseFloat(lstRecords[5], 64)
-		if 0 == nClosePx { // maybe it's a invalid record data ........................
-			continue
-		}
-		objMin60.Close = nClosePx
-		//objMin60.Settle, _ = strconv.ParseFloat(lstRecords[6], 64)
-		objMin60.Voip, _ = strconv.ParseFloat(lstRecords[11], 64)
-
-		nPeriodTime := 0
-		if nCurTime >= 63000 && nCurTime < 103000 {
-			nCurIndex = 0
-			nPeriodTime = 103000
-		} else if nCurTime >= 103000 && nCurTime <= 113000 {
-			nCurIndex = 1
-			nPeriodTime = 113000
-		} else if nCurTime > 113000 && nCurTime < 140000 {
-			nCurIndex = 2
-			nPeriodTime = 140000
-		} else if nCurTime >= 140000 && nCurTime <= 160000 {
-			nCurIndex = 3
-			nPeriodTime = 150000
-		} else {
-			continue
-		}
-
-		if nReturnDate != objMin60.Date {
-			rstr += fmt.Sprintf("%d,%d,%s,%s,%s,%s,,%s,%d,,%d,%s\n", nLastDate, objMin60.Time, TrimRZero(strconv.FormatFloat(objMin60.Open,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.High,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Low,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Close,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Amount,'f',4,64)), objMin60.Volume, objMin60.NumTrades, TrimRZero(strconv.FormatFloat(objMin60.Voip,'f',4,64)) )
-			return []byte(rstr), nReturnDate, nOffset
+			nReturnDate = nTradingDay
 		}
 
-		nLastDate = objMin60.Date
-		if nLastIndex != nCurIndex {
-			nLastIndex = nCurIndex
-
-			if 0 == objMin60.Time {
-				objMin60.Time = lstPeriods[0]
-				if nCurIndex > 0 {
-					objMin60.Time = lstPeriods[nCurIndex-1]
-				}
-			}
-
-			if nCurIndex > 0 {
-				rstr += fmt.Sprintf("%d,%d,%s,%s,%s,%s,,%s,%d,,%d,%s\n", nLastDate, objMin60.Time, TrimRZero(strconv.FormatFloat(objMin60.Open,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.High,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Low,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Close,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Amount,'f',4,64)), objMin60.Volume, objMin60.NumTrades, TrimRZero(strconv.FormatFloat(objMin60.Voip,'f',4,64)) )
-			}
-
-			objMin60.Time = nPeriodTime
-			objMin60.Open = objMin60.Close
-			objMin60.High = objMin60.Close
-			objMin60.Low = objMin60.Close
-			objMin60.Amount, _ = strconv.ParseFloat(lstRecords[7], 64)
-			objMin60.Volume, _ = strconv.ParseInt(lstRecords[8], 10, 64)
-			//objMin60.OpenInterest, _ = strconv.ParseInt(lstRecords[9], 10, 64)
-			objMin60.NumTrades, _ = strconv.ParseInt(lstRecords[10], 10, 64)
-		} else {
-			objMin60.Time = nPeriodTime
-			if objMin60.Close > objMin60.High {
-				objMin60.High = objMin60.Close
-			}
-
-			if objMin60.Close < objMin60.Low {
-				objMin60.Low = objMin60.Close
-			}
-
-			nAmount, _ := strconv.ParseFloat(lstRecords[7], 64)
-			objMin60.Amount += nAmount
-			nVolume, _ := strconv.ParseInt(lstRecords[8], 10, 64)
-			objMin60.Volume += nVolume
-			/*nOpenInterest, _ := strconv.ParseInt(lstRecords[9], 10, 64)
-			objMin60.OpenInterest += nOpenInterest*/
-			nNumTrades, _ := strconv.ParseInt(lstRecords[10], 10, 64)
-			objMin60.NumTrades += nNumTrades
+		if nReturnDate != nTradingDay { // 本行是下一个交易日的第一条记录
+			objAggregator.Flush()
+			return objAggregator.Bytes(), nReturnDate, nOffset
 		}
-	}
-
-	if objMin60.Time > 0 {
-		rstr += fmt.Sprintf("%d,%d,%s,%s,%s,%s,,%s,%d,,%d,%s\n", nLastDate, objMin60.Time, TrimRZero(strconv.FormatFloat(objMin60.Open,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.High,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Low,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Close,'f',4,64)), TrimRZero(strconv.FormatFloat(objMin60.Amount,'f',4,64)), objMin60.Volume, objMin60.NumTrades, TrimRZero(strconv.FormatFloat(objMin60.Voip,'f',4,64)) )
-	}
-
-	return []byte(rstr), nReturnDate, len(bytesData)
-}
-
-///////////////////////// 5Minutes Lines ///////////////////////////////////////////
-type Minutes5RecordIO struct {
-	BaseRecordIO
-}
 
-func (pSelf *Minutes5RecordIO) CodeInWhiteTable(sFileName string) bool {
-	if pSelf.CodeRangeFilter == nil {
-		return true
-	}
-
-	nEnd := strings.LastIndexAny(sFileName, ".")
-	nFileYear, err := strconv.Atoi(sFileName[nEnd-4 : nEnd])
-	if nil != err {
-		log.Println("[ERR] Minutes1RecordIO.CodeInWhiteTable() : Year In FileName is not digital: ", sFileName, nFileYear)
-		return false
-	}
-	if time.Now().Year()-nFileYear >= 2 {
-		return false
-	}
-	nBegin := strings.LastIndexAny(sFileName, "MIN")
-	nEnd = nEnd - 5
-	sCodeNum := sFileName[nBegin+1 : nEnd]
-
-	return pSelf.CodeRangeFilter.CodeInRange(sCodeNum)
-}
-
-func (pSelf *Minutes5RecordIO) GenFilePath(sFileName string) string {
-	return strings.Replace(sFileName, "MIN/", "MIN5/", -1)
-}
-
-func (pSelf *Minutes5RecordIO) LoadFromFile(bytesData []byte) ([]byte, int, int) {
-	var err error
-	var nOffset int = 0
-	var bLine []byte
-	var i int = 0
-	var nReturnDate int = -100
-	var objToday time.Time = time.Now()
-	var rstr string = ""
-	var objMin5 struct {
-		Date         int     // date
-		Time         int     // time
-		Open         float64 // open price
-		High         float64 // high price
-		Low          float64 // low price
-		Close        float64 // close price
-		Settle       float64 // settle price
-		Amount       float64 // Amount
-		Volume       int64   // Volume
-		OpenInterest int64   // Open Interest
-		NumTrades    int64   // Trade Number
-		Voip         float64 // Voip
-	} // 5 minutes k-line
-
-	bLines := bytes.Split(bytesData, []byte("\n"))
-	nCount := len(bLines)
-	for i, bLine = range bLines {
-		nOffset += (len(bLine) + 1)
-		lstRecords := strings.Split(string(bLine), ",")
-		if len(lstRecords[0]) <= 0 {
-			continue
-		}
-		objMin5.Date, err = strconv.Atoi(lstRecords[0])
-		if err != nil {
-			continue
-		}
-
-		objRecordDate := time.Date(objMin5.Date/10000, time.Month(objMin5.Date%10000/100), objMin5.Date%100, 21, 6, 9, 0, time.Local)
-		subHours := objToday.Sub(objRecordDate)
-		nDays := subHours.Hours() / 24
-		if nDays > 366 {
+		nOffset = nNextOffset
+		nBarIndex, nBarTime := objBars.BarOf(objRecord.Time) // 所属的k线(按交易时段切分)
+		if nBarIndex < 0 {
 			continue
 		}
 
-		if -100 == nReturnDate {
-			nReturnDate = objMin5.Date
-		}
-
-		if nReturnDate != objMin5.Date {
-			return []byte(rstr), nReturnDate, nOffset
-		}
-
-		// cal. 5 minutes k-lines
-		nCurTime, _ := strconv.Atoi(lstRecords[1])
-		nCurTime /= 100000
-		objMin5.Close, _ = strconv.ParseFloat(lstRecords[5], 64)
-		objMin5.Settle, _ = strconv.ParseFloat(lstRecords[6], 64)
-		objMin5.Voip, _ = strconv.ParseFloat(lstRecords[11], 64)
-
-		if objMin5.Time == 0 {
-			objMin5.Time = (nCurTime + 5) * 100
-			objMin5.Open, _ = strconv.ParseFloat(lstRecords[2], 64)
-			objMin5.High, _ = strconv.ParseFloat(lstRecords[3], 64)
-			objMin5.Low, _ = strconv.ParseFloat(lstRecords[4], 64)
-			objMin5.Amount, _ = strconv.ParseFloat(lstRecords[7], 64)
-			objMin5.Volume, _ = strconv.ParseInt(lstRecords[8], 10, 64)
-			objMin5.OpenInterest, _ = strconv.ParseInt(lstRecords[9], 10, 64)
-			objMin5.NumTrades, _ = strconv.ParseInt(lstRecords[10], 10, 64)
-			rstr += fmt.Sprintf("%d,%d,%f,%f,%f,%f,%f,%f,%d,%d,%d,%f\n", objMin5.Date, objMin5.Time, objMin5.Open, objMin5.High, objMin5.Low, objMin5.Close, objMin5.Settle, objMin5.Amount, objMin5.Volume, objMin5.OpenInterest, objMin5.NumTrades, objMin5.Voip)
-		}
-
-		if objMin5.Time <= nCurTime*100 { // begin
-			//if 0 != i {
-			rstr += fmt.Sprintf("%d,%d,%f,%f,%f,%f,%f,%f,%d,%d,%d,%f\n", objMin5.Date, objMin5.Time, objMin5.Open, objMin5.High, objMin5.Low, objMin5.Close, objMin5.Settle, objMin5.Amount, objMin5.Volume, objMin5.OpenInterest, objMin5.NumTrades, objMin5.Voip)
-			//}
-
-			objMin5.Time = (nCurTime + 5) * 100
-			objMin5.Open, _ = strconv.ParseFloat(lstRecords[2], 64)
-			objMin5.High, _ = strconv.ParseFloat(lstRecords[3], 64)
-			objMin5.Low, _ = strconv.ParseFloat(lstRecords[4], 64)
-			objMin5.Amount, _ = strconv.ParseFloat(lstRecords[7], 64)
-			objMin5.Volume, _ = strconv.ParseInt(lstRecords[8], 10, 64)
-			objMin5.OpenInterest, _ = strconv.ParseInt(lstRecords[9], 10, 64)
-			objMin5.NumTrades, _ = strconv.ParseInt(lstRecords[10], 10, 64)
-		} else {
-			nHigh, _ := strconv.ParseFloat(lstRecords[3], 64)
-			nLow, _ := strconv.ParseFloat(lstRecords[4], 64)
-			if nHigh > objMin5.High {
-				objMin5.High = nHigh
-			}
-			if nLow > objMin5.Low {
-				objMin5.Low = nLow
-			}
-			nAmount, _ := strconv.ParseFloat(lstRecords[7], 64)
-			objMin5.Amount += nAmount
-			nVolume, _ := strconv.ParseInt(lstRecords[8], 10, 64)
-			objMin5.Volume += nVolume
-			nOpenInterest, _ := strconv.ParseInt(lstRecords[9], 10, 64)
-			objMin5.OpenInterest += nOpenInterest
-			nNumTrades, _ := strconv.ParseInt(lstRecords[10], 10, 64)
-			objMin5.NumTrades += nNumTrades
-		}
-
-		if i == (nCount - 1) {
-			rstr += fmt.Sprintf("%d,%d,%f,%f,%f,%f,%f,%f,%d,%d,%d,%f\n", objMin5.Date, objMin5.Time, objMin5.Open, objMin5.High, objMin5.Low, objMin5.Close, objMin5.Settle, objMin5.Amount, objMin5.Volume, objMin5.OpenInterest, objMin5.NumTrades, objMin5.Voip)
-		}
+		objRecord.Date, objRecord.Time = objBars.EndDateOf(objRecord.Date, objRecord.Time, nBarTime), nBarTime
+		objAggregator.Add(nBarIndex, objRecord)
 	}
 
-	return []byte(rstr), nReturnDate, len(bytesData)
+	objAggregator.Flush()
+
+	return objAggregator.Bytes(), nReturnDate, len(bytesData)
 }
 
 ///////////////////////// 1Minutes Lines ///////////////////////////////////////////
@@ -412,9 +229,7 @@ func (pSelf *Minutes1RecordIO) CodeInWhiteTable(sFileName string) bool {
 	if time.Now().Year()-nFileYear >= 2 {
 		return false
 	}
-	nBegin := strings.LastIndexAny(sFileName, "MIN")
-	nEnd = nEnd - 5
-	sCodeNum := sFileName[nBegin+1 : nEnd]
+	sCodeNum := codeOfFileName(sFileName, "MIN", 5)
 
 	return pSelf.CodeRangeFilter.CodeInRange(sCodeNum)
 }
@@ -470,11 +285,7 @@ func (pSelf *Day1RecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile stri
 	var sFile string = ""
 	var objToday time.Time = time.Now()
 
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-
-	if nDays <= 17 { ////// Current Month
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays4KLine) { ////// Recent Trading Days
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { ////////////////////////// Not Current Month'
 		if nDate/10000 < objToday.Year() { // Not Current Year
@@ -491,22 +302,7 @@ func (pSelf *Day1RecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile stri
 
 	}
 
-	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
-		return objHandles.TarWriter
-	} else {
-		var objCompressHandles CompressHandles
-
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
-			pSelf.mapFileHandle[sFile] = objCompressHandles
-
-			return pSelf.mapFileHandle[sFile].TarWriter
-		} else {
-			log.Println("[ERR] Day1RecordIO.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
-		}
-
-	}
-
-	return nil
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
 }
 
 func (pSelf *Day1RecordIO) CodeInWhiteTable(sFileName string) bool {
@@ -514,9 +310,7 @@ func (pSelf *Day1RecordIO) CodeInWhiteTable(sFileName string) bool {
 		return true
 	}
 
-	nBegin := strings.LastIndexAny(sFileName, "DAY")
-	nEnd := strings.LastIndexAny(sFileName, ".")
-	sCodeNum := sFileName[nBegin+1 : nEnd]
+	sCodeNum := codeOfFileName(sFileName, "DAY", 0)
 
 	return pSelf.CodeRangeFilter.CodeInRange(sCodeNum)
 }
@@ -562,6 +356,82 @@ func (pSelf *Day1RecordIO) LoadFromFile(bytesData []byte) ([]byte, int, int) {
 	return []byte(rstr), nReturnDate, nBytesLen
 }
 
+///////////////////////// Week / Month Lines ///////////////////////////////////////////
+/**
+ * @Class 		PeriodBarsRecordIO
+ * @brief		由日线(DAY目录)合成的周线、月线
+ * @note 		只输出已经结束的周期(客户端是追加写盘的，未完成的周期每天都变，不能提前输出)
+ * @author		barry
+ */
+type PeriodBarsRecordIO struct {
+	Day1RecordIO
+	Folder         string              // 目标子目录 (如: WEEK/)
+	PeriodOf       func(nDate int) int // 日期所属周期的键值 (如: weekOf / monthOf)
+	nOpenPeriodKey int                 // 还可能有新数据的周期(下一个交易日所属的周期)
+	objOpenOnce    sync.Once           // nOpenPeriodKey 只计算一次(LoadFromFile 会被并行调用)
+}
+
+func (pSelf *PeriodBarsRecordIO) GenFilePath(sFileName string) string {
+	return strings.Replace(sFileName, "DAY/", pSelf.Folder, -1)
+}
+
+/**
+ * @brief		判断某周期是否已经结束(没有交易日会再产生该周期的日线)
+ * @note		今天的日线在收盘后一段时间才认为已经完整; 之后的交易日按市场的休市日历计算
+ */
+func (pSelf *PeriodBarsRecordIO) isPeriodClosed(nPeriodKey int) bool {
+	pSelf.objOpenOnce.Do(func() {
+		var objNow time.Time = time.Now()
+		var nCloseTime int = 150000
+
+		if len(pSelf.Sessions) > 0 {
+			nCloseTime = pSelf.Sessions[len(pSelf.Sessions)-1].End
+		}
+
+		objFrom := time.Date(objNow.Year(), objNow.Month(), objNow.Day(), nCloseTime/10000, nCloseTime/100%100, 0, 0, time.Local)
+		if objNow.After(objFrom.Add(time.Duration(nPostCloseMinutes) * time.Minute)) { // 今天的日线已经完整
+			objFrom = objFrom.AddDate(0, 0, 1)
+		}
+
+		pSelf.nOpenPeriodKey = pSelf.PeriodOf(pSelf.Holidays.NextTradingDay(objFrom))
+	})
+
+	return nPeriodKey < pSelf.nOpenPeriodKey
+}
+
+/**
+ * @brief		合成一个周期的k线
+ * @return		k线数据 + 日期(周期内最后一个交易日) + 已处理的数据长度(下一个周期的第一条记录，留给下一次调用)
+ */
+func (pSelf *PeriodBarsRecordIO) LoadFromFile(bytesData []byte) ([]byte, int, int) {
+	var objAggregator BarAggregator = BarAggregator{FormatBar: formatDayBar}
+
+	for nOffset := 0; nOffset < len(bytesData); {
+		bLine, nNextOffset := nextLine(bytesData, nOffset)
+		objRecord, bIsValid := parseDayRecord(string(bLine))
+		if false == bIsValid {
+			nOffset = nNextOffset
+			continue
+		}
+
+		nPeriodKey := pSelf.PeriodOf(objRecord.Date)
+		if objBar, nKey, bHasBar := objAggregator.Current(); true == bHasBar && nKey != nPeriodKey { // 本行是下一个周期的第一条记录
+			objAggregator.Flush()
+			return objAggregator.Bytes(), objBar.Date, nOffset
+		}
+
+		nOffset = nNextOffset
+		objAggregator.Add(nPeriodKey, objRecord)
+	}
+
+	if objBar, nKey, bHasBar := objAggregator.Current(); true == bHasBar && true == pSelf.isPeriodClosed(nKey) {
+		objAggregator.Flush()
+		return objAggregator.Bytes(), objBar.Date, len(bytesData)
+	}
+
+	return nil, -100, len(bytesData)
+}
+
 ///////////////////////// Weights Lines ///////////////////////////////////////////
 type WeightRecordIO struct {
 	BaseRecordIO
@@ -11,8 +11,18 @@ import (
 	"strings"
 )
 
-// Package Initialization
+// Package Initialization (register record formats of qianlong files)
 func init() {
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"qlfile"}, DataType: "column_dy_bk", DestPrefix: "dybk.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &DYColumnRecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"qlfile"}, DataType: "column_gn_bk", DestPrefix: "gnbk.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &GNColumnRecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"qlfile"}, DataType: "column_hy_bk", DestPrefix: "hybk.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &HYColumnRecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"qlfile"}, DataType: "column_zs_bk", DestPrefix: "zsbk.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &ZSColumnRecordIO{BaseRecordIO: objBase} }})
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"qlfile"}, DataType: "blockinfo_ini", DestPrefix: "blkinfo.", UseCodeRange: false,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &BlkInfoRecordIO{BaseRecordIO: objBase} }})
 }
 
 ///////////////////////// dy column ///////////////////////////////////////////
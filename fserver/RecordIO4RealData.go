@@ -13,8 +13,10 @@ import (
 	"time"
 )
 
-// Package Initialization
+// Package Initialization (register record formats of real data)
 func init() {
+	RegisterRecordFormat(RecordFormat{MkIDs: []string{"sse", "szse"}, DataType: "real_m1", DestPrefix: "MIN1_TODAY/MIN1_TODAY.", UseCodeRange: true,
+		NewRecordIO: func(objBase BaseRecordIO) I_Record_IO { return &RealMinutes1RecordIO{BaseRecordIO: objBase} }})
 }
 
 ///////////////////////// 1Minutes Lines ///////////////////////////////////////////
@@ -36,9 +38,7 @@ func (pSelf *RealMinutes1RecordIO) CodeInWhiteTable(sFileName string) bool {
 	if time.Now().Year() != nFileYear {
 		return false
 	}
-	nBegin := strings.LastIndexAny(sFileName, "MIN")
-	nEnd = nEnd - 5
-	sCodeNum := sFileName[nBegin+1 : nEnd]
+	sCodeNum := codeOfFileName(sFileName, "MIN", 5)
 
 	return pSelf.CodeRangeFilter.CodeInRange(sCodeNum)
 }
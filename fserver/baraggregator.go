@@ -0,0 +1,231 @@
+/**
+ * @brief		k线合成器
+ * @detail		由1分钟线合成任意周期的分钟线(5/15/30/60/120分钟，按市场的交易时段切分)，
+ 				由日线合成周线、月线; 各周期的k线共用同一个合成逻辑，周期只决定每条记录归属的k线(键值)
+ * @note		合成规则: 开盘价取第一条记录，最高/最低价取极值，收盘价/结算价/持仓量/均价取最后一条记录，成交额/成交量/成交笔数累加
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * @Class 		KBar
+ * @brief		一根k线(或一条源数据记录)
+ * @author		barry
+ */
+type KBar struct {
+	Date         int     // date
+	Time         int     // time (HHMMSS，日线/周线/月线为0)
+	Open         float64 // open price
+	High         float64 // high price
+	Low          float64 // low price
+	Close        float64 // close price
+	Settle       float64 // settle price
+	Amount       float64 // Amount
+	Volume       int64   // Volume
+	OpenInterest int64   // Open Interest
+	NumTrades    int64   // Trade Number
+	Voip         float64 // Voip
+}
+
+/**
+ * @brief		解析k线记录中的价格、成交等字段
+ * @param[in]	lstFields		open,high,low,close,settle,amount,volume,openinterest,numtrades,voip
+ */
+func (pSelf *KBar) parseFields(lstFields []string) bool {
+	pSelf.Open, _ = strconv.ParseFloat(lstFields[0], 64)
+	pSelf.High, _ = strconv.ParseFloat(lstFields[1], 64)
+	pSelf.Low, _ = strconv.ParseFloat(lstFields[2], 64)
+	pSelf.Close, _ = strconv.ParseFloat(lstFields[3], 64)
+	pSelf.Settle, _ = strconv.ParseFloat(lstFields[4], 64)
+	pSelf.Amount, _ = strconv.ParseFloat(lstFields[5], 64)
+	pSelf.Volume, _ = strconv.ParseInt(lstFields[6], 10, 64)
+	pSelf.OpenInterest, _ = strconv.ParseInt(lstFields[7], 10, 64)
+	pSelf.NumTrades, _ = strconv.ParseInt(lstFields[8], 10, 64)
+	pSelf.Voip, _ = strconv.ParseFloat(lstFields[9], 64)
+
+	return 0 != pSelf.Close // maybe it's a invalid record data ........................
+}
+
+/**
+ * @brief		解析1分钟线记录 (date,time,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip)
+ * @return		记录 + 是否有效
+ */
+func parseMinuteRecord(sLine string) (KBar, bool) {
+	var objRecord KBar
+	var err error
+
+	lstFields := strings.Split(strings.TrimSpace(sLine), ",")
+	if len(lstFields) < 12 {
+		return objRecord, false
+	}
+
+	if objRecord.Date, err = strconv.Atoi(lstFields[0]); nil != err {
+		return objRecord, false
+	}
+
+	if objRecord.Time, err = strconv.Atoi(lstFields[1]); nil != err {
+		return objRecord, false
+	}
+
+	return objRecord, objRecord.parseFields(lstFields[2:12])
+}
+
+/**
+ * @brief		解析1分钟线记录，开盘/最高/最低价都取收盘价
+ * @note		60分钟线的开盘/最高/最低价一直由各1分钟线的收盘价合成，保持不变(否则已发布的60分钟线文件全部改变)
+ * @return		记录 + 是否有效
+ */
+func parseMinuteCloseRecord(sLine string) (KBar, bool) {
+	objRecord, bIsValid := parseMinuteRecord(sLine)
+	objRecord.Open, objRecord.High, objRecord.Low = objRecord.Close, objRecord.Close, objRecord.Close
+
+	return objRecord, bIsValid
+}
+
+/**
+ * @brief		解析日线记录 (date,openpx,highpx,lowpx,closepx,settlepx,amount,volume,openinterest,numtrades,voip)
+ * @return		记录 + 是否有效
+ */
+func parseDayRecord(sLine string) (KBar, bool) {
+	var objRecord KBar
+	var err error
+
+	lstFields := strings.Split(strings.TrimSpace(sLine), ",")
+	if len(lstFields) < 11 {
+		return objRecord, false
+	}
+
+	if objRecord.Date, err = strconv.Atoi(lstFields[0]); nil != err {
+		return objRecord, false
+	}
+
+	return objRecord, objRecord.parseFields(lstFields[1:11])
+}
+
+/**
+ * @brief		分钟线的输出格式 (同1分钟线)
+ */
+func formatMinuteBar(refBar *KBar) string {
+	return fmt.Sprintf("%d,%d,%f,%f,%f,%f,%f,%f,%d,%d,%d,%f\n", refBar.Date, refBar.Time, refBar.Open, refBar.High, refBar.Low, refBar.Close, refBar.Settle, refBar.Amount, refBar.Volume, refBar.OpenInterest, refBar.NumTrades, refBar.Voip)
+}
+
+/**
+ * @brief		60分钟线的输出格式 (价格去掉尾部的0，不输出结算价和持仓量)
+ */
+func formatCompactMinuteBar(refBar *KBar) string {
+	return fmt.Sprintf("%d,%d,%s,%s,%s,%s,,%s,%d,,%d,%s\n", refBar.Date, refBar.Time, TrimRZero(strconv.FormatFloat(refBar.Open, 'f', 4, 64)), TrimRZero(strconv.FormatFloat(refBar.High, 'f', 4, 64)), TrimRZero(strconv.FormatFloat(refBar.Low, 'f', 4, 64)), TrimRZero(strconv.FormatFloat(refBar.Close, 'f', 4, 64)), TrimRZero(strconv.FormatFloat(refBar.Amount, 'f', 4, 64)), refBar.Volume, refBar.NumTrades, TrimRZero(strconv.FormatFloat(refBar.Voip, 'f', 4, 64)))
+}
+
+/**
+ * @brief		周线、月线的输出格式 (同日线)
+ */
+func formatDayBar(refBar *KBar) string {
+	return fmt.Sprintf("%d,%f,%f,%f,%f,%f,%f,%d,%d,%d,%f\n", refBar.Date, refBar.Open, refBar.High, refBar.Low, refBar.Close, refBar.Settle, refBar.Amount, refBar.Volume, refBar.OpenInterest, refBar.NumTrades, refBar.Voip)
+}
+
+/**
+ * @brief		周线的键值: 该周星期一的日期(yyyymmdd)
+ */
+func weekOf(nDate int) int {
+	objDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 12, 0, 0, 0, time.Local)
+	objDate = objDate.AddDate(0, 0, -((int(objDate.Weekday()) + 6) % 7))
+
+	return dateOf(objDate)
+}
+
+/**
+ * @brief		月线的键值: yyyymm
+ */
+func monthOf(nDate int) int {
+	return nDate / 100
+}
+
+/**
+ * @brief		从某位置开始取一行数据
+ * @return		行数据(不含换行符) + 下一行的开始位置
+ */
+func nextLine(bytesData []byte, nOffset int) ([]byte, int) {
+	nEnd := bytes.IndexByte(bytesData[nOffset:], '\n')
+	if nEnd < 0 {
+		return bytesData[nOffset:], len(bytesData)
+	}
+
+	return bytesData[nOffset : nOffset+nEnd], nOffset + nEnd + 1
+}
+
+/**
+ * @Class 		BarAggregator
+ * @brief		k线合成器: 按键值(k线序号/周/月)把连续的记录合成为k线，并按指定格式输出
+ * @author		barry
+ */
+type BarAggregator struct {
+	FormatBar func(refBar *KBar) string // k线的输出格式
+	objBar    KBar                      // 正在合成的k线
+	nKey      int                       // 正在合成的k线的键值
+	bHasBar   bool                      // 是否有正在合成的k线
+	objOutput bytes.Buffer              // 已经完成的k线(格式化后)
+}
+
+/**
+ * @brief		加入一条记录
+ * @param[in]	nKey			记录所属k线的键值 (与正在合成的k线不同时，先输出正在合成的k线)
+ * @param[in]	objRecord		记录 (Date/Time 已经是所属k线的日期/时间)
+ */
+func (pSelf *BarAggregator) Add(nKey int, objRecord KBar) {
+	if true == pSelf.bHasBar && nKey == pSelf.nKey {
+		pSelf.objBar.Date, pSelf.objBar.Time = objRecord.Date, objRecord.Time
+		if objRecord.High > pSelf.objBar.High {
+			pSelf.objBar.High = objRecord.High
+		}
+
+		if objRecord.Low < pSelf.objBar.Low {
+			pSelf.objBar.Low = objRecord.Low
+		}
+
+		pSelf.objBar.Close = objRecord.Close
+		pSelf.objBar.Settle = objRecord.Settle
+		pSelf.objBar.Amount += objRecord.Amount
+		pSelf.objBar.Volume += objRecord.Volume
+		pSelf.objBar.OpenInterest = objRecord.OpenInterest
+		pSelf.objBar.NumTrades += objRecord.NumTrades
+		pSelf.objBar.Voip = objRecord.Voip
+		return
+	}
+
+	pSelf.Flush()
+	pSelf.objBar, pSelf.nKey, pSelf.bHasBar = objRecord, nKey, true
+}
+
+/**
+ * @brief		输出正在合成的k线
+ */
+func (pSelf *BarAggregator) Flush() {
+	if true == pSelf.bHasBar {
+		pSelf.objOutput.WriteString(pSelf.FormatBar(&pSelf.objBar))
+		pSelf.bHasBar = false
+	}
+}
+
+/**
+ * @brief		正在合成的k线
+ * @return		k线 + 键值 + 是否有正在合成的k线
+ */
+func (pSelf *BarAggregator) Current() (KBar, int, bool) {
+	return pSelf.objBar, pSelf.nKey, pSelf.bHasBar
+}
+
+/**
+ * @brief		已经完成的k线(格式化后)
+ */
+func (pSelf *BarAggregator) Bytes() []byte {
+	return pSelf.objOutput.Bytes()
+}
@@ -0,0 +1,119 @@
+/**
+ * @brief		k线合成的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+ * @brief		按资源类型构造 提取+压缩 策略对象，并依次取出各次调用返回的数据
+ */
+func loadAllFromFile(t *testing.T, sResType string, bytesData []byte) ([]int, []string) {
+	var lstDates []int
+	var lstLines []string
+
+	objFormat, ok := LookupRecordFormat(sResType)
+	if false == ok {
+		t.Fatal("record format is not registered : ", sResType)
+	}
+
+	objRecordIO, _ := objFormat.createRecordIO(sResType, nil, &DataSourceConfig{MkID: "sse", Sessions: DefaultSessions})
+	for nIndex := 0; nIndex < len(bytesData); {
+		bytesBars, nDate, nOffset := objRecordIO.LoadFromFile(bytesData[nIndex:])
+		nIndex += nOffset
+		if nDate > 0 {
+			lstDates = append(lstDates, nDate)
+			lstLines = append(lstLines, strings.Split(strings.TrimSpace(string(bytesBars)), "\n")...)
+		}
+	}
+
+	return lstDates, lstLines
+}
+
+/**
+ * @brief		15/120分钟线按交易时段切分
+ */
+func TestMinuteBarsOfPeriods(t *testing.T) {
+	sDate := todayDateStr(-2)
+	bytesData := []byte(strings.Join([]string{
+		sDate + ",93100,10,11,9,10.5,0,100,10,0,1,0",
+		sDate + ",94500,10.5,12,10,11,0,100,10,0,1,0",
+		sDate + ",94600,11,11,8,9,0,100,10,0,1,0",
+		sDate + ",113000,9,9,9,9,0,100,10,0,1,0",
+		sDate + ",130100,9,10,9,10,0,100,10,0,1,0",
+	}, "\n") + "\n")
+
+	lstDates, lstLines := loadAllFromFile(t, "sse.m15", bytesData)
+	if 1 != len(lstDates) || 4 != len(lstLines) {
+		t.Fatalf("unexpected 15 minutes lines : %v, %v", lstDates, lstLines)
+	}
+
+	if false == strings.HasPrefix(lstLines[0], sDate+",94500,10.000000,11.000000,9.000000,10.500000,0.000000,100.000000,10,") ||
+		false == strings.HasPrefix(lstLines[1], sDate+",100000,10.500000,12.000000,8.000000,9.000000,0.000000,200.000000,20,") ||
+		false == strings.HasPrefix(lstLines[2], sDate+",113000,9.") || false == strings.HasPrefix(lstLines[3], sDate+",131500,") {
+		t.Errorf("unexpected 15 minutes lines : %v", lstLines)
+	}
+
+	// 120分钟线: 上午一根(11:30)，下午一根(15:00)
+	if _, lstLines = loadAllFromFile(t, "sse.m120", bytesData); 2 != len(lstLines) ||
+		false == strings.HasPrefix(lstLines[0], sDate+",113000,10.000000,12.000000,8.000000,9.000000,") || false == strings.HasPrefix(lstLines[1], sDate+",150000,") {
+		t.Errorf("unexpected 120 minutes lines : %v", lstLines)
+	}
+}
+
+/**
+ * @brief		60分钟线的开盘/最高/最低价由各1分钟线的收盘价合成，输出格式不变
+ */
+func TestMinute60BarsFromCloses(t *testing.T) {
+	sDate := todayDateStr(-2)
+	bytesData := []byte(strings.Join([]string{
+		sDate + ",93100,10,11,9,10.5,0,100,10,0,1,0",
+		sDate + ",94500,10.5,12,10,11,0,100,10,0,1,0",
+		sDate + ",94600,11,11,8,9,0,100,10,0,1,0",
+		sDate + ",113000,9,9,9,9,0,100,10,0,1,0",
+		sDate + ",130100,9,10,9,10,0,100,10,0,1,0.25",
+		sDate + ",130200,10,10,10,0,0,100,10,0,1,0", // 无效记录(收盘价为0)
+	}, "\n") + "\n")
+
+	lstExpect := []string{
+		sDate + ",103000,10.5,11.0,9.0,9.0,,300.0,30,,3,0.0",
+		sDate + ",113000,9.0,9.0,9.0,9.0,,100.0,10,,1,0.0",
+		sDate + ",140000,10.0,10.0,10.0,10.0,,100.0,10,,1,0.25",
+	}
+
+	if _, lstLines := loadAllFromFile(t, "sse.m60", bytesData); strings.Join(lstExpect, "\n") != strings.Join(lstLines, "\n") {
+		t.Errorf("unexpected 60 minutes lines : %v", lstLines)
+	}
+}
+
+/**
+ * @brief		周线、月线由日线合成，只输出已经结束的周期
+ */
+func TestPeriodBarsFromDayLines(t *testing.T) {
+	bytesData := []byte(strings.Join([]string{
+		"20180102,10,11,9,10.5,0,100,10,0,1,0",
+		"20180105,10.5,12,10,11,0,100,10,0,1,0",
+		"20180108,11,11,8,9,0,100,10,0,1,0",
+		"20180201,9,9,9,9,0,100,10,0,1,0",
+		"20991231,9,10,9,10,0,100,10,0,1,0", // 尚未结束的周期
+	}, "\n") + "\n")
+
+	lstDates, lstLines := loadAllFromFile(t, "sse.w1", bytesData)
+	if 3 != len(lstDates) || 20180105 != lstDates[0] || 20180108 != lstDates[1] || 20180201 != lstDates[2] {
+		t.Fatalf("unexpected week lines : %v, %v", lstDates, lstLines)
+	}
+
+	if "20180105,10.000000,12.000000,9.000000,11.000000,0.000000,200.000000,20,0,2,0.000000" != lstLines[0] {
+		t.Errorf("unexpected week line : %s", lstLines[0])
+	}
+
+	if lstDates, lstLines = loadAllFromFile(t, "sse.mn1", bytesData); 2 != len(lstDates) || 20180108 != lstDates[0] ||
+		"20180108,10.000000,12.000000,8.000000,9.000000,0.000000,300.000000,30,0,3,0.000000" != lstLines[0] {
+		t.Errorf("unexpected month lines : %v, %v", lstDates, lstLines)
+	}
+}
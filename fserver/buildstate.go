@@ -0,0 +1,392 @@
+/**
+ * @brief		增量压缩的构建状态
+ * @detail		每个资源类型保存一份构建状态(<StateFolder>/<资源类型>.json): 每个目标压缩文件由哪些源文件生成(源文件的长度+修改时间)，及压缩文件的摘要;
+ 				重新压缩时，只重新生成输入有变化的压缩文件，输入没有变化的压缩文件不重写(MD5/UPDATE不变，客户端也不用重新下载)
+ * @note		数据的合成结果与日期有关，以下压缩文件即使输入没有变化，也要重新生成:
+ 				1) 含有近期数据的压缩文件 (近期数据一天一个压缩文件，随日期推移并入 半月/年 压缩文件)
+ 				2) 跨年后的所有压缩文件 (往年的 半月压缩文件 并入年压缩文件)
+ 				3) 含有早于历史数据起始日期的压缩文件 (如: 60分钟线只保留最近3年)
+ 				另外，上次构建前一段时间内修改过的源文件也视为有变化(上次构建时，尚未收盘/尚未结束的周期 还没有输出)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	nBuildStateVersion int = 1 // 构建状态文件的格式版本(版本不同时，全量重新压缩)
+)
+
+var (
+	sBuildStateFolder string        = "./buildstate/" // 历史资源的构建状态存放目录(同 ./status.dat，在工作目录下)
+	nSourceSettleTime time.Duration = time.Hour * 24  // 上次构建前这段时间内修改过的源文件，视为有变化
+)
+
+/**
+ * @Class 		SourceFile
+ * @brief		数据源目录中的一个待压缩的源文件
+ * @author		barry
+ */
+type SourceFile struct {
+	Path          string      // 源文件全路径
+	RecursivePath string      // 源文件在数据源目录中的递归路径(压缩包中的文件名)
+	Info          os.FileInfo // 源文件信息
+}
+
+/**
+ * @Class 		SourceStamp
+ * @brief		源文件的长度+修改时间(判断源文件是否有变化)
+ * @author		barry
+ */
+type SourceStamp struct {
+	Size    int64 `json:"size"`  // 文件长度
+	ModTime int64 `json:"mtime"` // 修改时间(UnixNano)
+}
+
+/**
+ * @Class 		ArchiveState
+ * @brief		一个目标压缩文件的构建状态
+ * @author		barry
+ */
+type ArchiveState struct {
+	Res        ResDownload     `json:"res"`       // 资源描述项(md5/sha256/长度/生成时间)
+	ModTime    int64           `json:"mtime"`     // 压缩文件的修改时间(UnixNano，判断压缩文件是否被改动过)
+	Sources    []string        `json:"sources"`   // 生成该压缩文件的源文件
+	FirstDate  int             `json:"firstdate"` // 压缩文件中数据的最早日期
+	LastDate   int             `json:"lastdate"`  // 压缩文件中数据的最晚日期
+	mapSources map[string]bool // Sources 的查找表(加载源文件时，每段数据都要查一次)
+}
+
+/**
+ * @Class 		BuildState
+ * @brief		某资源类型的构建状态(存盘格式)
+ * @author		barry
+ */
+type BuildState struct {
+	Version   int                      `json:"version"`   // 格式版本
+	SrcFolder string                   `json:"srcfolder"` // 数据源目录
+	DestFile  string                   `json:"destfile"`  // 目标文件路径和前缀
+	BuildTime int64                    `json:"buildtime"` // 构建开始时间(Unix)
+	Sources   map[string]SourceStamp   `json:"sources"`   // 源文件 -> 长度+修改时间
+	Archives  map[string]*ArchiveState `json:"archives"`  // 压缩文件路径 -> 构建状态
+}
+
+/**
+ * @Class 		IncrementalBuild
+ * @brief		一次(增量)压缩的过程状态
+ * @detail		1) Begin(): 比较源文件和上次的构建状态，找出有变化的源文件，以及需要重新生成的压缩文件
+ 				2) 按 TakePending() 依次加载源文件; 写压缩文件前调用 NeedWrite()，输入没有变化的压缩文件不重写
+ 				   (有变化的源文件写入某个压缩文件时，该压缩文件要重新生成，它的其它源文件也要重新加载)
+ 				3) Finish(): 合并 重新生成的 和 没有变化的 压缩文件，并保存新的构建状态
+ * @note		没有构建状态文件时(sStateFile为空/文件不存在/格式不符)，即为全量压缩;
+ 				构建状态中的压缩文件路径总是发布后的路径: 没有变化的压缩文件比较发布目录中的文件，
+ 				重新生成的压缩文件取暂存目录中的文件信息(发布时改名，长度+修改时间不变)
+ * @author		barry
+ */
+type IncrementalBuild struct {
+	sStateFile     string                     // 构建状态文件路径(为空时不存盘)
+	refHolidays    *HolidayCalendar           // 市场的休市日历(近期数据的判断)
+	sTargetFolder  string                     // 压缩文件的发布目录(资源URI的根目录)
+	sStagingFolder string                     // 重新生成的压缩文件的暂存目录(为空时，直接写入发布目录)
+	objOld         BuildState                 // 上次的构建状态
+	objNew         BuildState                 // 本次的构建状态
+	mapChanged     map[string]bool            // 有变化的源文件(含新增的源文件)
+	mapDirty       map[string]bool            // 需要重新生成的压缩文件
+	mapPending     map[string]bool            // 等待(重新)加载的源文件
+	mapFed         map[string]map[string]bool // 源文件 -> 已经写过的压缩文件(已完成的加载中)
+	mapPass        map[string]bool            // 当前加载的源文件，本次写过的压缩文件
+}
+
+/**
+ * @brief		创建一次压缩的过程状态，并加载上次的构建状态
+ * @param[in]	sStateFile		构建状态文件路径(为空时，即为全量压缩)
+ * @param[in]	refHolidays		市场的休市日历
+ */
+func NewIncrementalBuild(sStateFile string, refHolidays *HolidayCalendar) *IncrementalBuild {
+	objBuild := &IncrementalBuild{sStateFile: sStateFile, refHolidays: refHolidays}
+	if "" == sStateFile {
+		return objBuild
+	}
+
+	if bytesData, err := ioutil.ReadFile(sStateFile); nil == err {
+		if err = json.Unmarshal(bytesData, &objBuild.objOld); nil != err {
+			log.Println("[WARN] NewIncrementalBuild() : invalid build state, rebuild all :", sStateFile, err.Error())
+			objBuild.objOld = BuildState{}
+		}
+	}
+
+	return objBuild
+}
+
+/**
+ * @brief		设置重新生成的压缩文件的暂存目录
+ * @param[in]	sTargetFolder	压缩文件的发布目录(资源URI的根目录)
+ * @param[in]	sStagingFolder	暂存目录(目录结构同发布目录，为空时直接写入发布目录)
+ */
+func (pSelf *IncrementalBuild) SetStaging(sTargetFolder string, sStagingFolder string) {
+	pSelf.sTargetFolder = sTargetFolder
+	pSelf.sStagingFolder = sStagingFolder
+}
+
+/**
+ * @brief		压缩文件在暂存目录中的路径(写盘用; 资源URI仍为发布后的路径)
+ * @param[in]	sArchive		压缩文件发布后的路径
+ */
+func (pSelf *IncrementalBuild) StagingPath(sArchive string) string {
+	if "" == pSelf.sStagingFolder {
+		return sArchive
+	}
+
+	sRelPath, err := filepath.Rel(pSelf.sTargetFolder, sArchive)
+	if nil != err {
+		return sArchive
+	}
+
+	return filepath.ToSlash(filepath.Join(pSelf.sStagingFolder, sRelPath))
+}
+
+/**
+ * @brief		开始压缩: 找出有变化的源文件，以及需要重新生成的压缩文件
+ * @param[in]	sDestFile		目标文件路径和前缀
+ * @param[in]	sSrcFolder		数据源目录
+ * @param[in]	lstSources		数据源目录中的(通过过滤的)源文件
+ * @param[in]	nHistoryBegin	历史数据的起始日期(早于该日期的数据不再压缩，0表示不限)
+ */
+func (pSelf *IncrementalBuild) Begin(sDestFile string, sSrcFolder string, lstSources []SourceFile, nHistoryBegin int) {
+	var objNow time.Time = time.Now()
+	var nRecentBegin int = 0 // 上次构建时，近期数据的起始日期
+
+	pSelf.mapChanged = make(map[string]bool)
+	pSelf.mapDirty = make(map[string]bool)
+	pSelf.mapPending = make(map[string]bool)
+	pSelf.mapFed = make(map[string]map[string]bool)
+	pSelf.objNew = BuildState{Version: nBuildStateVersion, SrcFolder: sSrcFolder, DestFile: sDestFile, BuildTime: objNow.Unix(), Sources: make(map[string]SourceStamp), Archives: make(map[string]*ArchiveState)}
+	if nBuildStateVersion != pSelf.objOld.Version || sSrcFolder != pSelf.objOld.SrcFolder || sDestFile != pSelf.objOld.DestFile {
+		pSelf.objOld = BuildState{}
+	}
+
+	objOldBuildTime := time.Unix(pSelf.objOld.BuildTime, 0)
+	for _, objSrc := range lstSources {
+		objStamp := SourceStamp{Size: objSrc.Info.Size(), ModTime: objSrc.Info.ModTime().UnixNano()}
+		objOldStamp, ok := pSelf.objOld.Sources[objSrc.Path]
+		pSelf.objNew.Sources[objSrc.Path] = objStamp
+		if false == ok || objOldStamp != objStamp || false == objSrc.Info.ModTime().Before(objOldBuildTime.Add(-nSourceSettleTime)) {
+			pSelf.mapChanged[objSrc.Path] = true
+			pSelf.mapPending[objSrc.Path] = true
+		}
+	}
+
+	if len(pSelf.objOld.Archives) > 0 {
+		nRecentBegin = pSelf.refHolidays.NthTradingDayBack(objOldBuildTime, nRecentTradingDays4KLine)
+	}
+
+	for sArchive, refArchive := range pSelf.objOld.Archives {
+		bIsDirty := objOldBuildTime.Year() != objNow.Year() || refArchive.LastDate >= nRecentBegin || refArchive.FirstDate < nHistoryBegin
+		if objFileInfo, err := os.Stat(sArchive); nil != err || objFileInfo.Size() != refArchive.Res.SIZE || objFileInfo.ModTime().UnixNano() != refArchive.ModTime {
+			bIsDirty = true
+		}
+
+		for _, sSrcFile := range refArchive.Sources {
+			if _, ok := pSelf.objNew.Sources[sSrcFile]; false == ok || true == pSelf.mapChanged[sSrcFile] {
+				bIsDirty = true
+			}
+		}
+
+		if true == bIsDirty {
+			pSelf.markDirty(sArchive, "")
+		}
+	}
+
+	log.Printf("[INF] IncrementalBuild.Begin() : %s, sources = %d, changed = %d, archives = %d, rebuild = %d", sDestFile, len(lstSources), len(pSelf.mapChanged), len(pSelf.objOld.Archives), len(pSelf.mapDirty))
+}
+
+/**
+ * @brief		判断源文件是否在等待(重新)加载(用于预取，不取出)
+ */
+func (pSelf *IncrementalBuild) IsPending(sSrcFile string) bool {
+	return pSelf.mapPending[sSrcFile]
+}
+
+/**
+ * @brief		取出一个等待(重新)加载的源文件
+ * @return		true			需要加载(调用者加载完成后，调用 EndSource())
+ 				false			不需要加载
+ */
+func (pSelf *IncrementalBuild) TakePending(sSrcFile string) bool {
+	if false == pSelf.mapPending[sSrcFile] {
+		return false
+	}
+
+	delete(pSelf.mapPending, sSrcFile)
+	pSelf.mapPass = make(map[string]bool)
+
+	return true
+}
+
+/**
+ * @brief		源文件加载完成
+ */
+func (pSelf *IncrementalBuild) EndSource(sSrcFile string) {
+	if nil == pSelf.mapFed[sSrcFile] {
+		pSelf.mapFed[sSrcFile] = make(map[string]bool)
+	}
+
+	for sArchive := range pSelf.mapPass {
+		pSelf.mapFed[sSrcFile][sArchive] = true
+	}
+}
+
+/**
+ * @brief		判断源文件的一段数据是否需要写入压缩文件
+ * @param[in]	sArchive		目标压缩文件路径
+ * @param[in]	nDate			数据日期
+ * @param[in]	sSrcFile		源文件路径
+ * @return		true			写入(压缩文件需要重新生成)
+ 				false			跳过(压缩文件的输入没有变化，或已经写过该源文件的数据)
+ */
+func (pSelf *IncrementalBuild) NeedWrite(sArchive string, nDate int, sSrcFile string) bool {
+	if true == pSelf.mapFed[sSrcFile][sArchive] {
+		return false
+	}
+
+	if false == pSelf.mapDirty[sArchive] {
+		if refArchive, ok := pSelf.objOld.Archives[sArchive]; ok && false == pSelf.mapChanged[sSrcFile] && refArchive.hasSource(sSrcFile) {
+			return false
+		}
+
+		pSelf.markDirty(sArchive, sSrcFile)
+	}
+
+	refArchive, ok := pSelf.objNew.Archives[sArchive]
+	if false == ok {
+		refArchive = &ArchiveState{FirstDate: nDate, LastDate: nDate}
+		pSelf.objNew.Archives[sArchive] = refArchive
+	}
+
+	if 0 == len(refArchive.Sources) || sSrcFile != refArchive.Sources[len(refArchive.Sources)-1] {
+		refArchive.Sources = append(refArchive.Sources, sSrcFile)
+	}
+
+	if nDate < refArchive.FirstDate {
+		refArchive.FirstDate = nDate
+	}
+
+	if nDate > refArchive.LastDate {
+		refArchive.LastDate = nDate
+	}
+
+	pSelf.mapPass[sArchive] = true
+
+	return true
+}
+
+/**
+ * @brief		完成压缩: 合并 重新生成的 和 没有变化的 压缩文件，并保存新的构建状态
+ * @param[in]	lstRes			重新生成的压缩文件(Release()的返回)
+ * @return		按时间顺序的全部压缩文件
+ */
+func (pSelf *IncrementalBuild) Finish(lstRes []ResDownload) []ResDownload {
+	var mapRes map[string]ResDownload = make(map[string]ResDownload)
+	var lstSortKeys []string
+	var lstAllRes []ResDownload
+
+	for _, objRes := range lstRes {
+		if refArchive, ok := pSelf.objNew.Archives[objRes.URI]; ok {
+			refArchive.Res = objRes
+			if objFileInfo, err := os.Stat(pSelf.StagingPath(objRes.URI)); nil == err {
+				refArchive.ModTime = objFileInfo.ModTime().UnixNano()
+			}
+		}
+
+		mapRes[objRes.URI] = objRes
+	}
+
+	for sArchive, refArchive := range pSelf.objOld.Archives {
+		if false == pSelf.mapDirty[sArchive] {
+			pSelf.objNew.Archives[sArchive] = refArchive
+			mapRes[sArchive] = refArchive.Res
+		}
+	}
+
+	for sArchive, refArchive := range pSelf.objNew.Archives {
+		if _, ok := mapRes[sArchive]; false == ok || "" == refArchive.Res.URI { // 写盘失败的压缩文件，下次重新生成
+			delete(pSelf.objNew.Archives, sArchive)
+		}
+	}
+
+	for sArchive := range mapRes {
+		lstSortKeys = append(lstSortKeys, sArchive)
+	}
+
+	sort.Strings(lstSortKeys)
+	for _, sArchive := range lstSortKeys {
+		lstAllRes = append(lstAllRes, mapRes[sArchive])
+	}
+
+	log.Printf("[INF] IncrementalBuild.Finish() : %s, rebuilt = %d, unchanged = %d", pSelf.objNew.DestFile, len(lstRes), len(lstAllRes)-len(lstRes))
+	pSelf.save()
+
+	return lstAllRes
+}
+
+/**
+ * @brief		标记压缩文件需要重新生成: 生成它的其它源文件也要重新加载
+ * @param[in]	sArchive		压缩文件路径
+ * @param[in]	sCurSrcFile		正在加载的源文件(不用重新加载)
+ */
+func (pSelf *IncrementalBuild) markDirty(sArchive string, sCurSrcFile string) {
+	pSelf.mapDirty[sArchive] = true
+	if refArchive, ok := pSelf.objOld.Archives[sArchive]; ok {
+		for _, sSrcFile := range refArchive.Sources {
+			if _, ok := pSelf.objNew.Sources[sSrcFile]; ok && sSrcFile != sCurSrcFile && false == pSelf.mapFed[sSrcFile][sArchive] {
+				pSelf.mapPending[sSrcFile] = true
+			}
+		}
+	}
+}
+
+/**
+ * @brief		保存构建状态(先写临时文件，再改名，避免中途退出时留下不完整的状态文件)
+ */
+func (pSelf *IncrementalBuild) save() {
+	if "" == pSelf.sStateFile {
+		return
+	}
+
+	bytesData, err := json.Marshal(&pSelf.objNew)
+	if nil == err {
+		if err = os.MkdirAll(filepath.Dir(pSelf.sStateFile), 0755); nil == err {
+			if err = ioutil.WriteFile(pSelf.sStateFile+".tmp", bytesData, 0644); nil == err {
+				err = os.Rename(pSelf.sStateFile+".tmp", pSelf.sStateFile)
+			}
+		}
+	}
+
+	if nil != err {
+		log.Println("[WARN] IncrementalBuild.save() : cannot save build state, rebuild all next time :", pSelf.sStateFile, err.Error())
+		os.Remove(pSelf.sStateFile)
+	}
+}
+
+/**
+ * @brief		判断压缩文件是否由某源文件生成
+ */
+func (pSelf *ArchiveState) hasSource(sSrcFile string) bool {
+	if nil == pSelf.mapSources {
+		pSelf.mapSources = make(map[string]bool, len(pSelf.Sources))
+		for _, sSource := range pSelf.Sources {
+			pSelf.mapSources[sSource] = true
+		}
+	}
+
+	return pSelf.mapSources[sSrcFile]
+}
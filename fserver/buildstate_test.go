@@ -0,0 +1,161 @@
+/**
+ * @brief		增量压缩的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"archive/tar"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		写一个源文件，修改时间设为几天前(避开"上次构建前一天内修改过"的规则)
+ */
+func writeOldSourceFile(t *testing.T, sFile string, sContent string, nDaysAgo int) {
+	objFile, err := os.OpenFile(sFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	objFile.WriteString(sContent)
+	objFile.Close()
+	objModTime := time.Now().AddDate(0, 0, -nDaysAgo)
+	os.Chtimes(sFile, objModTime, objModTime)
+}
+
+/**
+ * @brief		压缩日线，返回 压缩文件路径 -> 资源描述项
+ */
+func compressDayLines(t *testing.T) map[string]ResDownload {
+	objCompressor := Compressor{TargetFolder: "./SyncFolder/", StateFolder: "./buildstate/"}
+	lstRes, bIsOk := objCompressor.XCompress("sse.d1", &DataSourceConfig{MkID: "sse", Folder: "./DAY/"}, nil)
+	if false == bIsOk {
+		t.Fatal("cannot compress day lines")
+	}
+
+	mapRes := make(map[string]ResDownload)
+	for _, objRes := range lstRes {
+		mapRes[objRes.URI] = objRes
+	}
+
+	return mapRes
+}
+
+/**
+ * @brief		压缩文件的修改时间
+ */
+func archiveModTime(t *testing.T, sFile string) time.Time {
+	objFileInfo, err := os.Stat(sFile)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return objFileInfo.ModTime()
+}
+
+/**
+ * @brief		输入没有变化的压缩文件不重写; 源文件有变化/新增源文件时，只重新生成相关的压缩文件
+ */
+func TestIncrementalCompression(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sArchive2016, sArchive2017 := "SyncFolder/SSE/DAY/DAY.20160000", "SyncFolder/SSE/DAY/DAY.20170000"
+	os.MkdirAll("./DAY/", 0755)
+	writeOldSourceFile(t, "./DAY/600000.csv", "20160104,10,11,9,10.5,0,100,10,0,1,0\n20160105,10.5,12,10,11,0,100,10,0,1,0\n", 5)
+	writeOldSourceFile(t, "./DAY/600001.csv", "20170103,10,11,9,10.5,0,100,10,0,1,0\n", 5)
+	mapRes := compressDayLines(t)
+	if 2 != len(mapRes) || "" == mapRes[sArchive2016].MD5 || "" == mapRes[sArchive2017].MD5 {
+		t.Fatalf("unexpected resources : %+v", mapRes)
+	}
+
+	// 源文件没有变化: 压缩文件不重写，资源描述项不变
+	objModTime2016, objModTime2017 := archiveModTime(t, sArchive2016), archiveModTime(t, sArchive2017)
+	time.Sleep(time.Millisecond * 20)
+	if mapNewRes := compressDayLines(t); mapNewRes[sArchive2016] != mapRes[sArchive2016] || mapNewRes[sArchive2017] != mapRes[sArchive2017] ||
+		false == objModTime2016.Equal(archiveModTime(t, sArchive2016)) || false == objModTime2017.Equal(archiveModTime(t, sArchive2017)) {
+		t.Fatalf("unchanged archives should not be rebuilt : %+v", mapNewRes)
+	}
+
+	// 600001.csv 有变化: 只重新生成2017年的压缩文件
+	writeOldSourceFile(t, "./DAY/600001.csv", "20170104,10.5,12,10,11,0,100,10,0,1,0\n", 4)
+	mapNewRes := compressDayLines(t)
+	if mapNewRes[sArchive2016] != mapRes[sArchive2016] || false == objModTime2016.Equal(archiveModTime(t, sArchive2016)) || mapNewRes[sArchive2017].MD5 == mapRes[sArchive2017].MD5 {
+		t.Fatalf("only the archive of 2017 should be rebuilt : %+v", mapNewRes)
+	}
+
+	// 新增源文件 600002.csv(2016年的数据): 重新生成2016年的压缩文件，其中包含 600000.csv 和 600002.csv 的数据
+	writeOldSourceFile(t, "./DAY/600002.csv", "20160104,10,11,9,10.5,0,100,10,0,1,0\n", 4)
+	if mapRes, mapNewRes = mapNewRes, compressDayLines(t); mapNewRes[sArchive2017] != mapRes[sArchive2017] || mapNewRes[sArchive2016].MD5 == mapRes[sArchive2016].MD5 {
+		t.Fatalf("only the archive of 2016 should be rebuilt : %+v", mapNewRes)
+	}
+
+	objFile, err := os.Open(sArchive2016)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	defer objFile.Close()
+	objZlibReader, err := zlib.NewReader(objFile)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	mapEntries := make(map[string]int)
+	for objTarReader := tar.NewReader(objZlibReader); ; {
+		objHeader, err := objTarReader.Next()
+		if io.EOF == err {
+			break
+		} else if nil != err {
+			t.Fatal(err)
+		}
+
+		mapEntries[objHeader.Name]++
+	}
+
+	if 2 != mapEntries["DAY/600000.csv"] || 1 != mapEntries["DAY/600002.csv"] || 2 != len(mapEntries) {
+		t.Errorf("unexpected entries of rebuilt archive : %v", mapEntries)
+	}
+}
+
+/**
+ * @brief		有源文件加载失败时，压缩失败且不保存构建状态; 源文件恢复后(即使没有再修改)，重新生成相关的压缩文件
+ */
+func TestFailedBuildIsNotSaved(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sArchive2016, sStateFile := "SyncFolder/SSE/DAY/DAY.20160000", "./buildstate/sse.d1.json"
+	os.MkdirAll("./DAY/", 0755)
+	writeOldSourceFile(t, "./DAY/600000.csv", "20160104,10,11,9,10.5,0,100,10,0,1,0\n", 5)
+	mapRes := compressDayLines(t)
+	bytesState, _ := ioutil.ReadFile(sStateFile)
+
+	// 600001.csv 无法读取(指向不存在的文件的符号链接)
+	if err := os.Symlink("./missing.csv", "./DAY/600001.csv"); nil != err {
+		t.Skip("symlink is not supported : ", err.Error())
+	}
+
+	objCompressor := Compressor{TargetFolder: "./SyncFolder/", StateFolder: "./buildstate/"}
+	if _, bIsOk := objCompressor.XCompress("sse.d1", &DataSourceConfig{MkID: "sse", Folder: "./DAY/"}, nil); true == bIsOk {
+		t.Fatal("compression should fail when a source file cannot be loaded")
+	}
+
+	if bytesNewState, _ := ioutil.ReadFile(sStateFile); string(bytesState) != string(bytesNewState) {
+		t.Fatalf("build state should not be saved after a failed build : %s", string(bytesNewState))
+	}
+
+	// 源文件恢复(修改时间早于上次构建): 仍然重新生成2016年的压缩文件
+	os.Remove("./DAY/600001.csv")
+	writeOldSourceFile(t, "./DAY/600001.csv", "20160104,10,11,9,10.5,0,100,10,0,1,0\n", 5)
+	if mapNewRes := compressDayLines(t); mapNewRes[sArchive2016].MD5 == mapRes[sArchive2016].MD5 {
+		t.Fatalf("archive of the failed source should be rebuilt : %+v", mapNewRes)
+	}
+}
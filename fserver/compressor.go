@@ -1,6 +1,6 @@
 /**
  * @brief		资源文件压缩
- * @detail 		需要在函数XCompress（）中配置针对不同资源类型的压缩策略
+ * @detail 		各资源类型的压缩策略由记录格式注册表提供(各 I_Record_IO 在init()中调用 RegisterRecordFormat() 注册)
  * @author		barry
  * @date		2018/4/10
  */
@@ -10,7 +10,10 @@ import (
 	"archive/tar"
 	"compress/zlib"
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -23,15 +26,55 @@ import (
 )
 
 //////////////////////////////////// 资源压缩写盘句柄管理类 ///////////////////////////////////////
+/**
+ * @class		HashingWriter
+ * @brief		写盘的同时，计算已写入数据的MD5 + SHA256 + 长度(不用在压缩完成后，再把文件读回来计算)
+ * @author		barry
+ */
+type HashingWriter struct {
+	objWriter     io.Writer // 被包装的写盘句柄
+	objMD5Hash    hash.Hash // MD5 (兼容旧版本客户端)
+	objSHA256Hash hash.Hash // SHA256
+	nSize         int64     // 已写入的数据长度
+}
+
+/**
+ * @brief		包装一个写盘句柄
+ */
+func NewHashingWriter(objWriter io.Writer) *HashingWriter {
+	return &HashingWriter{objWriter: objWriter, objMD5Hash: md5.New(), objSHA256Hash: sha256.New()}
+}
+
+/**
+ * @brief		写入数据(只对实际写入成功的部分计算摘要)
+ */
+func (pSelf *HashingWriter) Write(bytesData []byte) (int, error) {
+	nLen, err := pSelf.objWriter.Write(bytesData)
+	pSelf.objMD5Hash.Write(bytesData[:nLen])
+	pSelf.objSHA256Hash.Write(bytesData[:nLen])
+	pSelf.nSize += int64(nLen)
+
+	return nLen, err
+}
+
+/**
+ * @brief		返回已写入数据的摘要
+ * @return		md5串(小写hex) + sha256串(小写hex) + 数据长度
+ */
+func (pSelf *HashingWriter) Digest() (string, string, int64) {
+	return fmt.Sprintf("%x", pSelf.objMD5Hash.Sum(nil)), fmt.Sprintf("%x", pSelf.objSHA256Hash.Sum(nil)), pSelf.nSize
+}
+
 /**
  * @class		CompressHandles
  * @brief		目标文件句丙管理
  * @author		barry
  */
 type CompressHandles struct {
-	TarFile    *os.File     // 目标文件句柄
-	GZipWriter *zlib.Writer // 目标zlib.Writer句柄
-	TarWriter  *tar.Writer  // 目标tar.Writer 句柄
+	TarFile    *os.File       // 目标文件句柄
+	HashWriter *HashingWriter // 目标文件的摘要计算句柄(zlib.Writer ---> HashWriter ---> TarFile)
+	GZipWriter *zlib.Writer   // 目标zlib.Writer句柄
+	TarWriter  *tar.Writer    // 目标tar.Writer 句柄
 }
 
 /**
@@ -50,7 +93,8 @@ func (pSelf *CompressHandles) OpenFile(sFilePath string, nZlibpCompressLevel int
 		return false
 	}
 
-	pSelf.GZipWriter, err = zlib.NewWriterLevel(pSelf.TarFile, nZlibpCompressLevel)
+	pSelf.HashWriter = NewHashingWriter(pSelf.TarFile)
+	pSelf.GZipWriter, err = zlib.NewWriterLevel(pSelf.HashWriter, nZlibpCompressLevel)
 	if err != nil {
 		log.Println("[ERR] CompressHandles.OpenFile() : failed 2 create *tar.Writer :", sFilePath, err.Error())
 		return false
@@ -89,7 +133,13 @@ func (pSelf *CompressHandles) CloseFile() {
 type BaseRecordIO struct {
 	DataType        string                     // 资源文件所属类型
 	CodeRangeFilter I_CodeRange_Filter         // 资源文件对应市场的有效代码段
+	Sessions        TradingSessions            // 资源文件对应市场的交易时段(分钟k线的切分等)
+	Holidays        *HolidayCalendar           // 资源文件对应市场的休市日历(近期数据的判断)
+	LiveDate        int                        // 实时资源: 只写入这一天(yyyymmdd)的数据(为0时，写入全部日期)
 	mapFileHandle   map[string]CompressHandles // 资源文件压缩过程中，根据文件句缓存对应的文件句柄(提高性能)
+	mapRecentBegin  map[int]int                // 最近n个交易日 -> 其中第一天的日期(yyyymmdd)
+	refBuild        *IncrementalBuild          // 增量压缩的过程状态(为nil时，全部写入)
+	objSkipWriter   *tar.Writer                // 输入没有变化的压缩文件，数据写到这里丢弃
 }
 
 /**
@@ -99,14 +149,40 @@ type BaseRecordIO struct {
 */
 func (pSelf *BaseRecordIO) Initialize() bool {
 	pSelf.mapFileHandle = make(map[string]CompressHandles)
+	pSelf.mapRecentBegin = make(map[int]int)
+	pSelf.objSkipWriter = tar.NewWriter(ioutil.Discard)
 	return true
 }
 
+/**
+ * @brief		设置增量压缩的过程状态(只重新生成输入有变化的压缩文件)
+ */
+func (pSelf *BaseRecordIO) SetIncrementalBuild(refBuild *IncrementalBuild) {
+	pSelf.refBuild = refBuild
+}
+
+/**
+* @brief		判断数据日期是否为近期(最近n个交易日内，按市场的休市日历计算)
+* @param[in]	nDate			数据日期(yyyymmdd)
+* @param[in]	nTradingDays	近期的交易日数
+* @note			近期的数据一天一个压缩文件，不是近期的数据按 半个月/年 合并压缩
+*/
+func (pSelf *BaseRecordIO) IsRecentDate(nDate int, nTradingDays int) bool {
+	nRecentBegin, ok := pSelf.mapRecentBegin[nTradingDays]
+	if false == ok {
+		nRecentBegin = pSelf.Holidays.NthTradingDayBack(time.Now(), nTradingDays)
+		pSelf.mapRecentBegin[nTradingDays] = nRecentBegin
+	}
+
+	return nDate >= nRecentBegin
+}
+
 /**
  * @brief		释放并关闭文件句柄（缓存中）
  * @detail 		内部进行文件资源列表的 时间顺序 返回
- * @return 		按 "时间顺序"，返回带 md5校验码 的压缩后资源 文件路径 及相关信息
- * @note 		函数按文件路径排序，日期靠前的文件在前面，有助于生成的“资源列表”是有时序性的，方便解压的时候，按时间顺序恢复行情数据
+ * @return 		按 "时间顺序"，返回带 md5/sha256校验码 + 文件长度 的压缩后资源 文件路径 及相关信息
+ * @note 		函数按文件路径排序，日期靠前的文件在前面，有助于生成的“资源列表”是有时序性的，方便解压的时候，按时间顺序恢复行情数据;
+ 				校验码在写盘时已经计算好(见 HashingWriter)，不再把文件读回内存
  */
 func (pSelf *BaseRecordIO) Release() []ResDownload {
 	var lstRes []ResDownload
@@ -120,18 +196,23 @@ func (pSelf *BaseRecordIO) Release() []ResDownload {
 
 	// 输出的资源列表排序： 必须是时间序，这个时间序将会下发给同步client.exe依赖
 	sort.Strings(lstSortKeys)
-	// 按时间遍历，并提取MD5串
+	// 按时间遍历，并提取MD5/SHA256串
 	for _, sVal := range lstSortKeys {
-		data, err := ioutil.ReadFile(sVal)
+		objFileInfo, err := os.Stat(pSelf.stagingPath(sVal))
 		if err != nil {
 			log.Println("[WARN] BaseRecordIO.Release() : local file is not exist :", sVal)
 			return lstRes
 		}
 
-		/////////////////////// Generate MD5 String
-		sMD5 := strings.ToLower(fmt.Sprintf("%x" /*objMD5Hash*/, md5.Sum(data)))
-		log.Printf("[INF] BaseRecordIO.Release() : close file = %s, md5 = %s", sVal, sMD5)
-		lstRes = append(lstRes, ResDownload{TYPE: pSelf.DataType, URI: sVal, MD5: sMD5, UPDATE: time.Now().Format("2006-01-02 15:04:05")})
+		/////////////////////// Fetch Digest Calculated While Writing
+		sMD5, sSHA256, nSize := pSelf.mapFileHandle[sVal].HashWriter.Digest()
+		if nSize != objFileInfo.Size() {
+			log.Printf("[WARN] BaseRecordIO.Release() : size mismatch, %s : written = %d, file = %d", sVal, nSize, objFileInfo.Size())
+			return lstRes
+		}
+
+		log.Printf("[INF] BaseRecordIO.Release() : close file = %s, md5 = %s, sha256 = %s, size = %d", sVal, sMD5, sSHA256, nSize)
+		lstRes = append(lstRes, ResDownload{TYPE: pSelf.DataType, URI: sVal, MD5: sMD5, SHA256: sSHA256, SIZE: nSize, UPDATE: time.Now().Format("2006-01-02 15:04:05")})
 	}
 
 	// 返回带 时间序 的资源列表
@@ -145,6 +226,13 @@ func (pSelf *BaseRecordIO) GetCompressLevel() int {
 	return zlib.BestCompression //.DefaultCompression
 }
 
+/**
+ * @brief		默认不限制历史数据的起始日期
+ */
+func (pSelf *BaseRecordIO) HistoryBegin() int {
+	return 0
+}
+
 /**
  * @brief		默认不过滤任何商品代码
  */
@@ -173,13 +261,8 @@ func (pSelf *BaseRecordIO) GenFilePath(sFileName string) string {
 */
 func (pSelf *BaseRecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile string) *tar.Writer {
 	var sFile string = ""
-	var objToday time.Time = time.Now()
-	// 先计算源文件中，行情记录数据的年份是否为近期
-	objRecordDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 21, 6, 9, 0, time.Local)
-	subHours := objToday.Sub(objRecordDate)
-	nDays := subHours.Hours() / 24
-
-	if nDays <= 16 { // 如果是近期，则目标压缩文件，一天的数据生成一个文件名(带全日期)
+	// 先计算源文件中，行情记录数据的日期是否为近期
+	if true == pSelf.IsRecentDate(nDate, nRecentTradingDays) { // 如果是近期，则目标压缩文件，一天的数据生成一个文件名(带全日期)
 		sFile = fmt.Sprintf("%s%d", sFilePath, nDate)
 	} else { // 如果不是近期，则目标压缩文件，半个月的数据一个文件名(带上下月信息)
 		nDD := (nDate % 100) ////////// One File With 2 Week's Data Inside
@@ -192,17 +275,51 @@ func (pSelf *BaseRecordIO) GrapWriter(sFilePath string, nDate int, sSrcFile stri
 	}
 
 	// 根据生成的目标文件句 打开、或从缓存中返回已经打开的目标压缩文件的句柄
+	return pSelf.openArchive(sFile, nDate, sSrcFile)
+}
+
+/**
+ * @brief		压缩文件实际写盘的路径(设置了暂存目录时，在暂存目录中)
+ */
+func (pSelf *BaseRecordIO) stagingPath(sFile string) string {
+	if nil == pSelf.refBuild {
+		return sFile
+	}
+
+	return pSelf.refBuild.StagingPath(sFile)
+}
+
+/**
+* @brief		打开目标压缩文件，或从缓存中返回已经打开的文件句柄
+* @param[in]	sFile			目标压缩文件的全路径
+* @param[in]	nDate 			从源数据文件读取记录的日期
+* @param[in]	sSrcFile		源数据文件的路径
+* @note			增量压缩时，输入没有变化的压缩文件不打开(不重写)，返回丢弃数据的句柄;
+				设置了暂存目录时，压缩文件写在暂存目录中(句柄缓存仍按发布后的路径);
+				实时资源只生成当天的压缩文件，其它日期的数据丢弃
+*/
+func (pSelf *BaseRecordIO) openArchive(sFile string, nDate int, sSrcFile string) *tar.Writer {
+	if 0 != pSelf.LiveDate && nDate != pSelf.LiveDate {
+		return pSelf.objSkipWriter
+	}
+
+	if nil != pSelf.refBuild && false == pSelf.refBuild.NeedWrite(sFile, nDate, sSrcFile) {
+		return pSelf.objSkipWriter
+	}
+
 	if objHandles, ok := pSelf.mapFileHandle[sFile]; ok {
 		return objHandles.TarWriter
 	} else {
 		var objCompressHandles CompressHandles
+		var sStagedFile string = pSelf.stagingPath(sFile) // 新生成的压缩文件先写入暂存目录，全部压缩完成后再发布
 
-		if true == objCompressHandles.OpenFile(sFile, pSelf.GetCompressLevel()) {
+		os.MkdirAll(filepath.Dir(sStagedFile), 0755)
+		if true == objCompressHandles.OpenFile(sStagedFile, pSelf.GetCompressLevel()) {
 			pSelf.mapFileHandle[sFile] = objCompressHandles
 
 			return pSelf.mapFileHandle[sFile].TarWriter
 		} else {
-			log.Println("[ERR] BaseRecordIO.GrapWriter() : failed 2 open *tar.Writer :", sFilePath)
+			log.Println("[ERR] BaseRecordIO.openArchive() : failed 2 open *tar.Writer :", sFile)
 		}
 
 	}
@@ -223,6 +340,8 @@ type I_Record_IO interface {
 	GenFilePath(sFileName string) string                                 // generate name  of file which in .tar
 	GrapWriter(sFilePath string, nDate int, sSrcFile string) *tar.Writer // grap a .tar writer ptr
 	GetCompressLevel() int                                               // get gzip compression level
+	HistoryBegin() int                                                   // the first date of data which will be compressed (0 means no limit)
+	SetIncrementalBuild(refBuild *IncrementalBuild)                      // rebuild only archives whose inputs changed
 }
 
 ////////////////////////////////////// 资源压缩总类 ////////////////////////////////////////////////
@@ -233,24 +352,27 @@ type I_Record_IO interface {
  * @author		barry
  */
 type Compressor struct {
-	TargetFolder string // 压缩后资源文件存放的根目录
+	TargetFolder  string      // 压缩后资源文件存放的根目录(资源URI的根目录)
+	StagingFolder string      // 重新生成的压缩文件的暂存目录(为空时，直接写入TargetFolder; 由调用方发布，见 FileSyncServer.PublishGeneration())
+	StateFolder   string      // 增量压缩的构建状态存放目录(为空时，全量压缩)
+	Pool          *WorkerPool // 压缩工作池(为nil时，按CPU核数创建)
 }
 
 ///< ----------------------------- [Private 方法] ----------------------------------------
 /**
-* @brief		递归压缩目录
-* @detail 		这个函数的功能主要就是递归
-* @param[in]	sDestFile		目标文件路径和前缀
+* @brief		递归遍历目录，列出待压缩的源文件
+* @detail 		这个函数的功能主要就是递归; 按XCompress()中定义的，各类型资源的文件级过滤条件过滤源文件
 * @param[in]	sSrcFolder		数据源目录
 * @param[in]	sRecursivePath	递归目录
 * @param[in]	pILoader		记录策略类接口
+* @param[out]	refSources		待压缩的源文件(按遍历顺序)
 * @return		true			成功
 				false			失败
 */
-func (pSelf *Compressor) compressFolder(sDestFile string, sSrcFolder string, sRecursivePath string, pILoader I_Record_IO) bool {
+func (pSelf *Compressor) scanFolder(sSrcFolder string, sRecursivePath string, pILoader I_Record_IO, refSources *[]SourceFile) bool {
 	oDirFile, err := os.Open(sSrcFolder) // Open source diretory
 	if err != nil {
-		log.Println("[INF] Compressor.compressFolder() : cannot open source folder :", sSrcFolder, err.Error())
+		log.Println("[INF] Compressor.scanFolder() : cannot open source folder :", sSrcFolder, err.Error())
 		return false
 	}
 	defer oDirFile.Close()
@@ -263,86 +385,103 @@ func (pSelf *Compressor) compressFolder(sDestFile string, sSrcFolder string, sRe
 	for _, oFileInfo := range lstFileInfo {
 		sCurPath := path.Join(sSrcFolder, oFileInfo.Name()) // Append path
 		if oFileInfo.IsDir() {                              // Check it is directory or file
-			pSelf.compressFolder(sDestFile, sCurPath, path.Join(sRecursivePath, oFileInfo.Name()), pILoader) // (Directory won't add unitl all subfiles are added)
+			pSelf.scanFolder(sCurPath, path.Join(sRecursivePath, oFileInfo.Name()), pILoader, refSources)
+		} else if true == pILoader.CodeInWhiteTable(sCurPath) {
+			*refSources = append(*refSources, SourceFile{Path: sCurPath, RecursivePath: path.Join(sRecursivePath, oFileInfo.Name()), Info: oFileInfo})
 		}
-
-		compressFile(sDestFile, sCurPath, path.Join(sRecursivePath, oFileInfo.Name()), oFileInfo, pILoader)
 	}
 
 	return true
 }
 
 /**
- * @brief		文件压缩函数
- * @detail 		具体压缩策略的使用逻辑也在这里编码
+ * @brief		提取、压缩源文件
+ * @detail 		源文件在工作池中并行加载(预取: 最多同时加载 工作协程数 个源文件)，按遍历顺序分发到目标压缩文件，
+ 				再由各压缩文件的写协程写盘 (见 compresspipeline.go)
  * @param[in]	sDestFile		目标文件存放路径（ Path => 目标根目录 + 市场编号 + 子目录 + 文件句前缀部分 ）
- * @param[in]	sSrcFile		源文件存放全路径
+ * @param[in]	lstSources		待压缩的源文件(按遍历顺序)
  * @param[in]	pILoader		在XCompress()中定义的数据 提取+压缩 策略接口
+ * @param[in]	refBuild		增量压缩的过程状态(决定哪些源文件需要加载)
+ * @return		true			成功
+				false			有加载失败的源文件，或有写入失败的压缩文件
  * @note 		核心的引擎函数
  */
-func compressFile(sDestFile string, sSrcFile string, sRecursivePath string, oFileInfo os.FileInfo, pILoader I_Record_IO) bool {
-	if oFileInfo.IsDir() {
-	} else {
-		var nIndex int = 0   // 遍历过的文件数据的长度
-		var nDataLen int = 0 // 读出的全部文件数据的总长度
+func (pSelf *Compressor) compressSources(sDestFile string, lstSources []SourceFile, pILoader I_Record_IO, refBuild *IncrementalBuild) bool {
+	type loadResult struct {
+		Chunks []SourceChunk
+		IsOk   bool
+	}
+	var refPool *WorkerPool = pSelf.Pool
+	var mapLoading map[int]chan loadResult = make(map[int]chan loadResult) // 正在加载(或已经加载完)的源文件
+	var bIsOk bool = true
 
-		////////// 按源文件路径名过滤 ---> 按XCompress()中定义的，各类型资源的文件级过滤条件
-		if pILoader.CodeInWhiteTable(sSrcFile) == false {
-			return true
-		}
+	if nil == refPool {
+		refPool = NewWorkerPool(0)
+	}
 
-		////////// 打开源文件 && 读出所有数据记录 ////////////////////
-		oSrcFile, err := os.Open(sSrcFile)
-		if err != nil {
-			return false
-		}
-		defer oSrcFile.Close()
-		bytesData, err := ioutil.ReadAll(oSrcFile)
-		if err != nil {
-			return false
-		}
+	objFanIn := NewArchiveFanIn(refPool)
+	fnLoad := func(nIndex int) {
+		chResult := make(chan loadResult, 1)
+		mapLoading[nIndex] = chResult
+		refPool.Go(func() {
+			lstChunks, bIsLoaded := loadSourceFile(lstSources[nIndex], pILoader)
+			chResult <- loadResult{Chunks: lstChunks, IsOk: bIsLoaded}
+		})
+	}
 
-		///////// 遍历所有的数据记录 && 压缩目标文件 /////////////////
-		nDataLen = len(bytesData)
-		for nIndex < nDataLen {
-			hdr := new(tar.Header) // Create tar header
-			//hdr, err := tar.FileInfoHeader(oFileInfo, "")
-			///// 遍历 && 全部或部分读出记录集
-			hdr.Name = pILoader.GenFilePath(sRecursivePath)                    // 根据源文件的路径，按XCompress()中定义的策略，复用或生成新的目标文件路径
-			bData, nDate, nOffset := pILoader.LoadFromFile(bytesData[nIndex:]) // 按XCompress()中定义的策略，批量返回部分或全部的 "重新格式化" 后的记录
-			nIndex += nOffset
-
-			if nDate < 19901010 || nDate > 20301010 { // 判断记录体中的无效日期
+	for bLoading := true; true == bLoading; {
+		bLoading = false
+		for i, nPrefetch := 0, 0; i < len(lstSources); i++ {
+			///// 预取后面等待加载的源文件
+			if nPrefetch < i {
+				nPrefetch = i
+			}
+
+			for ; nPrefetch < len(lstSources) && len(mapLoading) < refPool.Size(); nPrefetch++ {
+				if _, ok := mapLoading[nPrefetch]; false == ok && true == refBuild.IsPending(lstSources[nPrefetch].Path) {
+					fnLoad(nPrefetch)
+				}
+			}
+
+			objSrc := lstSources[i]
+			if false == refBuild.TakePending(objSrc.Path) {
 				continue
 			}
 
-			///// 根据目标文件路径和前缀 + 行情记录的日期 + 源文件路径，根据XCompress()中定义的策略, 打开或从缓存中返回对应目标的句柄
-			pTarWriter := pILoader.GrapWriter(pILoader.GenFilePath(sDestFile), nDate, sSrcFile)
-			if nil == pTarWriter {
-				return false
+			if _, ok := mapLoading[i]; false == ok { // 加载中才变成等待加载的源文件
+				fnLoad(i)
 			}
 
-			hdr.Size = int64(len(bData))
-			hdr.Mode = int64(oFileInfo.Mode())
-			//< 注意： hdr.ModTime本应填被压文件修改时间，但为方便资源同步时的md5比较(因文件修改时间会被算在md5串中)，故使用固定时间
-			hdr.ModTime = time.Date(2018, time.Month(1), 2, 21, 6, 9, 0, time.Local) //oFileInfo.ModTime()
-			err = pTarWriter.WriteHeader(hdr)                                        // 写压缩数据头
-			if err != nil {
-				log.Println("[INF] Compressor.compressFile() : cannot write tar header 2 file :", sDestFile, err.Error())
-				return false
+			objResult := <-mapLoading[i]
+			delete(mapLoading, i)
+			bLoading = true
+			if false == objResult.IsOk {
+				bIsOk = false
+			}
+			///// 按源文件中的顺序，分发到目标压缩文件的写协程
+			for _, objChunk := range objResult.Chunks {
+				///// 根据目标文件路径和前缀 + 行情记录的日期 + 源文件路径，根据XCompress()中定义的策略, 打开或从缓存中返回对应目标的句柄
+				pTarWriter := pILoader.GrapWriter(pILoader.GenFilePath(sDestFile), objChunk.Date, objSrc.Path)
+				if nil == pTarWriter {
+					bIsOk = false
+					break
+				}
+
+				//< 注意： hdr.ModTime本应填被压文件修改时间，但为方便资源同步时的md5比较(因文件修改时间会被算在md5串中)，故使用固定时间
+				objFanIn.Write(pTarWriter, &tar.Header{Name: objChunk.Name, Size: int64(len(objChunk.Data)), Mode: int64(objSrc.Info.Mode()), ModTime: time.Date(2018, time.Month(1), 2, 21, 6, 9, 0, time.Local)}, objChunk.Data)
 			}
 
-			pTarWriter.Write(bData) // 写数据体
+			refBuild.EndSource(objSrc.Path)
 		}
 	}
 
-	return true
+	return objFanIn.Close() && bIsOk
 }
 
 ///< ---------------------------- [Public 方法] --------------------------------------------------
 /**
  * @brief		压缩函数及策略
- * @detail 		需要在这里定义各数据类型的压缩策略
+ * @detail 		各数据类型的压缩策略，由记录格式注册表提供(见 RegisterRecordFormat())
  * @param[in]	sResType		资源类型
  * @param[in]	objDataSrc		资源的市场和存放路径
  * @param[in]	codeRange 		对应市场的有效代码过滤器
@@ -352,65 +491,25 @@ func (pSelf *Compressor) XCompress(sResType string, objDataSrc *DataSourceConfig
 	var lstRes []ResDownload                                                                     // 带时间顺序的目标资源文件路径
 	var sDataType string = strings.ToLower(sResType[strings.Index(sResType, "."):])              // 数据类型 (d1/m1/m5/wt)
 	var sDestFolder string = filepath.Join(pSelf.TargetFolder, strings.ToUpper(objDataSrc.MkID)) // 目标文件存放路径（ Path => 目标根目录 + 市场编号 ）
+	var sStateFile string = ""                                                                   // 构建状态文件路径
 	log.Printf("[INF] Compressor.XCompress() : [Compressing] ExchangeCode:%s, DataType:%s, Folder:%s", objDataSrc.MkID, sDataType, objDataSrc.Folder)
 	sDestFolder = strings.Replace(sDestFolder, "\\", "/", -1)
-	// 压缩策略配置部分
-	switch {
-	case (objDataSrc.MkID == "sse" && sDataType == ".st") || (objDataSrc.MkID == "szse" && sDataType == ".st"):
-		objRecordIO := StaticRecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of Weight data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "STATIC/STATIC."), objDataSrc.Folder, &objRecordIO)
-	case (objDataSrc.MkID == "sse" && sDataType == ".wt") || (objDataSrc.MkID == "szse" && sDataType == ".wt"):
-		objRecordIO := WeightRecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of Weight data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "WEIGHT/WEIGHT."), objDataSrc.Folder, &objRecordIO)
-	case (objDataSrc.MkID == "sse" && sDataType == ".d1") || (objDataSrc.MkID == "szse" && sDataType == ".d1"):
-		objRecordIO := Day1RecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of Day data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "DAY/DAY."), objDataSrc.Folder, &objRecordIO)
-	case (objDataSrc.MkID == "sse" && sDataType == ".m1") || (objDataSrc.MkID == "szse" && sDataType == ".m1"):
-		objRecordIO := Minutes1RecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of M1 data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "MIN/MIN."), objDataSrc.Folder, &objRecordIO)
-	case (objDataSrc.MkID == "sse" && sDataType == ".real_m1") || (objDataSrc.MkID == "szse" && sDataType == ".real_m1"):
-		objRecordIO := RealMinutes1RecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of M1 data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "MIN1_TODAY/MIN1_TODAY."), objDataSrc.Folder, &objRecordIO)
-	case (objDataSrc.MkID == "sse" && sDataType == ".m5") || (objDataSrc.MkID == "szse" && sDataType == ".m5"):
-		objRecordIO := Minutes5RecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of M5 data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "MIN5/MIN5."), objDataSrc.Folder, &objRecordIO)
-	case (objDataSrc.MkID == "sse" && sDataType == ".m60") || (objDataSrc.MkID == "szse" && sDataType == ".m60"):
-		objRecordIO := Minutes60RecordIO{BaseRecordIO: BaseRecordIO{CodeRangeFilter: codeRange, DataType: strings.ToLower(sResType)}} // policy of M60 data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "MIN60/MIN60."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "hkse" && sDataType == ".participant":
-		objRecordIO := ParticipantRecordIO{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "Participant."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "hkse" && sDataType == ".shase_rzrq_by_date":
-		objRecordIO := Shase_rzrq_by_date{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "shase_rzrq_by_date/shase_rzrq_by_date."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "hkse" && sDataType == ".sznse_rzrq_by_date":
-		objRecordIO := Sznse_rzrq_by_date{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "sznse_rzrq_by_date/sznse_rzrq_by_date."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "hkse" && sDataType == ".shsz_idx_by_date":
-		objRecordIO := Shsz_idx_by_date{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "shsz_idx_by_date/shsz_idx_by_date."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "hkse" && sDataType == ".shsz_detail":
-		objRecordIO := Shsz_detail{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "shsz_detail/shsz_detail."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "qlfile" && sDataType == ".column_dy_bk":
-		objRecordIO := DYColumnRecordIO{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "dybk."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "qlfile" && sDataType == ".column_gn_bk":
-		objRecordIO := GNColumnRecordIO{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "gnbk."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "qlfile" && sDataType == ".column_hy_bk":
-		objRecordIO := HYColumnRecordIO{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "hybk."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "qlfile" && sDataType == ".column_zs_bk":
-		objRecordIO := ZSColumnRecordIO{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "zsbk."), objDataSrc.Folder, &objRecordIO)
-	case objDataSrc.MkID == "qlfile" && sDataType == ".blockinfo_ini":
-		objRecordIO := BlkInfoRecordIO{BaseRecordIO: BaseRecordIO{DataType: strings.ToLower(sResType)}} // policy of hk data loader
-		return pSelf.TranslateFolder(filepath.Join(sDestFolder, "blkinfo."), objDataSrc.Folder, &objRecordIO)
-	default:
+	// 按注册表中的记录格式构造压缩策略
+	objFormat, ok := LookupRecordFormat(sResType)
+	if false == ok {
 		log.Printf("[ERR] Compressor.XCompress() : [Compressing] invalid exchange code(%s) or data type(%s)", objDataSrc.MkID, sDataType)
 		return lstRes, false
 	}
+
+	objRecordIO, sDestPrefix := objFormat.createRecordIO(sResType, codeRange, objDataSrc)
+	if "" != pSelf.StateFolder { // 增量压缩: 加载上次的构建状态
+		sStateFile = filepath.Join(pSelf.StateFolder, strings.ToLower(sResType)+".json")
+	}
+
+	objBuild := NewIncrementalBuild(sStateFile, objDataSrc.Holidays)
+	objBuild.SetStaging(pSelf.TargetFolder, pSelf.StagingFolder)
+
+	return pSelf.TranslateFolder(filepath.Join(sDestFolder, sDestPrefix), objDataSrc.Folder, objRecordIO, objBuild)
 }
 
 /**
@@ -418,10 +517,14 @@ func (pSelf *Compressor) XCompress(sResType string, objDataSrc *DataSourceConfig
  * @detail 		遍历某类资源文件的根目录，压根据策略，提取压缩出新的目标数据文件
  * @param[in]	sDestFile		目标文件存放路径（ Path => 目标根目录 + 市场编号 + 子目录 + 文件句前缀部分 ）
  * @param[in]	sSrcFolder		源文件存放Root目录
+ * @param[in]	refBuild		增量压缩的过程状态(只重新生成输入有变化的压缩文件)
  * @return		有时间顺序的压缩后目标文件路径 + 带md5码 和 成功标识(true/false)
+ * @note		有源文件加载失败或压缩文件写入失败时，返回false，且不保存本次的构建状态(下次仍与上次成功的构建状态比较，失败的部分会重新生成)
  */
-func (pSelf *Compressor) TranslateFolder(sDestFile, sSrcFolder string, pILoader I_Record_IO) ([]ResDownload, bool) {
+func (pSelf *Compressor) TranslateFolder(sDestFile, sSrcFolder string, pILoader I_Record_IO, refBuild *IncrementalBuild) ([]ResDownload, bool) {
 	var lstRes []ResDownload                   // 带时间顺序的目标资源文件路径
+	var lstSources []SourceFile                // 待压缩的源文件
+	var sRecursivePath string = "./"           // 源文件在压缩包中的递归路径
 	var sMkFolder string = path.Dir(sDestFile) // 截取出需要事先创建好的目标文件的目录树
 
 	///////////////// 准备好目标目录树
@@ -443,18 +546,26 @@ func (pSelf *Compressor) TranslateFolder(sDestFile, sSrcFolder string, pILoader
 		return lstRes, false
 	}
 
-	//////////////// 遍历源头目录，提取、压缩目标文件
+	//////////////// 遍历源头目录，列出待压缩的源文件，并与上次的构建状态比较
 	sDestFile = pILoader.GenFilePath(sDestFile)
 	if "windows" != runtime.GOOS {
-		if false == pSelf.compressFolder(sDestFile, sSrcFolder, path.Base(sSrcFolder), pILoader) {
-			return lstRes, false
-		}
-	} else {
-		if false == pSelf.compressFolder(sDestFile, sSrcFolder, "./", pILoader) {
-			return lstRes, false
-		}
+		sRecursivePath = path.Base(sSrcFolder)
+	}
+
+	if false == pSelf.scanFolder(sSrcFolder, sRecursivePath, pILoader, &lstSources) {
+		return lstRes, false
+	}
+
+	refBuild.Begin(sDestFile, sSrcFolder, lstSources, pILoader.HistoryBegin())
+	pILoader.SetIncrementalBuild(refBuild)
+
+	//////////////// 提取、压缩目标文件 (重新生成的压缩文件，其它源文件也要重新加载，直到没有等待加载的源文件)
+	if false == pSelf.compressSources(sDestFile, lstSources, pILoader, refBuild) {
+		pILoader.Release() // 关闭目标文件(不完整的压缩文件不发布，也不记入构建状态)
+		log.Println("[ERR] Compressor.TranslateFolder() : [FAILURE] cannot load some of source files or write some of target files, build state is not saved :", sSrcFolder)
+		return lstRes, false
 	}
 
-	/////////////// 关闭目标文件，且返回有时间顺序的压缩后目标文件路径 + 带md5码 和 成功标识(true/false)
-	return pILoader.Release(), true // 注：文件句丙关闭的后，根据目标文件路径的日期进行排序
+	/////////////// 关闭目标文件，且返回有时间顺序的压缩后目标文件路径(含没有变化的压缩文件) + 带md5码 和 成功标识(true/false)
+	return refBuild.Finish(pILoader.Release()), true // 注：文件句丙关闭的后，根据目标文件路径的日期进行排序
 }
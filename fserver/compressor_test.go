@@ -0,0 +1,81 @@
+/**
+ * @brief		资源文件压缩的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"archive/tar"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * @brief		Release() 返回的MD5/SHA256/长度，与磁盘上的压缩文件一致
+ */
+func TestReleaseDigestMatchesFile(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objRecordIO := &BaseRecordIO{DataType: "sse.d1"}
+	objRecordIO.Initialize()
+	for _, nDate := range []int{20170103, 20170120} {
+		pTarWriter := objRecordIO.GrapWriter(filepath.Join(sTempDir, "DAY."), nDate, "")
+		bytesData := []byte(fmt.Sprintf("record data of %d", nDate))
+		if nil == pTarWriter || nil != pTarWriter.WriteHeader(&tar.Header{Name: "600000.csv", Mode: 0600, Size: int64(len(bytesData))}) {
+			t.Fatal("cannot write tar header")
+		}
+
+		pTarWriter.Write(bytesData)
+	}
+
+	lstRes := objRecordIO.Release()
+	if 2 != len(lstRes) {
+		t.Fatalf("unexpected resources : %+v", lstRes)
+	}
+
+	for _, objRes := range lstRes {
+		bytesFile, err := ioutil.ReadFile(objRes.URI)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprintf("%x", md5.Sum(bytesFile)) != objRes.MD5 || fmt.Sprintf("%x", sha256.Sum256(bytesFile)) != objRes.SHA256 || int64(len(bytesFile)) != objRes.SIZE {
+			t.Errorf("digest mismatch : %+v", objRes)
+		}
+	}
+}
+
+/**
+ * @brief		配置文件中的资源类型都通过记录格式注册表解析，未注册的资源类型在加载配置时即失败
+ */
+func TestConfigurationResolvesRecordFormats(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objFormat, ok := LookupRecordFormat("SSE.m60")
+	if false == ok || "MIN60/MIN60." != objFormat.DestPrefix || false == objFormat.UseCodeRange {
+		t.Fatalf("unexpected record format of sse.m60 : %+v", objFormat)
+	}
+
+	if objFormat, ok = LookupRecordFormat("HKSE.Participant"); false == ok || "Participant." != objFormat.DestPrefix || true == objFormat.UseCodeRange {
+		t.Fatalf("unexpected record format of hkse.participant : %+v", objFormat)
+	}
+
+	objScheduler := FileScheduler{XmlCfgPath: filepath.Join(sTempDir, "configuration.xml")}
+	sXmlHead := `<?xml version="1.0" encoding="UTF-8"?><cfg version="1.0.1"><setting name="SyncFolder" value="./SyncFolder/"/>`
+	ioutil.WriteFile(objScheduler.XmlCfgPath, []byte(sXmlHead+`<setting name="SSE.d1" value="./DAY/"/><setting name="QLFILE.blockinfo_ini" value="./block/"/></cfg>`), 0644)
+	if false == objScheduler.loadConfiguration(true) || 2 != len(objScheduler.DataSrcCfg) {
+		t.Fatalf("cannot load configuration : %+v", objScheduler.DataSrcCfg)
+	}
+
+	ioutil.WriteFile(objScheduler.XmlCfgPath, []byte(sXmlHead+`<setting name="SSE.d1" value="./DAY/"/><setting name="NYSE.d1" value="./NYSE/"/></cfg>`), 0644)
+	if true == objScheduler.loadConfiguration(false) {
+		t.Fatal("configuration with unknown resource type should not be loaded")
+	}
+}
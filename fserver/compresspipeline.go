@@ -0,0 +1,207 @@
+/**
+ * @brief		并行压缩流水线
+ * @detail		1) 源文件的 读取 + 提取/合成(LoadFromFile) 在工作池中并行
+ 				2) 分发(GrapWriter: 决定每段数据写入哪个压缩文件)按源文件的遍历顺序，在一个协程中进行
+ 				3) 写压缩文件按目标压缩文件分流: 每个压缩文件一个写协程(tar.Writer只有一个写者)，各压缩文件的zlib压缩并行
+ * @note		每个压缩文件中数据的顺序与单线程压缩时相同，压缩结果逐字节一致(MD5不变);
+ 				LoadFromFile() 会被并行调用，不能修改策略对象的状态
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	nArchiveQueueSize int = 16 // 每个压缩文件写协程的待写数据队列长度
+)
+
+/**
+ * @Class 		WorkerPool
+ * @brief		压缩工作池: 限制同时进行的 源文件提取 + 压缩文件写盘 的任务数
+ * @author		barry
+ */
+type WorkerPool struct {
+	chSlots chan bool // 工作槽(容量即工作协程数)
+}
+
+/**
+ * @brief		创建压缩工作池
+ * @param[in]	nWorkers		工作协程数(<=0时，为CPU核数)
+ */
+func NewWorkerPool(nWorkers int) *WorkerPool {
+	if nWorkers <= 0 {
+		nWorkers = runtime.NumCPU()
+	}
+
+	return &WorkerPool{chSlots: make(chan bool, nWorkers)}
+}
+
+/**
+ * @brief		工作协程数
+ */
+func (pSelf *WorkerPool) Size() int {
+	return cap(pSelf.chSlots)
+}
+
+/**
+ * @brief		占用一个工作槽(没有空闲的工作槽时等待)
+ */
+func (pSelf *WorkerPool) Acquire() {
+	pSelf.chSlots <- true
+}
+
+/**
+ * @brief		释放一个工作槽
+ */
+func (pSelf *WorkerPool) Release() {
+	<-pSelf.chSlots
+}
+
+/**
+ * @brief		在工作池中执行一个任务(不阻塞调用者，任务在取得工作槽后执行)
+ */
+func (pSelf *WorkerPool) Go(fnTask func()) {
+	go func() {
+		pSelf.Acquire()
+		defer pSelf.Release()
+		fnTask()
+	}()
+}
+
+/**
+ * @Class 		SourceChunk
+ * @brief		从源文件中提取出的一段数据(写入压缩文件中的一项)
+ * @author		barry
+ */
+type SourceChunk struct {
+	Name string // 压缩包中的文件名
+	Date int    // 数据日期
+	Data []byte // 重新格式化后的数据
+}
+
+/**
+ * @brief		读取源文件，按策略批量提取出各段数据
+ * @param[in]	objSrc			源文件
+ * @param[in]	pILoader		在XCompress()中定义的数据 提取+压缩 策略接口
+ * @return		按源文件中顺序的各段数据(无效日期的数据已经去掉) + 成功标识(true/false)
+ * @note 		在工作池中并行执行
+ */
+func loadSourceFile(objSrc SourceFile, pILoader I_Record_IO) ([]SourceChunk, bool) {
+	var lstChunks []SourceChunk
+
+	bytesData, err := ioutil.ReadFile(objSrc.Path)
+	if nil != err {
+		log.Println("[WARN] loadSourceFile() : cannot read source file :", objSrc.Path, err.Error())
+		return lstChunks, false
+	}
+
+	sName := pILoader.GenFilePath(objSrc.RecursivePath) // 根据源文件的路径，按XCompress()中定义的策略，复用或生成新的目标文件路径
+	for nIndex := 0; nIndex < len(bytesData); {
+		bData, nDate, nOffset := pILoader.LoadFromFile(bytesData[nIndex:]) // 按XCompress()中定义的策略，批量返回部分或全部的 "重新格式化" 后的记录
+		nIndex += nOffset
+
+		if nDate < 19901010 || nDate > 20301010 { // 判断记录体中的无效日期
+			continue
+		}
+
+		lstChunks = append(lstChunks, SourceChunk{Name: sName, Date: nDate, Data: bData})
+	}
+
+	return lstChunks, true
+}
+
+/**
+ * @Class 		tarEntry
+ * @brief		待写入压缩文件的一项(数据头 + 数据体)
+ */
+type tarEntry struct {
+	Header *tar.Header // 数据头
+	Data   []byte      // 数据体
+}
+
+/**
+ * @Class 		ArchiveFanIn
+ * @brief		按目标压缩文件分流写盘: 每个 tar.Writer 一个写协程，按分发的顺序写入
+ * @author		barry
+ */
+type ArchiveFanIn struct {
+	refPool      *WorkerPool                   // 压缩工作池(写盘也占用工作槽)
+	mapQueues    map[*tar.Writer]chan tarEntry // 各压缩文件的待写数据队列
+	objWaitGroup sync.WaitGroup                // 等待各写协程结束
+	nErrors      int32                         // 写盘失败的次数
+}
+
+/**
+ * @brief		创建分流写盘对象
+ */
+func NewArchiveFanIn(refPool *WorkerPool) *ArchiveFanIn {
+	return &ArchiveFanIn{refPool: refPool, mapQueues: make(map[*tar.Writer]chan tarEntry)}
+}
+
+/**
+ * @brief		把一项数据交给压缩文件的写协程(只在分发协程中调用)
+ * @param[in]	pTarWriter		目标压缩文件
+ * @param[in]	refHeader		数据头
+ * @param[in]	bytesData		数据体
+ */
+func (pSelf *ArchiveFanIn) Write(pTarWriter *tar.Writer, refHeader *tar.Header, bytesData []byte) {
+	chQueue, ok := pSelf.mapQueues[pTarWriter]
+	if false == ok {
+		chQueue = make(chan tarEntry, nArchiveQueueSize)
+		pSelf.mapQueues[pTarWriter] = chQueue
+		pSelf.objWaitGroup.Add(1)
+		go pSelf.drain(pTarWriter, chQueue)
+	}
+
+	chQueue <- tarEntry{Header: refHeader, Data: bytesData}
+}
+
+/**
+ * @brief		等待所有数据写完
+ * @return		true			全部写入成功
+ 				false			有写入失败
+ */
+func (pSelf *ArchiveFanIn) Close() bool {
+	for _, chQueue := range pSelf.mapQueues {
+		close(chQueue)
+	}
+
+	pSelf.objWaitGroup.Wait()
+
+	return 0 == atomic.LoadInt32(&pSelf.nErrors)
+}
+
+/**
+ * @brief		压缩文件的写协程
+ */
+func (pSelf *ArchiveFanIn) drain(pTarWriter *tar.Writer, chQueue chan tarEntry) {
+	var bIsFailed bool = false // 写入失败后，丢弃该压缩文件后续的数据(仍要取空队列，分发协程才不会阻塞)
+	defer pSelf.objWaitGroup.Done()
+
+	for objEntry := range chQueue {
+		if true == bIsFailed {
+			continue
+		}
+
+		pSelf.refPool.Acquire()
+		err := pTarWriter.WriteHeader(objEntry.Header) // 写压缩数据头
+		if nil == err {
+			_, err = pTarWriter.Write(objEntry.Data) // 写数据体
+		}
+		pSelf.refPool.Release()
+
+		if nil != err {
+			log.Println("[WARN] ArchiveFanIn.drain() : cannot write tar entry :", objEntry.Header.Name, err.Error())
+			atomic.AddInt32(&pSelf.nErrors, 1)
+			bIsFailed = true
+		}
+	}
+}
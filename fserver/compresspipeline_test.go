@@ -0,0 +1,63 @@
+/**
+ * @brief		并行压缩流水线的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+/**
+ * @brief		不同工作协程数压缩出的资源文件逐字节一致(MD5相同)
+ */
+func TestParallelCompressionIsByteIdentical(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	os.MkdirAll("./DAY/", 0755)
+	for nCode := 600000; nCode < 600040; nCode++ {
+		var lstLines []string
+		for nYear := 2015; nYear <= 2017; nYear++ {
+			for _, nMMDD := range []int{104, 105, 111, 220, 1229} {
+				lstLines = append(lstLines, fmt.Sprintf("%d,10,11,9,%d.5,0,100,%d,0,1,0", nYear*10000+nMMDD, nCode%100, nMMDD))
+			}
+		}
+
+		ioutil.WriteFile(fmt.Sprintf("./DAY/%d.csv", nCode), []byte(strings.Join(lstLines, "\n")+"\n"), 0644)
+	}
+
+	fnCompress := func(sResType string, nWorkers int) map[string]string {
+		sTargetFolder := fmt.Sprintf("./SyncFolder%d/", nWorkers)
+		objCompressor := Compressor{TargetFolder: sTargetFolder, Pool: NewWorkerPool(nWorkers)}
+		lstRes, bIsOk := objCompressor.XCompress(sResType, &DataSourceConfig{MkID: "sse", Folder: "./DAY/", Sessions: DefaultSessions}, nil)
+		if false == bIsOk || 0 == len(lstRes) {
+			t.Fatalf("cannot compress %s with %d workers", sResType, nWorkers)
+		}
+
+		mapMD5 := make(map[string]string)
+		for _, objRes := range lstRes {
+			mapMD5[strings.TrimPrefix(objRes.URI, strings.TrimPrefix(sTargetFolder, "./"))] = objRes.MD5
+		}
+
+		return mapMD5
+	}
+
+	for _, sResType := range []string{"sse.d1", "sse.w1"} {
+		mapSerial, mapParallel := fnCompress(sResType, 1), fnCompress(sResType, 8)
+		if len(mapSerial) != len(mapParallel) {
+			t.Fatalf("%s : different archives : %v, %v", sResType, mapSerial, mapParallel)
+		}
+
+		for sFile, sMD5 := range mapSerial {
+			if sMD5 != mapParallel[sFile] {
+				t.Errorf("%s : md5 of %s mismatch : %s != %s", sResType, sFile, sMD5, mapParallel[sFile])
+			}
+		}
+	}
+}
@@ -6,7 +6,7 @@
 					1.2) 附加资源： 扩展资源（钱龙板块分类信息）, 定时在午夜开始生成
 					1.3) FTP资源：  由台湾合作方提供的资源，开启独立小程序从ftp同步后，由本程序生成压缩文件（每天在几个配置时段做多次同步，以防同步时异常）
 				2) 实时资源:
-					沪、深今天内的实时1分钟线，每过n分钟生成一次；供quoteclientapi下载
+					任意市场、任意数据类型今天内的数据(如沪、深今天内的实时1分钟线)，盘中每过n分钟生成一次；供quoteclientapi下载(见 liveresource.go)
 * @author		barry
 * @date		2018/4/10
 */
@@ -20,8 +20,10 @@ import (
 	"os"
 	"path/filepath"
 	//"runtime/pprof"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -110,8 +112,12 @@ type I_CodeRange_Filter interface {
  * @author		barry
  */
 type DataSourceConfig struct {
-	MkID   string // 市场编号 ( SSE:上海 SZSE:深圳 )
-	Folder string // 待压缩的资源文件所在目录（比如：D:\HQHISDATA\SSE\MIN\ 和 D:\HQHISDATA\SSE\DAY\ )
+	MkID       string           // 市场编号 ( SSE:上海 SZSE:深圳 )
+	Folder     string           // 待压缩的资源文件所在目录（比如：D:\HQHISDATA\SSE\MIN\ 和 D:\HQHISDATA\SSE\DAY\ )
+	Sessions   TradingSessions  // 市场的交易时段
+	Holidays   *HolidayCalendar // 市场的休市日历
+	DestPrefix string           // 目标文件的子目录 + 文件名前缀(为空时，取记录格式注册的前缀; 实时资源为 <别名>/<别名>.)
+	LiveDate   int              // 实时资源: 只压缩这一天(yyyymmdd)的数据，且包括盘中未完成的数据(为0时，是历史资源)
 }
 
 /**
@@ -121,44 +127,61 @@ type DataSourceConfig struct {
  * @author		barry
  */
 type FileScheduler struct {
-	XmlCfgPath     string                      // xml配置文件路径（由命令行启动参数输入）
-	SyncFolder     string                      // 待生成的资源文件所在根目录（由命令行启动参数输入）
-	SZRealM1Folder string                      // 待生成的深圳今天内的实时1分钟线根目录（实时：每过n分钟生成一次）
-	SHRealM1Folder string                      // 待生成的上海今天内的实时1分钟线根目录（实时：每过n分钟生成一次）
-	DataSrcCfg     map[string]DataSourceConfig // 待生成的各历史行情资源所在根目录（历史：定时生成）
-	BuildTime      int                         // 历史行情资源生成操作激活时间(分钟线、日线、权息信息等)
-	RefSyncSvr     *FileSyncServer             // 资源下载网络服务器引用对象
-	codeRangeOfSH  CodeRangeClass              // 上海市场：需要参与资源包生成的有效代码段
-	codeRangeOfSZ  CodeRangeClass              // 深圳市场：需要参与资源包生成的有效代码段
+	XmlCfgPath      string                      // xml配置文件路径（由命令行启动参数输入）
+	SyncFolder      string                      // 待生成的资源文件所在根目录（由命令行启动参数输入）
+	LiveResources   []LiveResourceConfig        // 待生成的各实时资源（实时：盘中每过n分钟生成一次）
+	DataSrcCfg      map[string]DataSourceConfig // 待生成的各历史行情资源所在根目录（历史：定时生成）
+	BuildTime       int                         // 历史行情资源生成操作激活时间(分钟线、日线、权息信息等)
+	CompressWorkers int                         // 压缩工作协程数(源文件并行提取 + 压缩文件并行写盘 + 资源类型并行压缩，0为CPU核数)
+	RefSyncSvr      *FileSyncServer             // 资源下载网络服务器引用对象
+	mapMarkets      map[string]*MarketConfig    // 各市场的定义(市场编号 -> 代码过滤器 + 交易时段 + 支持的数据类型)
+	objBuildLock    sync.Mutex                  // 资源生成锁(资源生成 与 配置重新加载 互斥)
+	objStopChan     chan bool                   // 停止通知(被关闭时，资源生成线程退出，进行中的全类型压缩中止)
+	objThreadDone   chan bool                   // 资源生成线程已经退出的通知
+	objStopOnce     sync.Once                   // 保证停止通知只发一次
+	mapLiveBuilt    map[string]time.Time        // 各实时资源上一次生成的时间(别名URI -> 时间)
 }
 
 ///< ---------------------------- [Public 方法] --------------------------------------------------
 /**
- * @brief		根据交易所代码，获取对应的商品代码过滤方法对象
- * @param[in]	sExchangeID		交易所代码
- * @return		商品代码过滤接口 (I_CodeRange_Filter)
+ * @brief		根据资源类型(或交易所代码)，获取对应市场的商品代码过滤方法对象
+ * @param[in]	sResType		资源类型 (如: sse.d1 / shfe.m60)，或 交易所代码 + "."
+ * @return		商品代码过滤接口 (I_CodeRange_Filter)，市场未定义或没有设置过滤条件时返回nil(不过滤)
  */
-func (pSelf *FileScheduler) GetCodeRangeFilter(sExchangeID string) I_CodeRange_Filter {
-	var objRangeOp I_CodeRange_Filter = nil
+func (pSelf *FileScheduler) GetCodeRangeFilter(sResType string) I_CodeRange_Filter {
+	sMkID := strings.ToLower(strings.Split(sResType, ".")[0])
+	objMarket, ok := pSelf.mapMarkets[sMkID]
+	if false == ok || true == objMarket.CodeFilter.IsEmpty() {
+		return nil
+	}
 
-	sExchangeID = strings.ToLower(sExchangeID)
-	if strings.Index(sExchangeID, "sse") >= 0 {
-		if len(pSelf.codeRangeOfSH) == 0 {
-			return nil
-		}
+	return &objMarket.CodeFilter
+}
 
-		objRangeOp = &pSelf.codeRangeOfSH
+/**
+ * @brief		获取某市场的交易时段
+ * @param[in]	sMkID			市场编号
+ * @return		交易时段 (市场未定义时返回nil)
+ */
+func (pSelf *FileScheduler) GetMarketSessions(sMkID string) TradingSessions {
+	if objMarket, ok := pSelf.mapMarkets[strings.ToLower(sMkID)]; true == ok {
+		return objMarket.Sessions
 	}
 
-	if strings.Index(sExchangeID, "szse") >= 0 {
-		if len(pSelf.codeRangeOfSZ) == 0 {
-			return nil
-		}
+	return nil
+}
 
-		objRangeOp = &pSelf.codeRangeOfSZ
+/**
+ * @brief		获取某市场的休市日历
+ * @param[in]	sMkID			市场编号
+ * @return		休市日历 (市场未定义或没有配置休市日历时返回nil，只按周末判断交易日)
+ */
+func (pSelf *FileScheduler) GetMarketHolidays(sMkID string) *HolidayCalendar {
+	if objMarket, ok := pSelf.mapMarkets[strings.ToLower(sMkID)]; true == ok {
+		return objMarket.Holidays
 	}
 
-	return objRangeOp
+	return nil
 }
 
 /**
@@ -172,6 +195,75 @@ func (pSelf *FileScheduler) GetCodeRangeFilter(sExchangeID string) I_CodeRange_F
 func (pSelf *FileScheduler) Active() bool {
 	log.Println("[INF] FileScheduler.Active() : configuration file path: ", pSelf.XmlCfgPath)
 	///////////////////////////// 加载本地配置文件(.xml)并初始化到结构中 ////////////////////////////
+	if false == pSelf.loadConfiguration(true) {
+		return false
+	}
+
+	///////////////////////////// 启动时先压缩一次待下载资源文件(若，今日内已经压缩过，则跳空) ////////////////////////////
+	if false == pSelf.compressHistoryResource("") {
+		return false
+	}
+
+	///////////////////////////// 加载资源列表xml字符串 + 并从xml中恢复出资源列表结构对象 ////////////////////////////////
+	if false == pSelf.RefSyncSvr.LoadResList() {
+		return false
+	}
+
+	log.Println("[INF] FileScheduler.compressHistoryResource() : [OK] Resources List Builded! ......")
+	///////////////////////////// 启动成功， 开辅助线程： 定时FTP资源资源 + 实时资源 压缩线程 ////////////////////////////
+	pSelf.objStopChan = make(chan bool)
+	pSelf.objThreadDone = make(chan bool)
+	go pSelf.allResourcesRebuilderThread()
+
+	return true
+}
+
+/**
+* @brief		重新加载配置文件(SIGHUP)
+* @detail		重新读取数据源目录、代码段、生成时间等配置，不影响网络服务;
+				会等待进行中的资源生成结束后，再替换配置
+* @note			SyncFolder 已被网络服务使用，修改后需要重启服务才生效
+* @return		true		加载成功
+				false		加载失败(继续使用原有配置)
+*/
+func (pSelf *FileScheduler) Reload() bool {
+	log.Println("[INF] FileScheduler.Reload() : reloading configuration file: ", pSelf.XmlCfgPath)
+
+	return pSelf.loadConfiguration(false)
+}
+
+/**
+* @brief		停止资源文件生成服务
+* @detail		通知资源生成线程退出，进行中的全类型压缩在当前资源类型压缩完成后中止(不更新资源列表和status.dat)
+* @param[in]	nTimeout	等待资源生成线程退出的最长时间
+* @return		true		已经停止
+				false		等待超时
+* @note			可重复调用(用于多处等待资源生成线程退出)
+*/
+func (pSelf *FileScheduler) Stop(nTimeout time.Duration) bool {
+	if nil == pSelf.objStopChan {
+		return true
+	}
+
+	pSelf.objStopOnce.Do(func() { close(pSelf.objStopChan) })
+	select {
+	case <-pSelf.objThreadDone:
+		log.Println("[INF] FileScheduler.Stop() : [OK] resources rebuilder has stopped.")
+		return true
+	case <-time.After(nTimeout):
+		log.Println("[WARN] FileScheduler.Stop() : timeout while waiting 4 resources rebuilder.")
+		return false
+	}
+}
+
+///< ----------------------------- [Private 方法] ----------------------------------------
+/**
+* @brief		加载本地配置文件(.xml)并初始化到结构中
+* @detail		先解析到临时变量中，全部成功后，再在资源生成锁内替换当前配置;
+				先加载<market>节点定义的市场(沪深为内置市场)，再加载<setting>节点
+* @param[in]	bFirstTime		true: 启动时首次加载; false: 重新加载(SyncFolder不可变更)
+*/
+func (pSelf *FileScheduler) loadConfiguration(bFirstTime bool) bool {
 	var objCfg struct { // 定义本地xml配置文件的内存结构，用于加载服务配置项
 		XMLName xml.Name `xml:"cfg"`
 		Version string   `xml:"version,attr"`
@@ -180,105 +272,272 @@ func (pSelf *FileScheduler) Active() bool {
 			Name    string   `xml:"name,attr"`
 			Value   string   `xml:"value,attr"`
 		} `xml:"setting"`
+		Market []xmlMarketConfig `xml:"market"`
+	}
+	var nBuildTime int = 0
+	var nCompressWorkers int = 0
+	var nRealFileKeep int = nDefaultRealFileKeep
+	var nRealFileTTL int = int(nDefaultRealFileTTL / time.Second)
+	var sSyncFolder string
+	var mapDataSrcCfg map[string]DataSourceConfig = make(map[string]DataSourceConfig)
+	var lstLiveResources []LiveResourceConfig
+	var mapMarkets map[string]*MarketConfig = make(map[string]*MarketConfig)
+
+	for _, sMkID := range BuiltinMarkets {
+		mapMarkets[sMkID] = &MarketConfig{MkID: sMkID, Sessions: DefaultSessions}
+	}
+
+	/////////////////////////// 通过记录格式注册表检查一个数据源(市场编号 + 数据类型 + 数据源目录) /////////////////
+	fnNewDataSource := func(sMkID string, sDataType string, sFolder string) (string, DataSourceConfig, bool) {
+		sMkID, sDataType = strings.ToLower(sMkID), strings.ToLower(strings.TrimSpace(sDataType))
+		sResType := sMkID + "." + sDataType // 资源类型(如，sse.m60 / szse.d1 / hkse.shase_rzrq_by_date)
+		objFormat, ok := LookupRecordFormat(sResType)
+		if false == ok { // 未注册的资源类型: 加载失败(不要等到生成资源时才发现)
+			log.Println("[ERR] FileScheduler.loadConfiguration() : [Xml.Setting] unknown resource type (no record format registered) : ", sResType)
+			return sResType, DataSourceConfig{}, false
+		}
+
+		objMarket, bMarketDefined := mapMarkets[sMkID]
+		if 0 == len(objFormat.MkIDs) && false == bMarketDefined { // 不限定市场的记录格式(如k线): 市场需要先用<market>定义
+			log.Println("[ERR] FileScheduler.loadConfiguration() : [Xml.Setting] market is not defined : ", sResType)
+			return sResType, DataSourceConfig{}, false
+		}
+
+		var lstSessions TradingSessions
+		var refHolidays *HolidayCalendar
+		if true == bMarketDefined {
+			lstSessions, refHolidays = objMarket.Sessions, objMarket.Holidays
+		}
+
+		if true == objFormat.NeedSessions && 0 == len(lstSessions) { // 如分钟k线: 需要按市场的交易时段切分
+			log.Println("[ERR] FileScheduler.loadConfiguration() : [Xml.Setting] trading sessions of market are not defined : ", sResType)
+			return sResType, DataSourceConfig{}, false
+		}
+
+		return sResType, DataSourceConfig{MkID: sMkID, Folder: strings.Replace(sFolder, "\\", "/", -1), Sessions: lstSessions, Holidays: refHolidays}, true
+	}
+
+	/////////////////////////// 登记一个实时资源(别名 + 数据源 + 刷新间隔 + 生成时间窗口) /////////////////
+	fnAddLiveResource := func(sMkID string, refXmlLive *xmlLiveConfig) bool {
+		var objLive LiveResourceConfig
+		var bIsOk bool
+
+		if err := objLive.load(refXmlLive); nil != err {
+			log.Println("[WARN] FileScheduler.loadConfiguration() : [Xml.Live]", err.Error())
+			return false
+		}
+
+		if objLive.ResType, objLive.DataSrc, bIsOk = fnNewDataSource(sMkID, refXmlLive.DataType, refXmlLive.Folder); false == bIsOk {
+			return false
+		}
+
+		for _, objOther := range lstLiveResources {
+			if objOther.AliasURI() == objLive.AliasURI() {
+				log.Println("[WARN] FileScheduler.loadConfiguration() : [Xml.Live] duplicate live resource : ", objLive.AliasURI())
+				return false
+			}
+		}
+
+		lstLiveResources = append(lstLiveResources, objLive)
+		log.Printf("[INF] FileScheduler.loadConfiguration() : [Xml.Live] %s : %s %s, interval = %v, window = %v", objLive.AliasURI(), objLive.ResType, objLive.DataSrc.Folder, objLive.Interval, objLive.Window)
+
+		return true
+	}
+
+	/////////////////////////// 登记一个历史资源的数据源 /////////////////
+	fnAddDataSource := func(sMkID string, sDataType string, sFolder string) bool {
+		if "real_m1" == strings.ToLower(sDataType) { // 旧的配置方式: 今天内的实时1分钟线
+			return fnAddLiveResource(sMkID, &xmlLiveConfig{Name: "MIN1_TODAY", DataType: sDataType, Folder: sFolder})
+		}
+
+		sResType, objDataSrc, bIsOk := fnNewDataSource(sMkID, sDataType, sFolder)
+		if false == bIsOk {
+			return false
+		}
+
+		if objMarket, ok := mapMarkets[objDataSrc.MkID]; true == ok {
+			objMarket.DataTypes = append(objMarket.DataTypes, sResType[len(objDataSrc.MkID)+1:])
+		}
+
+		mapDataSrcCfg[sResType] = objDataSrc // 历史数据资源（非实时）部分的数据源存放目录及相关信息设定，并构建到资源源对象中(mapDataSrcCfg)
+		log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting]", sResType, objDataSrc.MkID, objDataSrc.Folder)
+
+		return true
 	}
 
 	sXmlContent, err := ioutil.ReadFile(pSelf.XmlCfgPath)
 	if err != nil {
-		log.Println("[WARN] FileScheduler.Active() : cannot locate configuration file, path: ", pSelf.XmlCfgPath)
+		log.Println("[WARN] FileScheduler.loadConfiguration() : cannot locate configuration file, path: ", pSelf.XmlCfgPath)
 		return false
 	}
 
 	err = xml.Unmarshal(sXmlContent, &objCfg)
 	if err != nil {
-		log.Println("[WARN] FileScheduler.Active() : cannot parse xml configuration file, error: ", err.Error())
+		log.Println("[WARN] FileScheduler.loadConfiguration() : cannot parse xml configuration file, error: ", err.Error())
 		return false
 	}
 
+	/////////////////////////// 遍历从xml配置中加载的市场定义 /////////////////////////////
+	log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] configuration file version: ", objCfg.Version)
+	for i := range objCfg.Market {
+		sMkID := strings.ToLower(strings.TrimSpace(objCfg.Market[i].ID))
+		if "" == sMkID || strings.ContainsAny(sMkID, "./\\") {
+			log.Println("[WARN] FileScheduler.loadConfiguration() : [Xml.Market] invalid market id : ", objCfg.Market[i].ID)
+			return false
+		}
+
+		objMarket, ok := mapMarkets[sMkID]
+		if false == ok {
+			objMarket = &MarketConfig{MkID: sMkID}
+			mapMarkets[sMkID] = objMarket
+		}
+
+		if false == objMarket.load(&objCfg.Market[i], filepath.Dir(pSelf.XmlCfgPath)) {
+			return false
+		}
+
+		for _, objDataType := range objCfg.Market[i].DataType {
+			if false == fnAddDataSource(sMkID, objDataType.Name, objDataType.Folder) {
+				return false
+			}
+		}
+
+		for j := range objCfg.Market[i].Live {
+			if false == fnAddLiveResource(sMkID, &objCfg.Market[i].Live[j]) {
+				return false
+			}
+		}
+	}
+
 	/////////////////////////// 遍历从xml配置中加载的objCfg结构，设定各参数 /////////////////////////////
-	log.Println("[INF] FileScheduler.Active() : [Xml.Setting] configuration file version: ", objCfg.Version)
-	pSelf.DataSrcCfg = make(map[string]DataSourceConfig)
 	for _, objSetting := range objCfg.Setting {
 		switch strings.ToLower(objSetting.Name) {
 		case "buildtime": // 历史资源文件生成时间(日线、分钟线、权息信息等)
-			pSelf.BuildTime, _ = strconv.Atoi(objSetting.Value)
-			log.Println("[INF] FileScheduler.Active() : [Xml.Setting] Build Time: ", pSelf.BuildTime)
+			nBuildTime, _ = strconv.Atoi(objSetting.Value)
+			log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] Build Time: ", nBuildTime)
+		case "compressworkers": // 压缩工作协程数(0为CPU核数)
+			if nCompressWorkers, err = strconv.Atoi(objSetting.Value); nil != err || nCompressWorkers < 0 {
+				log.Println("[WARN] FileScheduler.loadConfiguration() : [Xml.Setting] invalid CompressWorkers : ", objSetting.Value)
+				return false
+			}
+			log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] Compress Workers: ", nCompressWorkers)
+		case "realfilegenerations": // 实时资源文件保留的代数(含当前一代)
+			if nRealFileKeep, err = strconv.Atoi(objSetting.Value); nil != err || nRealFileKeep < 1 {
+				log.Println("[WARN] FileScheduler.loadConfiguration() : [Xml.Setting] invalid RealFileGenerations : ", objSetting.Value)
+				return false
+			}
+			log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] Real File Generations: ", nRealFileKeep)
+		case "realfilettl": // 实时资源文件的最短保留时间(秒，生成后)
+			if nRealFileTTL, err = strconv.Atoi(objSetting.Value); nil != err || nRealFileTTL < 1 {
+				log.Println("[WARN] FileScheduler.loadConfiguration() : [Xml.Setting] invalid RealFileTTL : ", objSetting.Value)
+				return false
+			}
+			log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] Real File TTL(seconds): ", nRealFileTTL)
 		case "syncfolder": // 生成资源文件存在的根目录
-			pSelf.SyncFolder = strings.Replace(objSetting.Value, "\\", "/", -1)
-			log.Println("[INF] FileScheduler.Active() : [Xml.Setting] SyncFolder: ", pSelf.SyncFolder)
-		case "sse.real_m1": // 上海，实时1分钟线数据源存放目录
-			pSelf.SHRealM1Folder = strings.Replace(objSetting.Value, "\\", "/", -1)
-			log.Println("[INF] FileScheduler.Active() : [Xml.Setting] Real Data Folder(SH/M1): ", pSelf.SHRealM1Folder)
-		case "szse.real_m1": // 深圳，实时1分钟线数据源存放目录
-			pSelf.SZRealM1Folder = strings.Replace(objSetting.Value, "\\", "/", -1)
-			log.Println("[INF] FileScheduler.Active() : [Xml.Setting] Real Data Folder(SZ/M1): ", pSelf.SZRealM1Folder)
-		case "sse.coderange": // 上海，参与历史资源数据压缩的合法代码段设定
-			var objRange CodeRangeStruct
-			lstRangeStr := strings.Split(objSetting.Value, "~")
-			objRange.Fill(lstRangeStr[0], lstRangeStr[1])
-			pSelf.codeRangeOfSH = append(pSelf.codeRangeOfSH, objRange)
-			log.Printf("[INF] FileScheduler.Active() : [Xml.Setting] SSE.coderange: [%d ~ %d]", objRange.StartVal, objRange.EndVal)
-		case "szse.coderange": // 深圳，参与历史资源数据压缩的合法代码段设定
-			var objRange CodeRangeStruct
-			lstRangeStr := strings.Split(objSetting.Value, "~")
-			objRange.Fill(lstRangeStr[0], lstRangeStr[1])
-			pSelf.codeRangeOfSZ = append(pSelf.codeRangeOfSZ, objRange)
-			log.Printf("[INF] FileScheduler.Active() : [Xml.Setting] SZSE.coderange: [%d ~ %d]", objRange.StartVal, objRange.EndVal)
-		default: // 历史数据资源（非实时）部分的数据源存放目录及相关信息设定，并构建到资源源对象中(pSelf.DataSrcCfg)
-			sResType := strings.ToLower(objSetting.Name) // 资源类型(如，SSE.m60 / SZSE.d1 / HKSE.shase_rzrq_by_date)
-			if len(strings.Split(objSetting.Name, ".")) <= 1 {
-				log.Println("[WARNING] FileScheduler.Active() : [Xml.Setting] Ignore -> ", objSetting.Name)
+			sSyncFolder = strings.Replace(objSetting.Value, "\\", "/", -1)
+			log.Println("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] SyncFolder: ", sSyncFolder)
+		case "sse.coderange", "szse.coderange": // 沪深(旧的配置方式)，参与历史资源数据压缩的合法代码段设定
+			sMkID := strings.Split(strings.ToLower(objSetting.Name), ".")[0]
+			if err := mapMarkets[sMkID].CodeFilter.Add("range", objSetting.Value); nil != err {
+				log.Printf("[WARN] FileScheduler.loadConfiguration() : [Xml.Setting] invalid %s : %s", objSetting.Name, objSetting.Value)
+				return false
+			}
+			log.Printf("[INF] FileScheduler.loadConfiguration() : [Xml.Setting] %s: [%s]", objSetting.Name, objSetting.Value)
+		default: // 资源类型(如，SSE.m60 / SZSE.d1 / HKSE.shase_rzrq_by_date)的数据源存放目录
+			lstResType := strings.Split(objSetting.Name, ".")
+			if len(lstResType) <= 1 {
+				log.Println("[WARNING] FileScheduler.loadConfiguration() : [Xml.Setting] Ignore -> ", objSetting.Name)
 				continue
 			}
 
-			objSetting.Value = strings.Replace(objSetting.Value, "\\", "/", -1)
-			pSelf.DataSrcCfg[sResType] = DataSourceConfig{MkID: strings.ToLower(strings.Split(objSetting.Name, ".")[0]), Folder: objSetting.Value}
-			log.Println("[INF] FileScheduler.Active() : [Xml.Setting]", sResType, pSelf.DataSrcCfg[sResType].MkID, pSelf.DataSrcCfg[sResType].Folder)
+			if false == fnAddDataSource(lstResType[0], strings.Join(lstResType[1:], "."), objSetting.Value) {
+				return false
+			}
 		}
 	}
 
-	///////////////////////////// 启动时先压缩一次待下载资源文件(若，今日内已经压缩过，则跳空) ////////////////////////////
-	if false == pSelf.compressHistoryResource("") {
-		return false
-	}
+	/////////////////////////// 在资源生成锁内替换当前配置(等待进行中的资源生成结束) /////////////////////////////
+	pSelf.objBuildLock.Lock()
+	defer pSelf.objBuildLock.Unlock()
 
-	///////////////////////////// 加载资源列表xml字符串 + 并从xml中恢复出资源列表结构对象 ////////////////////////////////
-	if false == pSelf.RefSyncSvr.LoadResList() {
-		return false
+	if true == bFirstTime {
+		pSelf.SyncFolder = sSyncFolder
+	} else if sSyncFolder != pSelf.SyncFolder {
+		log.Println("[WARN] FileScheduler.loadConfiguration() : SyncFolder cannot be changed without restart, keep : ", pSelf.SyncFolder)
 	}
 
-	log.Println("[INF] FileScheduler.compressHistoryResource() : [OK] Resources List Builded! ......")
-	///////////////////////////// 启动成功， 开辅助线程： 定时FTP资源资源 + 实时资源 压缩线程 ////////////////////////////
-	go pSelf.allResourcesRebuilderThread()
+	pSelf.BuildTime = nBuildTime
+	pSelf.CompressWorkers = nCompressWorkers
+	pSelf.LiveResources = lstLiveResources
+	pSelf.mapMarkets = mapMarkets
+	pSelf.DataSrcCfg = mapDataSrcCfg
+	if nil != pSelf.RefSyncSvr {
+		pSelf.RefSyncSvr.SetRealFileRetention(nRealFileKeep, time.Duration(nRealFileTTL)*time.Second)
+	}
 
 	return true
 }
 
-///< ----------------------------- [Private 方法] ----------------------------------------
+/**
+* @brief		判断是否已经收到停止通知
+*/
+func (pSelf *FileScheduler) isStopping() bool {
+	select {
+	case <-pSelf.objStopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+/**
+* @brief		休眠一段时间，期间收到停止通知时立即返回
+* @return		true		收到停止通知
+*/
+func (pSelf *FileScheduler) sleepOrStop(nDuration time.Duration) bool {
+	select {
+	case <-pSelf.objStopChan:
+		return true
+	case <-time.After(nDuration):
+		return false
+	}
+}
+
 /**
 * @brief		资源自动生成线程函数
 * @detail		历史资源 + 实时资源的生成线程：
 				1) 历史部分： 午夜生成
 				2) FTP资源定时生成: 定时生成
-				3) 实时数据资源生成(比如，今日内的1分钟线): 盘中每n分钟生成一次
+				3) 实时数据资源生成(比如，今日内的1分钟线): 盘中每n分钟生成一次(各实时资源按配置的刷新间隔)
 */
 func (pSelf *FileScheduler) allResourcesRebuilderThread() {
-	for i := 0; i < 999; i++ {
-		time.Sleep(time.Second * 15)                          // Sleep 4 a while
+	defer close(pSelf.objThreadDone)
+
+	for {
+		if true == pSelf.sleepOrStop(time.Second*15) { // Sleep 4 a while
+			return
+		}
+
 		pSelf.compressHistoryResource("")                     // 每天午夜生成一次历史数据
 		if true == SyncQLFtpFilesInPeriodTime(64000, 65000) { // 定时从FTP下载资源
 			pSelf.compressHistoryResource("HKSE") // 定时压缩从FTP下载的资源
-			time.Sleep(time.Second * 60 * 2)
+			if true == pSelf.sleepOrStop(time.Second*60*2) {
+				return
+			}
 		}
 
 		if true == SyncQLFtpFilesInPeriodTime(90500, 91000) { // 定时从FTP下载资源
 			pSelf.compressHistoryResource("HKSE") // 定时压缩从FTP下载的资源
-			time.Sleep(time.Second * 60 * 2)
+			if true == pSelf.sleepOrStop(time.Second*60*2) {
+				return
+			}
 		}
 
-		if i%(4*5) == 0 {
-			i = 0
-			pSelf.rebuildRealMinute1() // 每n分钟压缩一次今日内的实时1分钟线资源
+		if true == pSelf.isStopping() {
+			return
 		}
+
+		pSelf.rebuildLiveResources(time.Now()) // 按各实时资源的刷新间隔，压缩今日内的实时资源
 	}
 }
 
@@ -292,9 +551,16 @@ func (pSelf *FileScheduler) allResourcesRebuilderThread() {
 										空串，表示做全类型的资源压缩
 * @return		true					成功
 				false					失败
-* @note 		当做全类型压缩时，需要判断今日是否已经做过压缩，如果已经做过，则跳空
+* @note 		当做全类型压缩时，需要判断今日是否已经做过压缩，如果已经做过，则跳空;
+				收到停止通知时，在当前资源类型压缩完成后中止，不更新资源列表和status.dat;
+				增量压缩: 各资源类型只重新生成输入有变化的压缩文件，其它压缩文件沿用上次的构建结果(见 IncrementalBuild);
+				并行压缩: 各资源类型并行压缩，共用一个压缩工作池(工作协程数由配置项 CompressWorkers 设定);
+				分代发布: 新生成的压缩文件先写入暂存目录，全部资源类型压缩成功后，才与新的资源列表一起发布(见 FileSyncServer.PublishGeneration())
 */
 func (pSelf *FileScheduler) compressHistoryResource(sSpecifyResType string) bool {
+	pSelf.objBuildLock.Lock()
+	defer pSelf.objBuildLock.Unlock()
+
 	sSpecifyResType = strings.ToLower(sSpecifyResType)
 	objNowTime := time.Now()
 	objBuildTime := time.Date(objNowTime.Year(), objNowTime.Month(), objNowTime.Day(), pSelf.BuildTime/10000, pSelf.BuildTime/100%100, pSelf.BuildTime%100, 0, time.Local)
@@ -325,25 +591,71 @@ func (pSelf *FileScheduler) compressHistoryResource(sSpecifyResType string) bool
 		defer pprof.StopCPUProfile()*/
 		/////////////////////////////////////////////////////////////
 		var objNewResList ResourceList
-		var objCompressor Compressor = Compressor{TargetFolder: pSelf.SyncFolder}
-		log.Printf("[INF] FileScheduler.compressHistoryResource() : (BuildTime=%s) Building Sync Resources ......", time.Now().Format("2006-01-02 15:04:05"))
-		/////////////////////// iterate data source configuration && compress quotation files ////////
+		var objPool *WorkerPool = NewWorkerPool(pSelf.CompressWorkers)
+		var sStagingFolder string = stagingFolderOf(pSelf.SyncFolder)                                                                                           // 新一代压缩文件的暂存目录
+		var objCompressor Compressor = Compressor{TargetFolder: pSelf.SyncFolder, StagingFolder: sStagingFolder, StateFolder: sBuildStateFolder, Pool: objPool} // 增量压缩: 只重新生成输入有变化的压缩文件
+		var mapResults map[string][]ResDownload = make(map[string][]ResDownload)                                                                                // 各资源类型的压缩结果
+		var lstResTypes []string                                                                                                                                // 压缩成功的资源类型
+		var objResultLock sync.Mutex                                                                                                                            // 压缩结果锁
+		var objWaitGroup sync.WaitGroup                                                                                                                         // 等待各资源类型压缩完成
+		var chTypeSlots chan bool = make(chan bool, objPool.Size())                                                                                             // 同时压缩的资源类型数(不超过工作协程数)
+		var bIsAborted, bIsFailed bool = false, false
+		os.RemoveAll(sStagingFolder) // 清除上次中止/失败时留下的暂存文件(构建状态中，未发布的压缩文件与发布目录中的不一致，会重新生成)
+		log.Printf("[INF] FileScheduler.compressHistoryResource() : (BuildTime=%s) Building Sync Resources (workers=%d) ......", time.Now().Format("2006-01-02 15:04:05"), objPool.Size())
+		/////////////////////// iterate data source configuration && compress quotation files (different resource types in parallel) ////////
 		for sResType, objDataSrcCfg := range pSelf.DataSrcCfg {
 			sDataType := strings.ToLower(sResType[:strings.Index(sResType, ".")])
-			if "" == sSpecifyResType || sDataType == sSpecifyResType {
+			if "" != sSpecifyResType && sDataType != sSpecifyResType {
+				continue
+			}
+
+			chTypeSlots <- true
+			if true == pSelf.isStopping() {
+				<-chTypeSlots
+				bIsAborted = true
+				break
+			}
+
+			objWaitGroup.Add(1)
+			go func(sResType string, objDataSrcCfg DataSourceConfig) {
+				defer objWaitGroup.Done()
 				lstRes, bIsOk := objCompressor.XCompress(sResType, &objDataSrcCfg, pSelf.GetCodeRangeFilter(sResType))
+				<-chTypeSlots
+
+				objResultLock.Lock()
+				defer objResultLock.Unlock()
 				if true == bIsOk {
 					/////////////// record resource path && MD5 which has been compressed
-					objNewResList.Download = append(objNewResList.Download, lstRes...)
+					mapResults[sResType] = lstRes
+					lstResTypes = append(lstResTypes, sResType)
 					log.Println("[INF] FileScheduler.compressHistoryResource() : [OK] TarFile : ", objDataSrcCfg.Folder)
 				} else {
+					bIsFailed = true
 					log.Println("[WARN] FileScheduler.compressHistoryResource() : [FAILURE] TarFile : ", objDataSrcCfg.Folder)
-					return false
 				}
-			}
+			}(sResType, objDataSrcCfg)
+		}
+
+		objWaitGroup.Wait()
+		if true == bIsAborted {
+			log.Println("[WARN] FileScheduler.compressHistoryResource() : [ABORT] scheduler is stopping, resources list is not updated.")
+			return false
+		}
+
+		if true == bIsFailed {
+			return false
+		}
+
+		sort.Strings(lstResTypes) // 资源列表按资源类型排序(各资源类型内部保持时间顺序)
+		for _, sResType := range lstResTypes {
+			objNewResList.Download = append(objNewResList.Download, mapResults[sResType]...)
 		}
 
-		if "" == sSpecifyResType { //// 全类型资源压缩后： 更新资源列表 + 存盘记录更新日期
+		if "" == sSpecifyResType { //// 全类型资源压缩后： 发布新一代资源文件 + 替换资源列表 + 存盘记录更新日期
+			/////////////////////// Publish rebuild data && Set 2 Response obj. /////////////////////
+			if false == pSelf.RefSyncSvr.PublishGeneration(pSelf.SyncFolder, sStagingFolder, &objNewResList, false) {
+				return false
+			}
 			//////////////////////// Save status 2 ./status.dat /////////////////////////////////////
 			objStatusSaver, err := os.Create("./status.dat")
 			if nil != err {
@@ -352,11 +664,11 @@ func (pSelf *FileScheduler) compressHistoryResource(sSpecifyResType string) bool
 				objStatusSaver.Write([]byte(objNowTime.Format("2006-01-02 15:04:05")))
 				objStatusSaver.Close()
 			}
-			/////////////////////// Set rebuild data 2 Response obj. ////////////////////////////////
-			pSelf.RefSyncSvr.SetResList(&objNewResList)
 			log.Println("[INF] FileScheduler.compressHistoryResource() : [OK] Sync Resources(All) Builded! ......")
-		} else { /////////////////////// 指定类型压缩后： 只更新资源列表
-			pSelf.RefSyncSvr.UpdateResList(&objNewResList)
+		} else { /////////////////////// 指定类型压缩后： 发布新一代资源文件 + 只更新资源列表
+			if false == pSelf.RefSyncSvr.PublishGeneration(pSelf.SyncFolder, sStagingFolder, &objNewResList, true) {
+				return false
+			}
 			log.Printf("[INF] FileScheduler.compressHistoryResource() : [OK] Sync Resources(SpecifyType) Builded! Count = %d......", len(objNewResList.Download))
 		}
 	}
@@ -365,62 +677,63 @@ func (pSelf *FileScheduler) compressHistoryResource(sSpecifyResType string) bool
 }
 
 /**
- * @brief		沪深今日内的实时1分钟线压缩函数
- * @detail		只在 "盘中" 或者 "今日内实时数据尚未做过一次压缩" 的情况下，进行实时的压缩
+ * @brief		实时资源压缩函数
+ * @detail		各实时资源只在 "交易日的生成时间窗口内(配置的时间窗口，或按市场的交易时段: 开盘 ~ 收盘后n分钟)" 或者 "尚未发布过" 的情况下，
+ 				每过刷新间隔压缩一次
+ * @param[in]	objNow			当前时间
+ * @note		周末和休市日(按各市场的休市日历)不做实时压缩
  */
-func (pSelf *FileScheduler) rebuildRealMinute1() {
-	var objToday time.Time = time.Now()
-	var nToday int = objToday.Year()*10000 + int(objToday.Month())*100 + objToday.Day()
-	var nNowT int = objToday.Hour()*10000 + objToday.Minute()*100 + objToday.Second()
-	var bInRebuildPeriod bool = false
-	// 判断是否需要做压缩
-	if (nNowT >= 93000 && nNowT <= 153000) || (pSelf.RefSyncSvr.GetSHRealMin1File() == "" || pSelf.RefSyncSvr.GetSZRealMin1File() == "") {
-		bInRebuildPeriod = true
-	}
-	// 压缩今日上海1分钟线
-	if len(pSelf.SHRealM1Folder) > 0 && true == bInRebuildPeriod { // minute 1 lines of shanghai
-		var nRetTime int = objToday.Hour()*100 + objToday.Minute()
-		var objCompressor Compressor = Compressor{TargetFolder: pSelf.SyncFolder}
-		var objDataSrcCfg = DataSourceConfig{MkID: "sse", Folder: pSelf.SHRealM1Folder}
-
-		_, bIsOk := objCompressor.XCompress("sse.real_m1", &objDataSrcCfg, pSelf.GetCodeRangeFilter("sse."))
-		if true == bIsOk {
-			log.Println("[INF] FileScheduler.rebuildRealMinute1() : [OK] TarFile : ", objDataSrcCfg.Folder)
-			sSrcFile := fmt.Sprintf("%s%d", filepath.Join(pSelf.SyncFolder, "SSE/MIN1_TODAY/MIN1_TODAY."), nToday)
-			sSrcFile = strings.Replace(sSrcFile, "\\", "/", -1)
-			sDestFile := fmt.Sprintf("%s.%d", sSrcFile, nRetTime)
-
-			err := os.Rename(sSrcFile, sDestFile)
-			if err != nil {
-				log.Println("[WARN] FileScheduler.rebuildRealMinute1() : [ERROR] cannot rename file : ", sSrcFile)
-			} else {
-				pSelf.RefSyncSvr.SetSHRealMin1File(sDestFile)
-			}
-		} else {
-			log.Println("[WARN] FileScheduler.rebuildRealMinute1() : [FAILURE] TarFile : ", objDataSrcCfg.Folder)
-		}
+func (pSelf *FileScheduler) rebuildLiveResources(objNow time.Time) {
+	pSelf.objBuildLock.Lock()
+	defer pSelf.objBuildLock.Unlock()
+
+	if nil == pSelf.mapLiveBuilt {
+		pSelf.mapLiveBuilt = make(map[string]time.Time)
 	}
-	// 压缩今日深圳1分钟线
-	if len(pSelf.SZRealM1Folder) > 0 && true == bInRebuildPeriod { // minute 1 lines of shenzheng
-		var nRetTime int = objToday.Hour()*100 + objToday.Minute()
-		var objCompressor Compressor = Compressor{TargetFolder: pSelf.SyncFolder}
-		var objDataSrcCfg = DataSourceConfig{MkID: "szse", Folder: pSelf.SZRealM1Folder}
-
-		_, bIsOk := objCompressor.XCompress("szse.real_m1", &objDataSrcCfg, pSelf.GetCodeRangeFilter("szse."))
-		if true == bIsOk {
-			log.Println("[INF] FileScheduler.rebuildRealMinute1() : [OK] TarFile : ", objDataSrcCfg.Folder)
-			sSrcFile := fmt.Sprintf("%s%d", filepath.Join(pSelf.SyncFolder, "SZSE/MIN1_TODAY/MIN1_TODAY."), nToday)
-			sSrcFile = strings.Replace(sSrcFile, "\\", "/", -1)
-			sDestFile := fmt.Sprintf("%s.%d", sSrcFile, nRetTime)
-
-			err := os.Rename(sSrcFile, sDestFile)
-			if err != nil {
-				log.Println("[WARN] FileScheduler.rebuildRealMinute1() : [ERROR] cannot rename file : ", sSrcFile)
-			} else {
-				pSelf.RefSyncSvr.SetSZRealMin1File(sDestFile)
-			}
-		} else {
-			log.Println("[WARN] FileScheduler.rebuildRealMinute1() : [FAILURE] TarFile : ", objDataSrcCfg.Folder)
+
+	for i := range pSelf.LiveResources {
+		refLive := &pSelf.LiveResources[i]
+		_, bPublished := pSelf.RefSyncSvr.GetLiveFile(refLive.AliasURI())
+		if false == refLive.isDue(objNow, pSelf.mapLiveBuilt[refLive.AliasURI()], bPublished) {
+			continue
 		}
+
+		pSelf.mapLiveBuilt[refLive.AliasURI()] = objNow
+		pSelf.rebuildLiveResource(refLive, objNow)
+	}
+}
+
+/**
+ * @brief		压缩一个实时资源，并发布为新的一代文件
+ * @detail		数据源中当前交易日的数据(含盘中未完成的部分) ---> <SyncFolder>/<市场编号>/<别名>/<别名>.<date> ---> 改名为 .<date>.<hhmm> 后发布
+ * @param[in]	refLive			实时资源
+ * @param[in]	objNow			当前时间
+ * @return		true			成功
+ 				false			失败(今天还没有数据时，也不发布)
+ */
+func (pSelf *FileScheduler) rebuildLiveResource(refLive *LiveResourceConfig, objNow time.Time) bool {
+	var nRetTime int = objNow.Hour()*100 + objNow.Minute()
+	var objCompressor Compressor = Compressor{TargetFolder: pSelf.SyncFolder, Pool: NewWorkerPool(pSelf.CompressWorkers)}
+	var objDataSrcCfg DataSourceConfig = refLive.DataSrc
+
+	objDataSrcCfg.DestPrefix = refLive.Name + "/" + refLive.Name + "."
+	objDataSrcCfg.LiveDate = objDataSrcCfg.Sessions.TradingDayOf(dateOf(objNow), objNow.Hour()*10000+objNow.Minute()*100+objNow.Second(), objDataSrcCfg.Holidays) // 当前的交易日(夜盘属于下一个交易日)
+	lstRes, bIsOk := objCompressor.XCompress(refLive.ResType, &objDataSrcCfg, pSelf.GetCodeRangeFilter(refLive.ResType))
+	if false == bIsOk || 0 == len(lstRes) {
+		log.Println("[WARN] FileScheduler.rebuildLiveResource() : [FAILURE] TarFile : ", refLive.AliasURI(), objDataSrcCfg.Folder)
+		return false
+	}
+
+	objRes := lstRes[len(lstRes)-1]
+	sDestFile := fmt.Sprintf("%s.%d", objRes.URI, nRetTime)
+	if err := os.Rename(objRes.URI, sDestFile); err != nil {
+		log.Println("[WARN] FileScheduler.rebuildLiveResource() : [ERROR] cannot rename file : ", objRes.URI, err.Error())
+		return false
 	}
+
+	log.Println("[INF] FileScheduler.rebuildLiveResource() : [OK] TarFile : ", refLive.AliasURI(), "--->", sDestFile)
+	objRes.URI = sDestFile
+	pSelf.RefSyncSvr.SetLiveFile(refLive.AliasURI(), objRes)
+
+	return true
 }
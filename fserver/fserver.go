@@ -8,13 +8,24 @@ package fserver
 
 import (
 	"./github.com/astaxie/beego/session"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -38,11 +49,16 @@ func init() {
  * @author		barry
  */
 type ResDownload struct {
-	XMLName xml.Name `xml:"download"`
-	TYPE    string   `xml:"type,attr"`
-	URI     string   `xml:"uri,attr"`
-	MD5     string   `xml:"md5,attr"`
-	UPDATE  string   `xml:"update,attr"`
+	XMLName      xml.Name `xml:"download" json:"-"`
+	TYPE         string   `xml:"type,attr" json:"type"`
+	URI          string   `xml:"uri,attr" json:"uri"`
+	MD5          string   `xml:"md5,attr" json:"md5"`                           // 资源文件的MD5(兼容旧版本客户端)
+	SHA256       string   `xml:"sha256,attr,omitempty" json:"sha256,omitempty"` // 资源文件的SHA256(新版本客户端优先使用)
+	SIZE         int64    `xml:"size,attr,omitempty" json:"size,omitempty"`     // 资源文件的长度(字节)
+	UPDATE       string   `xml:"update,attr" json:"update"`
+	STATUS       string   `xml:"status,attr,omitempty" json:"status,omitempty"`             // 增量清单中的变化类型: added / changed / removed
+	Removed      bool     `xml:"removed,attr,omitempty" json:"removed,omitempty"`           // 墓碑项: 资源已经删除(不可下载，UPDATE为删除时间)
+	SupersededBy string   `xml:"supersededby,attr,omitempty" json:"supersededby,omitempty"` // 墓碑项: 取代该资源的资源URI(如合并后的年资源包)
 }
 
 /**
@@ -52,39 +68,158 @@ type ResDownload struct {
  * @author		barry
  */
 type ResourceList struct {
-	XMLName  xml.Name      `xml:"resource"`
-	Download []ResDownload `xml:"download"`
+	XMLName  xml.Name      `xml:"resource" json:"-"`
+	Version  uint64        `xml:"version,attr,omitempty" json:"version"`       // 清单版本号(每次重新生成清单时递增)
+	Since    uint64        `xml:"since,attr,omitempty" json:"since,omitempty"` // 增量清单的基准版本号(为0时，是全量清单)
+	Download []ResDownload `xml:"download" json:"download"`
+}
+
+/**
+ * @Class 		ResSnapshot
+ * @brief		资源清单快照(只读)
+ * @detail		资源列表对象 + xml串 + uri索引 + 各实时资源的当前文件，整体原子发布，
+ 				网络请求每次只取一个快照，保证看到的资源清单是一致的
+ * @note		发布后不可再修改，更新时总是生成新的快照
+ * @author		barry
+ */
+type ResSnapshot struct {
+	objResourceList ResourceList           // 待下发的资源文件的清单列表(对象)
+	lstHistory      []ResourceList         // 之前若干个版本的资源清单(旧->新)，用于生成增量清单
+	sResponseList   string                 // 待下发的资源文件的清单列表(xml字符串)
+	sResponseSign   string                 // xml资源列表应答体(xml头 + sResponseList)的签名
+	mapURI2Res      map[string]ResDownload // uri -> 资源描述项 的索引
+	mapLiveFiles    map[string]ResDownload // 实时资源的别名URI -> 当前一代文件(每n分钟生成一次，供quoteclientapi下载)
+	refGeneration   *ResGeneration         // 快照所属的一代资源文件(统计正在下载这一代文件的请求)
+}
+
+/**
+ * @brief		在资源列表中查找某uri对应的资源描述项
+ * @param[in]	sURI		资源URI路径
+ * @return		资源描述项 + 是否找到
+ */
+func (pSelf *ResSnapshot) findResource(sURI string) (ResDownload, bool) {
+	objRes, ok := pSelf.mapURI2Res[sURI]
+
+	return objRes, ok
+}
+
+/**
+ * @brief		复制一份快照(用于生成新快照)
+ * @note		资源列表的切片和uri索引，由调用方整体替换，不在原快照上修改;
+ 				新快照沿用原快照的一代资源文件(只有发布新一代资源文件时才更换)
+ */
+func (pSelf *ResSnapshot) clone() *ResSnapshot {
+	objNewSnapshot := *pSelf
+	if nil == objNewSnapshot.refGeneration {
+		objNewSnapshot.refGeneration = &ResGeneration{}
+	}
+
+	return &objNewSnapshot
+}
+
+/**
+ * @brief		查找某一个历史版本的资源清单
+ * @param[in]	nVersion		版本号
+ * @return		资源清单 + 是否找到(已经超出保留的历史版本数时，找不到)
+ */
+func (pSelf *ResSnapshot) findHistory(nVersion uint64) (*ResourceList, bool) {
+	if nVersion == pSelf.objResourceList.Version {
+		return &pSelf.objResourceList, true
+	}
+
+	for i := range pSelf.lstHistory {
+		if pSelf.lstHistory[i].Version == nVersion {
+			return &pSelf.lstHistory[i], true
+		}
+	}
+
+	return nil, false
+}
+
+/**
+ * @brief		发布新版本前，把当前版本的资源清单放入历史记录
+ * @note		新建历史切片，不修改已发布快照的历史记录; 最多保留 nManifestHistorySize 个版本
+ */
+func (pSelf *ResSnapshot) pushHistory() {
+	if 0 == pSelf.objResourceList.Version {
+		return
+	}
+
+	lstHistory := append([]ResourceList(nil), pSelf.lstHistory...)
+	lstHistory = append(lstHistory, pSelf.objResourceList)
+	if len(lstHistory) > nManifestHistorySize {
+		lstHistory = lstHistory[len(lstHistory)-nManifestHistorySize:]
+	}
+
+	pSelf.lstHistory = lstHistory
+}
+
+/**
+ * @brief		设置资源列表(并生成uri索引)
+ */
+func (pSelf *ResSnapshot) setResList(refResList *ResourceList, sResponseList string) {
+	pSelf.objResourceList = ResourceList{Version: refResList.Version, Download: append([]ResDownload(nil), refResList.Download...)}
+	pSelf.sResponseList = sResponseList
+	pSelf.sResponseSign = ""
+	pSelf.mapURI2Res = make(map[string]ResDownload, len(refResList.Download))
+	for _, objRes := range refResList.Download {
+		if true == objRes.Removed { // 墓碑项不可下载
+			continue
+		}
+
+		if _, ok := pSelf.mapURI2Res[objRes.URI]; false == ok { // 与原先的顺序查找一致: 同一uri取第一项
+			pSelf.mapURI2Res[objRes.URI] = objRes
+		}
+	}
 }
 
 ///////////////////////////////////// 资源下载网络服务类 //////////////////////////////////////
 /**
 * @Class 		FileSyncServer
 * @brief		资源下载网络服务
-* @detail		支持的接口有 login/get/list:
-				login:	用户登录
+* @detail		支持的接口有 login/get/list/live:
+				login:	用户登录(GET: cookie session; POST: 返回签名令牌，之后用请求头 Authorization: Bearer <token> 访问)
 				list：	获取下载资源列表xml串
-				get:	获取某一项在资源列表(xml)中的具体的资源数据
+				live:	获取实时资源列表(各实时资源当前一代文件的URI)
+				get:	获取某一项在资源列表(xml)中的具体的资源数据，或某实时资源的一代文件
+				出错时应答对应的http状态码(400/401/403/404/500)，应答体为统一的 ActionResponse (xml或json)
 * @author		barry
 */
 type FileSyncServer struct {
-	ServerHost      string       // 被用户访问的 ip + port
-	Account         string       // 登录帐号
-	Password        string       // 登录密码
-	SyncFolder      string       // 待下发的资源文件所在根目录
-	objResourceList ResourceList // 待下发的资源文件的清单列表(对象,程序内部用，最终转换成sResponseList string)
-	sResponseList   string       // 待下发的资源文件的清单列表(xml字符串)
-	sSHM1RealPath   string       // 上海今日内实时1分钟数据存放目录(每n分钟生成一次，供quoteclientapi下载)
-	sSZM1RealPath   string       // 深圳今日内实时1分钟数据存放目录(每n分钟生成一次，供quoteclientapi下载)
+	ServerHost         string                      // 被用户访问的 ip + port
+	Account            string                      // 登录帐号
+	Password           string                      // 登录密码(命令行指定的帐号，可下载全部资源)
+	UserStore          I_UserStore                 // 多帐号存储(帐号密码 + 各帐号可下载的资源类型)，为nil时只用Account/Password登录
+	TokenSecret        []byte                      // 登录令牌的签名密钥(为空时，启动服务时随机生成)
+	TokenLifetime      time.Duration               // 登录令牌的有效期(为0时，取默认值)
+	TLSCertFile        string                      // 服务器证书文件(PEM)，和TLSKeyFile都指定时，启用https
+	TLSKeyFile         string                      // 服务器私钥文件(PEM)
+	TLSClientCAFile    string                      // 客户端证书的CA文件(PEM)，指定时要求客户端提供证书(双向认证)
+	ManifestSigningKey ed25519.PrivateKey          // 资源清单的签名私钥(为nil时，清单不签名)
+	SyncFolder         string                      // 待下发的资源文件所在根目录
+	objSnapshot        atomic.Value                // 资源清单快照(*ResSnapshot)，由资源生成线程发布，网络请求只读
+	objSnapshotLock    sync.Mutex                  // 资源清单快照的更新锁(只用于写方之间互斥，读方不加锁)
+	objPublishLock     sync.RWMutex                // 发布新一代资源文件的锁(发布时的 文件改名+换清单，与下载请求的 取快照+打开文件、资源列表请求的 取快照 互斥)
+	objFileRefs        FileRefCounter              // 进行中的下载请求对各文件的引用计数
+	mapRealFiles       map[string]*RealFileHistory // 各实时资源已经发布的各代文件(别名URI -> 各代文件)
+	nRealFileKeep      int                         // 实时资源文件保留的代数(为0时，取缺省值)
+	nRealFileTTL       time.Duration               // 实时资源文件的最短保留时间(为0时，取缺省值)
+	objRealFilesLock   sync.Mutex                  // 实时资源各代文件的访问锁
+	objHttpServer      *http.Server                // 运行中的http服务对象(用于优雅退出)
+	objServerLock      sync.Mutex                  // objHttpServer 的访问锁
+	objShutdownDone    chan bool                   // 优雅退出完成的通知(所有连接处理完毕)
 }
 
 ///< ---------------------- [Public 方法] -----------------------------
 /**
 * @brief		启动资源下载网络服务
-* @detail		支持的接口有 login/get/list:
+* @detail		支持的接口有 login/get/list/live:
 				login:	用户登录
 				list：	获取下载资源列表xml串
+				live:	获取实时资源(别名URI)列表
 				get:	获取某一项在资源列表(xml)中的具体的资源数据
-* @note		配置了服务器 读超时 + 写超时
+* @note		配置了服务器 读超时 + 写超时;
+				指定了证书和私钥时，以https(TLS1.2+)提供服务，再指定客户端CA时，要求双向认证
 */
 func (pSelf *FileSyncServer) RunServer() {
 	objSrv := &http.Server{
@@ -93,6 +228,17 @@ func (pSelf *FileSyncServer) RunServer() {
 		WriteTimeout: time.Second * 60 * 6,
 	}
 
+	pSelf.objServerLock.Lock()
+	pSelf.objHttpServer = objSrv
+	pSelf.objShutdownDone = make(chan bool)
+	pSelf.objServerLock.Unlock()
+
+	if len(pSelf.TokenSecret) == 0 {
+		pSelf.TokenSecret = make([]byte, 32)
+		rand.Read(pSelf.TokenSecret)
+		log.Println("[WARN] FileSyncServer.RunServer() : token secret is not specified, a random one is used (tokens will be invalid after restart)")
+	}
+
 	// connections keep alive
 	objSrv.SetKeepAlivesEnabled(true)
 	// Create a http server && Register Http Event
@@ -100,68 +246,125 @@ func (pSelf *FileSyncServer) RunServer() {
 	http.HandleFunc("/login", pSelf.handleLogin)
 	http.HandleFunc("/get", pSelf.handleDownload)
 	http.HandleFunc("/list", pSelf.handleList)
+	http.HandleFunc("/live", pSelf.handleLive)
 
 	// Active the http server
+	var err error = nil
 	log.Println("[INF] FileSyncServer.RunServer() : Sync Folder :", pSelf.SyncFolder)
-	log.Println("[INF] FileSyncServer.RunServer() : Server Is Available [", pSelf.ServerHost, "] .........")
-	objSrv.ListenAndServe()
+	if "" != pSelf.TLSCertFile || "" != pSelf.TLSKeyFile {
+		objSrv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if "" != pSelf.TLSClientCAFile {
+			bytesPem, err := ioutil.ReadFile(pSelf.TLSClientCAFile)
+			if nil != err {
+				log.Println("[ERR] FileSyncServer.RunServer() : cannot load client CA file :", pSelf.TLSClientCAFile, err.Error())
+				return
+			}
+
+			objTLSConfig := objSrv.TLSConfig
+			objTLSConfig.ClientCAs = x509.NewCertPool()
+			if false == objTLSConfig.ClientCAs.AppendCertsFromPEM(bytesPem) {
+				log.Println("[ERR] FileSyncServer.RunServer() : no certificate found in client CA file :", pSelf.TLSClientCAFile)
+				return
+			}
+
+			objTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			log.Println("[INF] FileSyncServer.RunServer() : Mutual TLS Is Required, Client CA :", pSelf.TLSClientCAFile)
+		}
+
+		log.Println("[INF] FileSyncServer.RunServer() : Server Is Available [ https://", pSelf.ServerHost, "] .........")
+		err = objSrv.ListenAndServeTLS(pSelf.TLSCertFile, pSelf.TLSKeyFile)
+	} else {
+		log.Println("[INF] FileSyncServer.RunServer() : Server Is Available [", pSelf.ServerHost, "] .........")
+		err = objSrv.ListenAndServe()
+	}
+
+	if http.ErrServerClosed == err { // 优雅退出中: 等待进行中的下载全部完成
+		<-pSelf.objShutdownDone
+	} else if nil != err {
+		log.Println("[ERR] FileSyncServer.RunServer() :", err.Error())
+	}
 	log.Println("[INF] FileSyncServer.RunServer() : Server Has Halted.........")
 }
 
 /**
- * @brief		获取上海实时1分钟线的数据的路径
+ * @brief		优雅退出网络服务
+ * @detail		不再接受新连接，等待进行中的请求(下载)处理完毕后，RunServer()返回
+ * @param[in]	nTimeout	等待进行中的请求的最长时间，超时后强制关闭剩余连接
  */
-func (pSelf *FileSyncServer) GetSHRealMin1File() string {
-	return pSelf.sSHM1RealPath
-}
-
-/**
-* @brief		设置上海实时1分钟线的数据的路径
-* @note			如果之前已经生成过一条1分钟线数据包，则会先删除之前的旧数据文件
-				&&
-				删除前会sleep一段时间(30秒)，以确保没有客户端在下载这个文件
-*/
-func (pSelf *FileSyncServer) SetSHRealMin1File(sMin1FilePath string) {
-	var sOldFile string = pSelf.sSHM1RealPath
+func (pSelf *FileSyncServer) Shutdown(nTimeout time.Duration) {
+	pSelf.objServerLock.Lock()
+	objSrv, objDone := pSelf.objHttpServer, pSelf.objShutdownDone
+	pSelf.objHttpServer = nil
+	pSelf.objServerLock.Unlock()
 
-	pSelf.sSHM1RealPath = sMin1FilePath
-	if sOldFile == "" {
+	if nil == objSrv {
 		return
 	}
 
-	time.Sleep(time.Second * 15 * 2)
-	err := os.Remove(sOldFile)
-	if err != nil {
-		log.Printf("[ERR] FileSyncServer.SetSHRealMin1File() : Error occur while removing (real)min1 file=%s : err=%s", sOldFile, err.Error())
+	log.Println("[INF] FileSyncServer.Shutdown() : draining connections .........")
+	objCtx, objCancel := context.WithTimeout(context.Background(), nTimeout)
+	defer objCancel()
+	if err := objSrv.Shutdown(objCtx); nil != err {
+		log.Println("[WARN] FileSyncServer.Shutdown() : connections r closed forcibly :", err.Error())
+		objSrv.Close()
 	}
+
+	close(objDone)
 }
 
 /**
- * @brief		获取深圳实时1分钟线的数据的路径
+ * @brief		获取当前的资源清单快照
+ * @note		返回的快照只读; 尚未发布过时，返回空快照
  */
-func (pSelf *FileSyncServer) GetSZRealMin1File() string {
-	return pSelf.sSZM1RealPath
+func (pSelf *FileSyncServer) loadSnapshot() *ResSnapshot {
+	if objSnapshot, ok := pSelf.objSnapshot.Load().(*ResSnapshot); true == ok {
+		return objSnapshot
+	}
+
+	return &ResSnapshot{}
 }
 
 /**
-* @brief		设置深圳实时1分钟线的数据的路径
-* @note			如果之前已经生成过一条1分钟线数据包，则会先删除之前的旧数据文件
-				&&
-				删除前会sleep一段时间(30秒)，以确保没有客户端在下载这个文件
-*/
-func (pSelf *FileSyncServer) SetSZRealMin1File(sMin1FilePath string) {
-	var sOldFile string = pSelf.sSZM1RealPath
+ * @brief		获取某实时资源的当前一代文件
+ * @param[in]	sAliasURI		别名URI(相对于SyncFolder，如: SSE/MIN1_TODAY/MIN1_TODAY)
+ * @return		当前一代文件的资源描述项(URI为文件路径) + 是否已经发布过
+ */
+func (pSelf *FileSyncServer) GetLiveFile(sAliasURI string) (ResDownload, bool) {
+	objRes, ok := pSelf.loadSnapshot().mapLiveFiles[sAliasURI]
 
-	pSelf.sSZM1RealPath = sMin1FilePath
-	if sOldFile == "" {
-		return
-	}
+	return objRes, ok
+}
 
-	time.Sleep(time.Second * 15 * 2)
-	err := os.Remove(sOldFile)
-	if err != nil {
-		log.Printf("[ERR] FileSyncServer.SetSHRealMin1File() : Error occur while removing (real)min1 file=%s : err=%s", sOldFile, err.Error())
+/**
+* @brief		发布某实时资源新的一代文件
+* @param[in]	sAliasURI		别名URI(相对于SyncFolder，如: SSE/MIN5_TODAY/MIN5_TODAY)
+* @param[in]	objRes			新一代文件的资源描述项(URI为文件路径，TYPE为资源类型)
+* @note			之前生成的各代文件按代保留，没有进行中的下载且超过保留时间后才删除(见 retainRealFile())
+*/
+func (pSelf *FileSyncServer) SetLiveFile(sAliasURI string, objRes ResDownload) {
+	pSelf.objSnapshotLock.Lock()
+	objNewSnapshot := pSelf.loadSnapshot().clone()
+	objNewSnapshot.mapLiveFiles = make(map[string]ResDownload, len(objNewSnapshot.mapLiveFiles)+1) // 不修改已发布快照的索引
+	for sAlias, objLiveRes := range pSelf.loadSnapshot().mapLiveFiles {
+		objNewSnapshot.mapLiveFiles[sAlias] = objLiveRes
 	}
+	objNewSnapshot.mapLiveFiles[sAliasURI] = objRes
+	pSelf.objSnapshot.Store(objNewSnapshot)
+	pSelf.objSnapshotLock.Unlock()
+
+	pSelf.retainRealFile(sAliasURI, objRes.URI)
+}
+
+/**
+ * @brief		设置实时资源文件的保留策略
+ * @param[in]	nKeep			保留最近的代数(含当前一代，<=0时取缺省值)
+ * @param[in]	nTTL			被替换的文件的最短保留时间(生成后，<=0时取缺省值)
+ */
+func (pSelf *FileSyncServer) SetRealFileRetention(nKeep int, nTTL time.Duration) {
+	pSelf.objRealFilesLock.Lock()
+	defer pSelf.objRealFilesLock.Unlock()
+
+	pSelf.nRealFileKeep, pSelf.nRealFileTTL = nKeep, nTTL
 }
 
 /**
@@ -171,7 +374,29 @@ func (pSelf *FileSyncServer) SetSZRealMin1File(sMin1FilePath string) {
  * @param[in]	refResList		新生成的资源列表结构
  */
 func (pSelf *FileSyncServer) UpdateResList(refResList *ResourceList) {
-	objNewResourceList := pSelf.objResourceList // clone一份当前的资源结构列表对象
+	pSelf.objSnapshotLock.Lock()
+	defer pSelf.objSnapshotLock.Unlock()
+
+	pSelf.updateResList(refResList)
+}
+
+/**
+ * @brief		在当前资源列表中 更新/追加 资源项，并发布
+ * @note		调用方需持有 objSnapshotLock
+ */
+func (pSelf *FileSyncServer) updateResList(refResList *ResourceList) {
+	objNewResourceList := pSelf.mergeResList(refResList)
+
+	pSelf.publishResList(&objNewResourceList) // 更新资源列表结构对象 + 生成新的xml资源列表字符串 + 存盘xml资源列表串（待盘中重启加载用）
+}
+
+/**
+ * @brief		在当前资源列表的副本中 更新/追加 资源项(不发布)
+ * @return		更新后的资源列表
+ */
+func (pSelf *FileSyncServer) mergeResList(refResList *ResourceList) ResourceList {
+	// clone一份当前的资源结构列表对象(复制切片，不修改已发布的快照)
+	objNewResourceList := ResourceList{Download: append([]ResDownload(nil), pSelf.loadSnapshot().objResourceList.Download...)}
 
 	for _, objUpdateObject := range refResList.Download { // 遍历出每个待更新的资源
 		var bFindUpdateItem bool = false // 是更新，还是追加标记
@@ -188,121 +413,378 @@ func (pSelf *FileSyncServer) UpdateResList(refResList *ResourceList) {
 		}
 	}
 
-	pSelf.SetResList(&objNewResourceList) // 更新资源列表结构对象 + 生成新的xml资源列表字符串 + 存盘xml资源列表串（待盘中重启加载用）
+	return objNewResourceList
 }
 
 /**
  * @brief		更新资源列表结构 和 资源xml字符串 并 存盘xml资源列表串（待盘中重启加载用）
  */
 func (pSelf *FileSyncServer) SetResList(refResList *ResourceList) {
-	pSelf.sResponseList = ""
-	pSelf.objResourceList = *refResList
+	pSelf.objSnapshotLock.Lock()
+	defer pSelf.objSnapshotLock.Unlock()
+
+	pSelf.publishResList(refResList)
+}
+
+/**
+* @brief		发布新一代资源文件: 把暂存目录中新生成的文件改名到发布目录，同时发布新的资源列表
+* @detail		先生成完整的新清单快照，再在发布锁内 改名文件 + 换清单(只换一次快照，没有中间状态);
+				下载请求(取快照 + 打开文件) 和 资源列表请求(/list /live) 都在发布锁内取快照，看到的要么全是旧一代，要么全是新一代;
+				被替换的旧文件先移到退役目录，等旧一代的下载全部结束后再删除
+* @param[in]	sTargetFolder	发布目录(资源URI的根目录)
+* @param[in]	sStagingFolder	暂存目录(目录结构同发布目录，发布后删除)
+* @param[in]	refResList		新生成的资源列表
+* @param[in]	bUpdateOnly		true: 只 更新/追加 资源项(同UpdateResList());  false: 替换整个资源列表(同SetResList())
+* @return		true			发布成功
+				false			有文件改名失败(已经完成的改名恢复原状，资源列表不变)
+* @note		暂存目录/退役目录 要与发布目录在同一个文件系统中(见 stagingFolderOf())
+*/
+func (pSelf *FileSyncServer) PublishGeneration(sTargetFolder string, sStagingFolder string, refResList *ResourceList, bUpdateOnly bool) bool {
+	lstStaged, err := listStagedFiles(sStagingFolder, sTargetFolder)
+	if nil != err {
+		log.Println("[ERR] FileSyncServer.PublishGeneration() : cannot list staged files :", sStagingFolder, err.Error())
+		return false
+	}
+
+	pSelf.objPublishLock.Lock()
+	defer pSelf.objPublishLock.Unlock()
+	pSelf.objSnapshotLock.Lock()
+	defer pSelf.objSnapshotLock.Unlock()
+
+	if true == bUpdateOnly {
+		objNewResList := pSelf.mergeResList(refResList)
+		refResList = &objNewResList
+	}
+
+	objOldSnapshot := pSelf.loadSnapshot()
+	objNewSnapshot := pSelf.buildResSnapshot(refResList)
+	objNewSnapshot.refGeneration = &ResGeneration{}
+
+	sRetiredFolder := filepath.Join(retiredFolderOf(sTargetFolder), strconv.FormatInt(time.Now().UnixNano(), 10))
+	if false == swapStagedFiles(lstStaged, sRetiredFolder) {
+		log.Println("[ERR] FileSyncServer.PublishGeneration() : [FAILURE] cannot publish staged files, resource list is not updated :", sStagingFolder)
+		return false
+	}
+
+	pSelf.storeResSnapshot(objNewSnapshot)
+	objOldSnapshot.refGeneration.retire(sRetiredFolder)
+	os.RemoveAll(sStagingFolder)
+	log.Printf("[INF] FileSyncServer.PublishGeneration() : [OK] %d files published, Version = %d", len(lstStaged), objNewSnapshot.objResourceList.Version)
+
+	return true
+}
+
+/**
+ * @brief		生成并发布新的资源清单快照 + 存盘xml资源列表串
+ * @note		调用方需持有 objSnapshotLock
+ */
+func (pSelf *FileSyncServer) publishResList(refResList *ResourceList) {
+	pSelf.storeResSnapshot(pSelf.buildResSnapshot(refResList))
+}
+
+/**
+ * @brief		生成新的资源清单快照(不发布)
+ * @detail		每次发布，清单版本号加1(启动后首次发布时，接着 ./restable.dat 中存盘的版本号递增);
+ 				与当前清单相比被删除的资源，生成墓碑项(见 mergeTombstones());
+ 				墓碑项只保留在快照的资源清单中(用于生成增量清单)，xml资源列表串 和 ./restable.dat 中都不带墓碑项
+ * @note		调用方需持有 objSnapshotLock，直到新快照发布为止(见 storeResSnapshot())
+ */
+func (pSelf *FileSyncServer) buildResSnapshot(refResList *ResourceList) *ResSnapshot {
+	objNewSnapshot := pSelf.loadSnapshot().clone()
+	if 0 == objNewSnapshot.objResourceList.Version { // 尚未发布过: 以上一次存盘的清单为基准版本
+		if objSavedList, sSavedList, err := readSavedResList(); nil == err {
+			objNewSnapshot.setResList(&objSavedList, sSavedList)
+		}
+	}
+
+	objNewSnapshot.pushHistory()
+	objNewResList := ResourceList{Version: objNewSnapshot.objResourceList.Version + 1, Download: mergeTombstones(&objNewSnapshot.objResourceList, refResList.Download, time.Now())}
+	refResList = &objNewResList
+	objFullList, _ := stripTombstones(refResList) // 全量清单不带墓碑项(旧版本客户端不认识removed属性)
 
 	//////////////////////////// 将资源列表结构转为xml串 /////////////////////////////////
-	if sResponse, err := xml.Marshal(&pSelf.objResourceList); err != nil {
+	if sResponse, err := xml.Marshal(&objFullList); err != nil {
 		log.Println("[ERR] FileSyncServer.SetResList() : Error Occur while marshaling xml obj. :", err.Error())
+		objNewSnapshot.setResList(refResList, "")
 	} else {
 		log.Println("[INF] FileSyncServer.SetResList() : marshaling xml obj. ...... ")
-		pSelf.sResponseList = string(sResponse)
+		objNewSnapshot.setResList(refResList, string(sResponse))
+		objNewSnapshot.sResponseSign = signManifest(pSelf.ManifestSigningKey, "/list", objNewSnapshot.objResourceList.Version, []byte(xml.Header+objNewSnapshot.sResponseList))
+	}
 
-		//////////////////////// xml资源列表存盘 ./status.dat, 盘中启动服务时，从这个文件恢复
-		objResponseSaver, err := os.Create("./restable.dat")
-		defer objResponseSaver.Close()
-		if nil != err {
-			log.Println("[ERR] FileSyncServer.SetResList() : [FAILURE] cannot save ./restable.dat 2 disk :", err.Error())
-		} else {
-			nLen, _ := objResponseSaver.WriteString(pSelf.sResponseList)
-			log.Printf("[INF] FileSyncServer.SetResList() : [OK] Write %d bytes 2 ./restable.dat", nLen)
-		}
+	return objNewSnapshot
+}
+
+/**
+ * @brief		发布新的资源清单快照 + 存盘xml资源列表串
+ * @note		调用方需持有 objSnapshotLock
+ */
+func (pSelf *FileSyncServer) storeResSnapshot(refSnapshot *ResSnapshot) {
+	pSelf.objSnapshot.Store(refSnapshot)
+	if "" == refSnapshot.sResponseList {
+		return
 	}
+
+	//////////////////////// xml资源列表存盘 ./status.dat, 盘中启动服务时，从这个文件恢复
+	objResponseSaver, err := os.Create("./restable.dat")
+	if nil != err {
+		log.Println("[ERR] FileSyncServer.SetResList() : [FAILURE] cannot save ./restable.dat 2 disk :", err.Error())
+		return
+	}
+
+	defer objResponseSaver.Close()
+	nLen, _ := objResponseSaver.WriteString(refSnapshot.sResponseList)
+	log.Printf("[INF] FileSyncServer.SetResList() : [OK] Write %d bytes 2 ./restable.dat", nLen)
+}
+
+/**
+ * @brief		读取存盘的资源列表xml字符串(./restable.dat) + 并从xml中恢复出资源列表结构对象
+ * @return		资源列表结构对象 + xml字符串 + 错误
+ */
+func readSavedResList() (ResourceList, string, error) {
+	var objResourceList ResourceList
+
+	bytesData, err := ioutil.ReadFile("./restable.dat")
+	if nil != err {
+		return objResourceList, "", err
+	}
+
+	err = xml.Unmarshal(bytesData, &objResourceList) // 从xml恢复出资源列表结构对象
+
+	return objResourceList, string(bytesData), err
 }
 
 /**
  * @brief		加载资源列表xml字符串 + 并从xml中恢复出资源列表结构对象
+ * @note		旧版本存盘的清单没有版本号，按版本1加载
  */
 func (pSelf *FileSyncServer) LoadResList() bool {
-	objResponseLoader, err := os.Open("./restable.dat")
-	defer objResponseLoader.Close()
-	if nil == err {
-		bytesData := make([]byte, 1024*1024*8)
-		nLen, _ := objResponseLoader.Read(bytesData)
-		pSelf.sResponseList = string(bytesData[:nLen]) // 恢复xml资源列表串
-
-		err = xml.Unmarshal([]byte(pSelf.sResponseList), &(pSelf.objResourceList)) // 从xml恢复出资源列表结构对象
-		if err != nil {
-			log.Println("[ERR] FileSyncServer.LoadResList() : [ERR] cannot unmarshal xml string in ./restable.dat : ", err.Error())
-			return false
+	objResourceList, sResponseList, err := readSavedResList()
+	if nil != err {
+		log.Println("[ERR] FileSyncServer.LoadResList() : [ERR] cannot load ./restable.dat : ", err.Error())
+		return false
+	}
+
+	pSelf.objSnapshotLock.Lock()
+	objNewSnapshot := pSelf.loadSnapshot().clone()
+	if 0 == objResourceList.Version || objNewSnapshot.objResourceList.Version != objResourceList.Version { // 已经发布过的版本，不重复加载
+		objFullList, bStripped := stripTombstones(&objResourceList) // 之前版本存盘的清单中可能带有墓碑项
+		if 0 == objResourceList.Version || true == bStripped {
+			objResourceList = objFullList
+			if 0 == objResourceList.Version {
+				objResourceList.Version = 1
+			}
+
+			if bytesData, err := xml.Marshal(&objResourceList); nil == err {
+				sResponseList = string(bytesData)
+			}
 		}
 
-		log.Printf("[INF] FileSyncServer.LoadResList() : [OK] load %d bytes from ./restable.dat && Resources Number = %d", nLen, len(pSelf.objResourceList.Download))
+		objNewSnapshot.pushHistory()
+		objNewSnapshot.setResList(&objResourceList, sResponseList)
+		objNewSnapshot.sResponseSign = signManifest(pSelf.ManifestSigningKey, "/list", objNewSnapshot.objResourceList.Version, []byte(xml.Header+objNewSnapshot.sResponseList))
+		pSelf.objSnapshot.Store(objNewSnapshot)
+	}
+	pSelf.objSnapshotLock.Unlock()
+
+	log.Printf("[INF] FileSyncServer.LoadResList() : [OK] load %d bytes from ./restable.dat && Resources Number = %d, Version = %d", len(sResponseList), len(objResourceList.Download), objResourceList.Version)
+
+	return true
+}
+
+///< ---------------------- [Private 方法] -----------------------------
+/**
+ * @brief		记录新发布的一代实时资源文件，并删除可以删除的旧文件
+ * @param[in]	sAliasURI		实时资源的别名URI
+ * @param[in]	sFilePath		新一代文件的路径
+ */
+func (pSelf *FileSyncServer) retainRealFile(sAliasURI string, sFilePath string) {
+	pSelf.objRealFilesLock.Lock()
+	if nil == pSelf.mapRealFiles {
+		pSelf.mapRealFiles = make(map[string]*RealFileHistory)
+	}
 
+	refHistory, ok := pSelf.mapRealFiles[sAliasURI]
+	if false == ok {
+		refHistory = &RealFileHistory{}
+		pSelf.mapRealFiles[sAliasURI] = refHistory
+	}
+
+	refHistory.push(sFilePath, time.Now())
+	pSelf.objRealFilesLock.Unlock()
+
+	pSelf.removeExpiredRealFiles()
+}
+
+/**
+ * @brief		删除各实时资源可以删除的旧文件(超出保留代数 + 没有进行中的下载 + 超过保留时间)
+ * @note		在发布锁内删除: 下载请求 取快照+打开文件 的过程中，快照中的文件不会被删除
+ */
+func (pSelf *FileSyncServer) removeExpiredRealFiles() {
+	var lstExpired []string
+	var nKeep int = nDefaultRealFileKeep
+	var nTTL time.Duration = nDefaultRealFileTTL
+
+	pSelf.objPublishLock.Lock()
+	defer pSelf.objPublishLock.Unlock()
+	pSelf.objRealFilesLock.Lock()
+	if pSelf.nRealFileKeep > 0 {
+		nKeep = pSelf.nRealFileKeep
+	}
+
+	if pSelf.nRealFileTTL > 0 {
+		nTTL = pSelf.nRealFileTTL
+	}
+
+	for _, refHistory := range pSelf.mapRealFiles {
+		lstExpired = append(lstExpired, refHistory.expire(nKeep, nTTL, time.Now(), &pSelf.objFileRefs)...)
+	}
+	pSelf.objRealFilesLock.Unlock()
+
+	for _, sOldFile := range lstExpired {
+		if err := os.Remove(sOldFile); nil != err && false == os.IsNotExist(err) {
+			log.Printf("[ERR] FileSyncServer.removeExpiredRealFiles() : Error occur while removing real file=%s : err=%s", sOldFile, err.Error())
+		}
+	}
+}
+
+/**
+ * @brief		下载结束: 释放对文件的引用
+ * @note		被替换下来的实时资源文件没有下载引用后，再检查一次是否可以删除
+ */
+func (pSelf *FileSyncServer) releaseFile(sFilePath string) {
+	if pSelf.objFileRefs.Release(sFilePath) > 0 {
+		return
+	}
+
+	var bIsRetired bool = false
+	pSelf.objRealFilesLock.Lock()
+	for _, refHistory := range pSelf.mapRealFiles {
+		for i := 0; i < len(refHistory.lstGenerations)-1; i++ {
+			if sFilePath == refHistory.lstGenerations[i].Path {
+				bIsRetired = true
+			}
+		}
+	}
+	pSelf.objRealFilesLock.Unlock()
+
+	if true == bIsRetired {
+		pSelf.removeExpiredRealFiles()
+	}
+}
+
+/**
+ * @brief		验证帐号和密码
+ * @note		先比对命令行指定的帐号，再查找多帐号存储(UserStore)
+ */
+func (pSelf *FileSyncServer) authenticateUser(sAccount, sPassword string) bool {
+	if "" != pSelf.Account && pSelf.Account == sAccount && pSelf.Password == sPassword {
 		return true
 	}
 
-	log.Println("[ERR] FileSyncServer.LoadResList() : [ERR] cannot load ./restable.dat : ", err.Error())
+	if nil != pSelf.UserStore {
+		return pSelf.UserStore.Authenticate(sAccount, sPassword)
+	}
+
+	return false
+}
+
+/**
+ * @brief		判断某帐号是否有权下载某资源类型
+ * @note		命令行指定的帐号可下载全部资源
+ */
+func (pSelf *FileSyncServer) isEntitled(sAccount, sResType string) bool {
+	if "" != pSelf.Account && pSelf.Account == sAccount {
+		return true
+	}
+
+	if nil != pSelf.UserStore {
+		return pSelf.UserStore.IsEntitled(sAccount, sResType)
+	}
 
 	return false
 }
 
-///< ---------------------- [Private 方法] -----------------------------
+/**
+ * @brief		按帐号的资源类型白名单，过滤资源列表
+ * @return		过滤后的资源列表 + 是否有被过滤掉的项
+ */
+func (pSelf *FileSyncServer) filterResList(sAccount string, refResList *ResourceList) (ResourceList, bool) {
+	var objFilteredList ResourceList = ResourceList{Version: refResList.Version, Since: refResList.Since}
+	var bFiltered bool = false
+
+	for _, objRes := range refResList.Download {
+		if true == pSelf.isEntitled(sAccount, objRes.TYPE) {
+			objFilteredList.Download = append(objFilteredList.Download, objRes)
+		} else {
+			bFiltered = true
+		}
+	}
+
+	return objFilteredList, bFiltered
+}
+
 /**
  * @brief		用户信息认证接口
- * @detail		判断某个session是否存在
+ * @detail		优先校验请求头中的令牌(Authorization: Bearer <token>)，没有令牌时判断某个session是否存在;
+ 				令牌无效/过期 或 session不存在时应答 401
+ * @return		登录的帐号 + 是否认证通过
  */
-func (pSelf *FileSyncServer) authenticateSession(resp http.ResponseWriter, req *http.Request) bool {
+func (pSelf *FileSyncServer) authenticateSession(resp http.ResponseWriter, req *http.Request) (string, bool) {
 	req.ParseForm()
+	if sAuthorization := req.Header.Get("Authorization"); "" != sAuthorization {
+		if false == strings.HasPrefix(sAuthorization, "Bearer ") {
+			writeError(resp, req, http.StatusUnauthorized, "authenticate", "unsupported authorization scheme.")
+			return "", false
+		}
+
+		sAccount, bIsOk := verifyToken(pSelf.TokenSecret, strings.TrimSpace(sAuthorization[len("Bearer "):]))
+		if false == bIsOk {
+			writeError(resp, req, http.StatusUnauthorized, "authenticate", "token is invalid or has expired.")
+			return "", false
+		}
+
+		return sAccount, true
+	}
+
 	objSession, _ := globalSessions.SessionStart(resp, req)
 	defer objSession.SessionRelease(resp)
 	sUNameInSS := objSession.Get("username")
 
 	if sUNameInSS == nil {
-		var xmlRes struct {
-			XMLName xml.Name `xml:"authenticate"`
-			Result  struct {
-				XMLName xml.Name `xml:"result"`
-				Status  string   `xml:"status,attr"`
-				Desc    string   `xml:"desc,attr"`
-			}
-		} // Build Response Xml Structure
-
-		xmlRes.Result.Status = "failure"
-		xmlRes.Result.Desc = "[WARNING] Oops! user session has expired."
-		log.Println("[INF] [AuthenticateUser] ---> [FAILURE]")
-
-		// Marshal Obj 2 Xml String && Write 2 HTTP Response Object
-		if sResponse, err := xml.Marshal(&xmlRes); err != nil {
-			fmt.Fprintf(resp, "%s", err.Error())
-		} else {
-			fmt.Fprintf(resp, "%s%s", xml.Header, string(sResponse))
-		}
-
-		return false
+		writeError(resp, req, http.StatusUnauthorized, "authenticate", "user session has expired.")
+		return "", false
 	}
 
-	return true
+	return fmt.Sprintf("%v", sUNameInSS), true
 }
 
 /**
  * @brief		帮助接口
+ * @note		未定义的接口路径，应答 404
  */
 func (pSelf *FileSyncServer) handleDefault(resp http.ResponseWriter, req *http.Request) {
-	fmt.Fprintf(resp, "Server Of File Sync Program.\n\nUsage Of Action:\n\nhttp://127.0.0.1/login?account=xx&password=xxx\n\nhttp://127.0.0.1/get?uri=xxx.zip\n\nhttp://127.0.0.1/list\n\n")
+	if "/" != req.URL.Path {
+		writeError(resp, req, http.StatusNotFound, "default", "unknown action, "+req.URL.Path)
+		return
+	}
+
+	fmt.Fprintf(resp, "Server Of File Sync Program.\n\nUsage Of Action:\n\nhttp://127.0.0.1/login?account=xx&password=xxx\n\nPOST http://127.0.0.1/login (account=xx&password=xxx) ---> token, then header 'Authorization: Bearer <token>'\n\nhttp://127.0.0.1/get?uri=xxx.zip\n\nhttp://127.0.0.1/list\n\nhttp://127.0.0.1/live\n\n")
 }
 
 /**
  * @brief		用户登录接口
  * @detail		用于验证登录帐号和密码是否正确，通过后，新增一个合法的session
+ * @note		帐号或密码错误时，应答 401;
+ 				POST请求(帐号密码放在请求体中)走令牌登录，见 handleTokenLogin()
  */
 func (pSelf *FileSyncServer) handleLogin(resp http.ResponseWriter, req *http.Request) {
 	var sAccount, sPswd string // LoginName && LoginPassword
-	var xmlRes struct {
-		XMLName xml.Name `xml:"login"`
-		Result  struct {
-			XMLName xml.Name `xml:"result"`
-			Status  string   `xml:"status,attr"`
-			Desc    string   `xml:"desc,attr"`
-		}
-	} // Build Response Xml Structure
+
+	if "POST" == req.Method {
+		pSelf.handleTokenLogin(resp, req)
+		return
+	}
 
 	// Initialize Arguments
 	req.ParseForm()
@@ -312,119 +794,353 @@ func (pSelf *FileSyncServer) handleLogin(resp http.ResponseWriter, req *http.Req
 
 	// Check Login Status
 	if sUNameInSS != nil {
-		xmlRes.Result.Status = "success"
-		xmlRes.Result.Desc = "[INFO] welcome again"
 		log.Println("[INF] HttpAction[Relogin], [OK]: ", sUNameInSS)
-	} else {
-		// Fetch Aruguments ( LoginName && LoginPassword )
-		xmlRes.Result.Status = "failure"
-		xmlRes.Result.Desc = "[WARNING] Oops! account or password r incorrect."
-		if len(req.Form["account"]) > 0 {
-			sAccount = req.Form["account"][0]
-		}
+		writeResult(resp, req, http.StatusOK, "login", "success", "[INFO] welcome again")
+		return
+	}
 
-		if len(req.Form["password"]) > 0 {
-			sPswd = req.Form["password"][0]
-		}
+	// Fetch Aruguments ( LoginName && LoginPassword )
+	if len(req.Form["account"]) > 0 {
+		sAccount = req.Form["account"][0]
+	}
 
-		// Check LoginName && LoginPassword
-		if pSelf.Account == sAccount && pSelf.Password == sPswd {
-			objSession.Set("username", sAccount)
-			xmlRes.Result.Status = "success"
-			xmlRes.Result.Desc = "[INFO] Good! account and password r all correct."
-			log.Println("[INF] HttpAction[Login], [OK]: ", sAccount)
-		} else {
-			log.Println("[INF] HttpAction[Login], [FAILED]: ", sAccount)
-		}
+	if len(req.Form["password"]) > 0 {
+		sPswd = req.Form["password"][0]
 	}
 
-	// Marshal Obj 2 Xml String && Write 2 HTTP Response Object
-	if sResponse, err := xml.Marshal(&xmlRes); err != nil {
-		fmt.Fprintf(resp, "%s", err.Error())
+	// Check LoginName && LoginPassword
+	if true == pSelf.authenticateUser(sAccount, sPswd) {
+		objSession.Set("username", sAccount)
+		log.Println("[INF] HttpAction[Login], [OK]: ", sAccount)
+		writeResult(resp, req, http.StatusOK, "login", "success", "[INFO] Good! account and password r all correct.")
 	} else {
-		fmt.Fprintf(resp, "%s%s", xml.Header, string(sResponse))
+		log.Println("[INF] HttpAction[Login], [FAILED]: ", sAccount)
+		writeError(resp, req, http.StatusUnauthorized, "login", "account or password r incorrect.")
 	}
 }
 
+/**
+ * @brief		令牌登录接口(POST /login)
+ * @detail		帐号密码从请求体(application/x-www-form-urlencoded)中读取，验证通过后返回签名令牌，
+ 				服务端不保存任何状态
+ * @note		帐号或密码错误时，应答 401
+ */
+func (pSelf *FileSyncServer) handleTokenLogin(resp http.ResponseWriter, req *http.Request) {
+	var nLifetime time.Duration = pSelf.TokenLifetime
+
+	// 只读请求体中的帐号密码，不接受url中的明文密码
+	if err := req.ParseForm(); nil != err {
+		writeError(resp, req, http.StatusBadRequest, "login", "cannot parse request body.")
+		return
+	}
+
+	sAccount := req.PostForm.Get("account")
+	if false == pSelf.authenticateUser(sAccount, req.PostForm.Get("password")) {
+		log.Println("[INF] HttpAction[Login(token)], [FAILED]: ", sAccount)
+		writeError(resp, req, http.StatusUnauthorized, "login", "account or password r incorrect.")
+		return
+	}
+
+	if nLifetime <= 0 {
+		nLifetime = nDefaultTokenLifetime
+	}
+
+	objExpire := time.Now().Add(nLifetime)
+	objResponse := ActionResponse{XMLName: xml.Name{Local: "login"}, Action: "login"}
+	objResponse.Result.Status = "success"
+	objResponse.Result.Code = http.StatusOK
+	objResponse.Result.Desc = "[INFO] Good! account and password r all correct."
+	objResponse.Result.Token = issueToken(pSelf.TokenSecret, sAccount, objExpire)
+	objResponse.Result.Expire = objExpire.Unix()
+
+	log.Println("[INF] HttpAction[Login(token)], [OK]: ", sAccount)
+	resp.Header().Set("Cache-Control", "no-store")
+	writeObject(resp, req, http.StatusOK, &objResponse)
+}
+
 /**
  * @brief		根据请求的uri信息，判断是否需要做重定向，用于获取正确的资源位置
- * @note		比如： 获取沪、深今日内的实时1分钟线资源包
+ * @detail		实时资源的别名URI(如: SSE/MIN1_TODAY/MIN1_TODAY)，重定向到该实时资源当前的一代文件;
+ 				别名URI前面可以带SyncFolder等目录(如: SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY)，有多个别名匹配时取最长的一个;
+ 				实时资源某一代文件的URI(<别名>.<date>.<hhmm>，见 /live 的应答)不重定向，只取其资源类型
+ * @param[in]	refSnapshot		本次请求使用的资源清单快照
+ * @return		重定向后的文件路径 + 资源类型(不是实时资源时，类型为空串)
  */
-func (pSelf *FileSyncServer) redirectURI(sFileName string) string {
-	if strings.Contains(sFileName, "MIN1_TODAY") == true {
-		if strings.Contains(sFileName, "SSE") == true {
-			return pSelf.sSHM1RealPath // 获取上海的实时1分钟线资源包
+func (pSelf *FileSyncServer) redirectURI(refSnapshot *ResSnapshot, sFileName string) (string, string) {
+	var sMatchedAlias string = ""
+	var sAliasURI string = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(sFileName)), "/")
+
+	if objRes, ok := refSnapshot.mapLiveFiles[sAliasURI]; true == ok {
+		return objRes.URI, objRes.TYPE
+	}
+
+	for sAlias, objRes := range refSnapshot.mapLiveFiles {
+		sLiveFile := filepath.ToSlash(filepath.Clean(objRes.URI))
+		if path.Dir(sLiveFile) == path.Dir(sAliasURI) && true == strings.HasPrefix(path.Base(sAliasURI), path.Base(sAlias)+".") { // 与当前一代在同一目录下的某一代文件
+			return sFileName, objRes.TYPE
 		}
 
-		if strings.Contains(sFileName, "SZSE") == true {
-			return pSelf.sSZM1RealPath // 获取深圳的实时1分钟线资源包
+		if len(sAlias) > len(sMatchedAlias) && true == strings.HasSuffix(sAliasURI, "/"+sAlias) {
+			sMatchedAlias = sAlias
 		}
 	}
 
-	return sFileName
+	if objRes, ok := refSnapshot.mapLiveFiles[sMatchedAlias]; true == ok {
+		return objRes.URI, objRes.TYPE
+	}
+
+	return sFileName, ""
 }
 
 /**
- * @brief		资源列表xml中的具体某一项资源的下载接口
- */
-func (pSelf *FileSyncServer) handleDownload(resp http.ResponseWriter, req *http.Request) {
-	var sZipName string = ""
-	var xmlRes struct {
-		XMLName xml.Name `xml:"download"`
-		Result  struct {
-			XMLName xml.Name `xml:"result"`
-			Status  string   `xml:"status,attr"`
-			Desc    string   `xml:"desc,attr"`
-		}
-	} // Build Response Xml Structure
+* @brief		判断某个待下发的文件是否允许被下载(防止路径穿越读取服务器上的任意文件)
+* @detail		只允许以下两类文件:
+				1) 在当前资源列表(ResourceList)中的文件
+				2) 路径解析(含符号链接)后，位于SyncFolder目录之内的文件
+* @param[in]	refSnapshot		本次请求使用的资源清单快照
+* @param[in]	sFilePath		重定向后的文件路径
+* @return		true			允许下载
+*/
+func (pSelf *FileSyncServer) isDownloadAllowed(refSnapshot *ResSnapshot, sFilePath string) bool {
+	if _, ok := refSnapshot.findResource(sFilePath); true == ok {
+		return true
+	}
 
-	if pSelf.authenticateSession(resp, req) == false {
+	if "" == pSelf.SyncFolder || "" == sFilePath {
+		return false
+	}
+
+	sRootFolder, err := filepath.Abs(pSelf.SyncFolder)
+	if err != nil {
+		return false
+	}
+
+	sTargetPath, err := filepath.Abs(sFilePath)
+	if err != nil {
+		return false
+	}
+
+	if sRealPath, err := filepath.EvalSymlinks(sRootFolder); nil == err {
+		sRootFolder = sRealPath
+	}
+
+	if sRealPath, err := filepath.EvalSymlinks(sTargetPath); nil == err {
+		sTargetPath = sRealPath
+	}
+
+	sRelPath, err := filepath.Rel(sRootFolder, sTargetPath)
+	if err != nil || ".." == sRelPath || strings.HasPrefix(sRelPath, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	return true
+}
+
+/**
+* @brief		资源列表xml中的具体某一项资源的下载接口
+* @detail		只下发资源列表中的，或SyncFolder目录内的文件(其它请求应答403，并记录安全日志);
+				文件以流的方式下发(不整个读入内存)，且支持 Range / If-Range 断点续传:
+				ETag取资源列表中的MD5串(实时资源等不在列表中的文件，则取文件长度+修改时间)
+				客户端带上If-Range的ETag与当前文件不一致时，返回整个文件
+*/
+func (pSelf *FileSyncServer) handleDownload(resp http.ResponseWriter, req *http.Request) {
+	sAccount, bIsOk := pSelf.authenticateSession(resp, req)
+	if false == bIsOk {
 		return
 	}
 
 	// Initialize Arguments
 	req.ParseForm()
+	if len(req.Form["uri"]) <= 0 {
+		writeError(resp, req, http.StatusBadRequest, "download", "miss argument, GET: uri=''")
+		return
+	}
 
-	// Download Zip File
-	if len(req.Form["uri"]) > 0 {
-		sZipName = pSelf.redirectURI(req.Form["uri"][0])
-		resp.Header().Set("Content-Type", "application/zip")
-		resp.Header().Set("Content-Encoding", "zip")
-		resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sZipName))
-		dataRes, err := ioutil.ReadFile(sZipName)
-		if err == nil {
-			resp.Write(dataRes)
-		} else {
-			xmlRes.Result.Status = "failure"
-			xmlRes.Result.Desc = "[WARNING] Oops! failed 2 load data file," + sZipName
-			// Marshal Obj 2 Xml String && Write 2 HTTP Response Object
-			if sResponse, err := xml.Marshal(&xmlRes); err != nil {
-				fmt.Fprintf(resp, "%s", err.Error())
-			} else {
-				fmt.Fprintf(resp, "%s%s", xml.Header, string(sResponse))
-			}
-		}
-	} else {
-		xmlRes.Result.Status = "failure"
-		xmlRes.Result.Desc = "[WARNING] Oops! miss argument, GET: uri=''"
-		log.Println("[INF] [Download File] ---> [FAILURE], miss argument, GET: uri='nil'")
+	// Open Zip File (下载结束前，文件所属的一代资源文件不会被删除)
+	objSnapshot, objFile, sZipName := pSelf.openDownloadFile(resp, req, sAccount)
+	if nil == objFile {
+		return
+	}
+	defer objSnapshot.refGeneration.endDownload()
+	defer pSelf.releaseFile(sZipName)
+	defer objFile.Close()
+
+	objFileInfo, err := objFile.Stat()
+	if err != nil || objFileInfo.IsDir() {
+		writeError(resp, req, http.StatusInternalServerError, "download", "failed 2 load data file, "+sZipName)
+		return
+	}
+
+	var sETag string = ""
+	if objRes, ok := objSnapshot.findResource(sZipName); true == ok && "" != objRes.MD5 {
+		sETag = strings.ToLower(objRes.MD5)
+	} else { // 不在资源列表中的文件(如实时资源)，用 文件长度+修改时间 作为ETag
+		sETag = fmt.Sprintf("%x-%x", objFileInfo.Size(), objFileInfo.ModTime().UnixNano())
+	}
+
+	resp.Header().Set("Content-Type", "application/zip")
+	resp.Header().Set("Content-Encoding", "zip")
+	resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", sZipName))
+	resp.Header().Set("ETag", fmt.Sprintf("\"%s\"", sETag))
+	http.ServeContent(resp, req, sZipName, objFileInfo.ModTime(), objFile) // 由ServeContent从文件流式下发，并处理 Range / If-Range 请求头
+}
+
+/**
+* @brief		取资源清单快照，并打开待下发的文件
+* @detail		与发布新一代资源文件(PublishGeneration())互斥，打开的文件总是与快照中的资源清单一致;
+				打开成功时，计入快照所属一代资源文件的下载数 和 文件的引用计数(调用方下载结束后调用 endDownload() + releaseFile())
+* @param[in]	sAccount		已登录的帐号
+* @return		资源清单快照 + 打开的文件(失败时为nil，已经应答了错误) + 重定向后的文件路径
+*/
+func (pSelf *FileSyncServer) openDownloadFile(resp http.ResponseWriter, req *http.Request, sAccount string) (*ResSnapshot, *os.File, string) {
+	var sZipName string = ""
+	var sResType string = ""
+
+	pSelf.objPublishLock.RLock()
+	defer pSelf.objPublishLock.RUnlock()
+	objSnapshot := pSelf.loadSnapshot() // 整个请求只使用同一个资源清单快照
 
-		// Marshal Obj 2 Xml String && Write 2 HTTP Response Object
-		if sResponse, err := xml.Marshal(&xmlRes); err != nil {
-			fmt.Fprintf(resp, "%s", err.Error())
+	// Check Whitelist Of Download File
+	sZipName, sResType = pSelf.redirectURI(objSnapshot, req.Form["uri"][0])
+	if false == pSelf.isDownloadAllowed(objSnapshot, sZipName) {
+		log.Printf("[SECURITY] FileSyncServer.handleDownload() : rejected uri outside of resource list && sync folder, uri=%s, account=%s, remote=%s", req.Form["uri"][0], sAccount, req.RemoteAddr)
+		writeError(resp, req, http.StatusForbidden, "download", "access denied, "+req.Form["uri"][0])
+		return objSnapshot, nil, sZipName
+	}
+
+	// Check Entitlement Of Account (不在资源列表中的文件，类型未知，只有可下载全部资源的帐号才能下载)
+	if objRes, ok := objSnapshot.findResource(sZipName); true == ok {
+		sResType = objRes.TYPE
+	}
+
+	if false == pSelf.isEntitled(sAccount, sResType) {
+		log.Printf("[SECURITY] FileSyncServer.handleDownload() : account is not entitled 2 resource, uri=%s, type=%s, account=%s, remote=%s", req.Form["uri"][0], sResType, sAccount, req.RemoteAddr)
+		writeError(resp, req, http.StatusForbidden, "download", "access denied, "+req.Form["uri"][0])
+		return objSnapshot, nil, sZipName
+	}
+
+	// Open Zip File (Windows平台上也允许发布新一代文件时改名，见 openSharedFile())
+	objFile, err := openSharedFile(sZipName)
+	if err != nil {
+		if true == os.IsNotExist(err) {
+			writeError(resp, req, http.StatusNotFound, "download", "data file is not exist, "+sZipName)
 		} else {
-			fmt.Fprintf(resp, "%s%s", xml.Header, string(sResponse))
+			writeError(resp, req, http.StatusInternalServerError, "download", "failed 2 load data file, "+sZipName)
 		}
+		return objSnapshot, nil, sZipName
 	}
+
+	objSnapshot.refGeneration.beginDownload()
+	pSelf.objFileRefs.Acquire(sZipName)
+
+	return objSnapshot, objFile, sZipName
 }
 
 /**
  * @brief		返回资源列表xml字符串
+ * @detail		带参数 since=<版本号> 时，返回从该版本到当前版本的增量清单(新增/变化/删除的项，见 diffResList());
+ 				该版本已不在保留的历史版本中(或比当前版本新)时，返回全量清单(没有since属性);
+ 				已删除资源的墓碑项只在增量清单中下发，全量清单中不带(兼容不认识removed属性的旧版本客户端)
+ * @note		只返回该帐号有权下载的资源类型;
+ 				请求头 Accept 为 application/json 时，返回json格式的资源列表;
+ 				配置了签名私钥时，应答头 X-Manifest-Signature 为 接口+版本号+应答体 的签名(见 manifestMessage())
  */
 func (pSelf *FileSyncServer) handleList(resp http.ResponseWriter, req *http.Request) {
-	if pSelf.authenticateSession(resp, req) == false {
+	sAccount, bIsOk := pSelf.authenticateSession(resp, req)
+	if false == bIsOk {
 		return
 	}
 
-	fmt.Fprintf(resp, "%s%s", xml.Header, []byte(pSelf.sResponseList))
+	pSelf.objPublishLock.RLock() // 与发布新一代资源文件互斥: 文件改名后、新清单发布前，不能取到旧清单
+	objSnapshot := pSelf.loadSnapshot()
+	pSelf.objPublishLock.RUnlock()
+	refResList := &objSnapshot.objResourceList
+	bIsDelta := false
+
+	// 增量清单
+	if sSince := req.Form.Get("since"); "" != sSince {
+		nSince, err := strconv.ParseUint(sSince, 10, 64)
+		if nil != err {
+			writeError(resp, req, http.StatusBadRequest, "list", "invalid argument, since="+sSince)
+			return
+		}
+
+		if objBaseList, ok := objSnapshot.findHistory(nSince); true == ok {
+			objDeltaList := diffResList(objBaseList, refResList)
+			refResList, bIsDelta = &objDeltaList, true
+		}
+	}
+
+	// 全量清单不带墓碑项
+	if false == bIsDelta {
+		objFullList, _ := stripTombstones(refResList)
+		refResList = &objFullList
+	}
+
+	// 按帐号可下载的资源类型过滤资源列表(未被过滤的帐号，直接下发已经生成好的xml串)
+	objResList, bFiltered := pSelf.filterResList(sAccount, refResList)
+	if true == acceptJSON(req) || true == bFiltered || true == bIsDelta {
+		bytesData, sContentType, err := marshalObject(req, &objResList)
+		if nil != err {
+			writeError(resp, req, http.StatusInternalServerError, "list", "cannot marshal resource list : "+err.Error())
+			return
+		}
+
+		if sSignature := signManifest(pSelf.ManifestSigningKey, "/list", objResList.Version, bytesData); "" != sSignature {
+			resp.Header().Set(ManifestSignatureHeader, sSignature)
+		}
+		resp.Header().Set("Content-Type", sContentType)
+		resp.Write(bytesData)
+		return
+	}
+
+	if "" != objSnapshot.sResponseSign {
+		resp.Header().Set(ManifestSignatureHeader, objSnapshot.sResponseSign)
+	}
+	resp.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	fmt.Fprintf(resp, "%s%s", xml.Header, []byte(objSnapshot.sResponseList))
+}
+
+/**
+ * @brief		返回实时资源列表
+ * @detail		每个已经发布过的实时资源一项: 资源类型 + 当前一代文件的URI(<别名>.<date>.<hhmm>，带SyncFolder，同资源列表中的URI) + MD5/SHA256/长度/生成时间;
+ 				客户端用该URI下载这一代文件(之后又生成了新的一代时，这一代文件按代保留，见 retainRealFile())，下载到的文件与列表中的校验码一致
+ * @note		只返回该帐号有权下载的资源类型; 列表同资源列表一样签名(应答头 X-Manifest-Signature);
+ 				请求头 Accept 为 application/json 时，返回json格式的列表
+ */
+func (pSelf *FileSyncServer) handleLive(resp http.ResponseWriter, req *http.Request) {
+	var objLiveList ResourceList
+	var lstAliases []string
+
+	sAccount, bIsOk := pSelf.authenticateSession(resp, req)
+	if false == bIsOk {
+		return
+	}
+
+	pSelf.objPublishLock.RLock() // 与发布新一代资源文件互斥
+	objSnapshot := pSelf.loadSnapshot()
+	pSelf.objPublishLock.RUnlock()
+	for sAlias := range objSnapshot.mapLiveFiles {
+		lstAliases = append(lstAliases, sAlias)
+	}
+
+	sort.Strings(lstAliases)
+	for _, sAlias := range lstAliases {
+		objRes := objSnapshot.mapLiveFiles[sAlias]
+		if true == pSelf.isEntitled(sAccount, objRes.TYPE) {
+			objLiveList.Download = append(objLiveList.Download, ResDownload{TYPE: objRes.TYPE, URI: filepath.ToSlash(filepath.Clean(objRes.URI)), MD5: objRes.MD5, SHA256: objRes.SHA256, SIZE: objRes.SIZE, UPDATE: objRes.UPDATE})
+		}
+	}
+
+	bytesData, sContentType, err := marshalObject(req, &objLiveList)
+	if nil != err {
+		writeError(resp, req, http.StatusInternalServerError, "live", "cannot marshal live resource list : "+err.Error())
+		return
+	}
+
+	if sSignature := signManifest(pSelf.ManifestSigningKey, "/live", objLiveList.Version, bytesData); "" != sSignature {
+		resp.Header().Set(ManifestSignatureHeader, sSignature)
+	}
+	resp.Header().Set("Content-Type", sContentType)
+	resp.Write(bytesData)
 }
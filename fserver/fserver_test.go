@@ -0,0 +1,440 @@
+/**
+ * @brief		资源下载网络服务的并发测试
+ * @detail		资源生成线程(FileScheduler)更新资源清单的同时，网络请求(/list /get)并发读取，
+ 				需要用 go test -race 运行
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		切换到临时工作目录(restable.dat / status.dat 都写在当前目录)
+ * @return		临时目录 + 恢复工作目录的函数
+ */
+func enterTempWorkDir(t *testing.T) (string, func()) {
+	sOldDir, err := os.Getwd()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	sTempDir, err := ioutil.TempDir("", "fserver_test")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(sTempDir); nil != err {
+		t.Fatal(err)
+	}
+
+	return sTempDir, func() {
+		os.Chdir(sOldDir)
+		os.RemoveAll(sTempDir)
+	}
+}
+
+/**
+ * @brief		生成一个测试用的资源文件，并返回其资源描述项
+ */
+func makeTestResource(t *testing.T, sSyncFolder string, nIndex int) ResDownload {
+	sFilePath := filepath.ToSlash(filepath.Join(sSyncFolder, fmt.Sprintf("SSE/DAY/DAY.%d", nIndex)))
+	if err := os.MkdirAll(filepath.Dir(sFilePath), 0755); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(sFilePath, []byte(fmt.Sprintf("resource data %d", nIndex)), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	return ResDownload{TYPE: "sse.d1", URI: sFilePath, MD5: fmt.Sprintf("%032x", nIndex), UPDATE: "20180410"}
+}
+
+/**
+ * @brief		发起一个带令牌的请求
+ */
+func doTestRequest(pSvr *FileSyncServer, fnHandler http.HandlerFunc, sUrl string) *httptest.ResponseRecorder {
+	objReq := httptest.NewRequest("GET", sUrl, nil)
+	objReq.Header.Set("Authorization", "Bearer "+issueToken(pSvr.TokenSecret, pSvr.Account, time.Now().Add(time.Hour)))
+	objResp := httptest.NewRecorder()
+	fnHandler(objResp, objReq)
+
+	return objResp
+}
+
+/**
+ * @brief		资源生成线程更新清单 与 /list /get 并发运行
+ * @detail		每次 /list 应答都必须是某一个完整发布的清单; 清单中的资源都能下载
+ */
+func TestManifestSnapshotConcurrency(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sSyncFolder := filepath.Join(sTempDir, "SyncFolder")
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", SyncFolder: sSyncFolder, TokenSecret: []byte("0123456789abcdef")}
+	objScheduler := &FileScheduler{SyncFolder: sSyncFolder, RefSyncSvr: objSvr, DataSrcCfg: map[string]DataSourceConfig{}}
+
+	var lstRes []ResDownload
+	for i := 0; i < 8; i++ {
+		lstRes = append(lstRes, makeTestResource(t, sSyncFolder, i))
+	}
+
+	objSvr.SetResList(&ResourceList{Download: lstRes[:1]})
+
+	var objWaitGroup sync.WaitGroup
+	objStopChan := make(chan bool)
+
+	// 资源生成方: 全量替换 + 增量更新 + 实时文件切换 + 调度器的指定类型压缩
+	objWaitGroup.Add(1)
+	go func() {
+		defer objWaitGroup.Done()
+		for i := 0; i < 64; i++ {
+			nCount := i%len(lstRes) + 1
+			objSvr.SetResList(&ResourceList{Download: lstRes[:nCount]})
+			objSvr.UpdateResList(&ResourceList{Download: lstRes[nCount-1 : nCount]})
+			objSvr.SetLiveFile("SSE/MIN1_TODAY/MIN1_TODAY", ResDownload{TYPE: "sse.real_m1", URI: lstRes[i%len(lstRes)].URI + ".none"})
+			objSvr.SetLiveFile("SZSE/MIN1_TODAY/MIN1_TODAY", ResDownload{TYPE: "szse.real_m1", URI: lstRes[i%len(lstRes)].URI + ".none"})
+			objScheduler.compressHistoryResource("hkse")
+		}
+		close(objStopChan)
+	}()
+
+	// 网络请求方: /list + /get
+	for n := 0; n < 4; n++ {
+		objWaitGroup.Add(1)
+		go func() {
+			defer objWaitGroup.Done()
+			for {
+				select {
+				case <-objStopChan:
+					return
+				default:
+				}
+
+				objResp := doTestRequest(objSvr, objSvr.handleList, "/list")
+				if http.StatusOK != objResp.Code {
+					t.Errorf("/list : unexpected status %d", objResp.Code)
+					return
+				}
+
+				var objList ResourceList
+				if err := xml.Unmarshal(objResp.Body.Bytes(), &objList); nil != err {
+					t.Errorf("/list : invalid xml : %s", err.Error())
+					return
+				}
+
+				for i, objRes := range objList.Download { // 清单总是 lstRes 的某个前缀(+ 墓碑项)
+					if true == objRes.Removed {
+						continue
+					}
+
+					if objRes.URI != lstRes[i].URI || objRes.MD5 != lstRes[i].MD5 {
+						t.Errorf("/list : inconsistent manifest at %d : %v", i, objRes)
+						return
+					}
+
+					objResp = doTestRequest(objSvr, objSvr.handleDownload, "/get?uri="+objRes.URI)
+					if http.StatusOK != objResp.Code {
+						t.Errorf("/get : unexpected status %d, uri=%s", objResp.Code, objRes.URI)
+						return
+					}
+				}
+
+				doTestRequest(objSvr, objSvr.handleDownload, "/get?uri=SSE/MIN1_TODAY/MIN1_TODAY")
+			}
+		}()
+	}
+
+	objWaitGroup.Wait()
+}
+
+/**
+ * @brief		增量更新不能修改已经发布的快照
+ */
+func TestUpdateResListKeepsPublishedSnapshot(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objSvr := &FileSyncServer{}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "a", MD5: "1"}}})
+	objOldSnapshot := objSvr.loadSnapshot()
+
+	objSvr.UpdateResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "a", MD5: "2"}}})
+	if "1" != objOldSnapshot.objResourceList.Download[0].MD5 {
+		t.Fatal("published snapshot has been modified")
+	}
+
+	if objRes, ok := objSvr.loadSnapshot().findResource("a"); false == ok || "2" != objRes.MD5 {
+		t.Fatal("resource is not updated :", objRes)
+	}
+}
+
+/**
+ * @brief		/list?since=<版本号> 返回增量清单
+ * @detail		历史版本 -> 增量清单; 当前版本 -> 空的增量清单; 未知版本 -> 全量清单(不带墓碑项)
+ */
+func TestListSinceReturnsDelta(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objSvr := &FileSyncServer{Account: "admin", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "a", MD5: "1"}, {TYPE: "sse.d1", URI: "b", MD5: "1"}}})
+	nOldVersion := objSvr.loadSnapshot().objResourceList.Version
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "a", MD5: "2"}, {TYPE: "sse.d1", URI: "c", MD5: "1"}}})
+	nNewVersion := objSvr.loadSnapshot().objResourceList.Version
+	if nNewVersion != nOldVersion+1 {
+		t.Fatalf("version is not increased : %d -> %d", nOldVersion, nNewVersion)
+	}
+
+	fnList := func(sUrl string) ResourceList {
+		var objList ResourceList
+		objResp := doTestRequest(objSvr, objSvr.handleList, sUrl)
+		if http.StatusOK != objResp.Code {
+			t.Fatalf("%s : unexpected status %d", sUrl, objResp.Code)
+		}
+
+		if err := xml.Unmarshal(objResp.Body.Bytes(), &objList); nil != err {
+			t.Fatalf("%s : invalid xml : %s", sUrl, err.Error())
+		}
+
+		return objList
+	}
+
+	objDelta := fnList(fmt.Sprintf("/list?since=%d", nOldVersion))
+	if nOldVersion != objDelta.Since || nNewVersion != objDelta.Version || 3 != len(objDelta.Download) {
+		t.Fatalf("unexpected delta : %+v", objDelta)
+	}
+
+	mapStatus := map[string]string{"a": RS_Changed, "c": RS_Added, "b": RS_Removed}
+	for _, objRes := range objDelta.Download {
+		if mapStatus[objRes.URI] != objRes.STATUS {
+			t.Errorf("unexpected status of %s : %s", objRes.URI, objRes.STATUS)
+		}
+	}
+
+	if objDelta = fnList(fmt.Sprintf("/list?since=%d", nNewVersion)); nNewVersion != objDelta.Since || 0 != len(objDelta.Download) {
+		t.Fatalf("unexpected delta : %+v", objDelta)
+	}
+
+	if objFull := fnList("/list?since=12345"); 0 != objFull.Since || nNewVersion != objFull.Version || 2 != len(objFull.Download) || true == objFull.Download[1].Removed {
+		t.Fatalf("unexpected full list : %+v", objFull)
+	}
+
+	if objResp := doTestRequest(objSvr, objSvr.handleList, "/list?since=abc"); http.StatusBadRequest != objResp.Code {
+		t.Fatalf("unexpected status %d", objResp.Code)
+	}
+}
+
+/**
+ * @brief		被合并的资源包在清单中留下墓碑项
+ * @detail		半月资源包被年资源包取代 ---> 墓碑项(supersededby=年资源包)，不可下载; 超出保留时间后，从清单中去掉
+ */
+func TestRemovedResourceTombstones(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objSvr := &FileSyncServer{Account: "admin", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{
+		{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170100", MD5: "1"},
+		{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170115", MD5: "2"},
+		{TYPE: "sse.m60", URI: "SSE/MIN60/MIN60.20170100", MD5: "3"},
+	}})
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{
+		{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170000", MD5: "4"},
+		{TYPE: "sse.m60", URI: "SSE/MIN60/MIN60.20170100", MD5: "3"},
+	}})
+
+	objList := objSvr.loadSnapshot().objResourceList
+	lstExpected := []ResDownload{
+		{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170000"},
+		{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170100", Removed: true, SupersededBy: "SSE/DAY/DAY.20170000"},
+		{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170115", Removed: true, SupersededBy: "SSE/DAY/DAY.20170000"},
+		{TYPE: "sse.m60", URI: "SSE/MIN60/MIN60.20170100"},
+	}
+	if len(lstExpected) != len(objList.Download) {
+		t.Fatalf("unexpected manifest : %+v", objList.Download)
+	}
+
+	for i, objRes := range objList.Download {
+		if objRes.URI != lstExpected[i].URI || objRes.Removed != lstExpected[i].Removed || objRes.SupersededBy != lstExpected[i].SupersededBy {
+			t.Errorf("unexpected resource at %d : %+v", i, objRes)
+		}
+	}
+
+	if objResp := doTestRequest(objSvr, objSvr.handleDownload, "/get?uri=SSE/DAY/DAY.20170100"); http.StatusOK == objResp.Code {
+		t.Error("tombstone is downloadable")
+	}
+
+	// 墓碑项保留到超出保留时间为止
+	objSvr.SetResList(&ResourceList{Download: objList.Download[:1]})
+	if nCount := len(objSvr.loadSnapshot().objResourceList.Download); 4 != nCount {
+		t.Fatalf("tombstones are not kept, count = %d", nCount)
+	}
+
+	nOldLifetime := nTombstoneLifetime
+	nTombstoneLifetime = -time.Second
+	defer func() { nTombstoneLifetime = nOldLifetime }()
+	objSvr.SetResList(&ResourceList{Download: objList.Download[:1]})
+	if nCount := len(objSvr.loadSnapshot().objResourceList.Download); 1 != nCount {
+		t.Fatalf("expired tombstones are not dropped, count = %d", nCount)
+	}
+}
+
+/**
+ * @brief		墓碑项只在增量清单中下发; 全量清单(/list 及 ./restable.dat)中不带墓碑项，旧版本客户端不会去下载已删除的资源
+ */
+func TestTombstonesOnlyInDelta(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objSvr := &FileSyncServer{Account: "admin", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170100", MD5: "1"}}})
+	nOldVersion := objSvr.loadSnapshot().objResourceList.Version
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "SSE/DAY/DAY.20170000", MD5: "2"}}})
+
+	fnCheckFullList := func(sDesc string) {
+		for _, sUrl := range []string{"/list", "/list?since=12345"} {
+			var objList ResourceList
+			objResp := doTestRequest(objSvr, objSvr.handleList, sUrl)
+			if err := xml.Unmarshal(objResp.Body.Bytes(), &objList); nil != err || 1 != len(objList.Download) || "SSE/DAY/DAY.20170000" != objList.Download[0].URI {
+				t.Errorf("%s : %s : unexpected full list : %s", sDesc, sUrl, objResp.Body.String())
+			}
+		}
+
+		if bytesData, _ := ioutil.ReadFile("./restable.dat"); true == strings.Contains(string(bytesData), "removed") {
+			t.Errorf("%s : tombstone is saved into ./restable.dat : %s", sDesc, string(bytesData))
+		}
+	}
+
+	fnCheckFullList("published")
+
+	// 增量清单带有删除的资源(及取代它的资源)
+	var objDelta ResourceList
+	objResp := doTestRequest(objSvr, objSvr.handleList, fmt.Sprintf("/list?since=%d", nOldVersion))
+	if err := xml.Unmarshal(objResp.Body.Bytes(), &objDelta); nil != err || 2 != len(objDelta.Download) || false == objDelta.Download[1].Removed || "SSE/DAY/DAY.20170000" != objDelta.Download[1].SupersededBy {
+		t.Fatalf("unexpected delta : %s", objResp.Body.String())
+	}
+
+	// 之前版本存盘的清单带有墓碑项时，加载后下发的全量清单也不带墓碑项
+	ioutil.WriteFile("./restable.dat", []byte(`<resource version="9"><download type="sse.d1" uri="SSE/DAY/DAY.20170000" md5="2" update=""></download><download type="sse.d1" uri="SSE/DAY/DAY.20170100" md5="1" update="2017-12-31 00:00:00" removed="true"></download></resource>`), 0644)
+	objSvr = &FileSyncServer{Account: "admin", TokenSecret: []byte("0123456789abcdef")}
+	if false == objSvr.LoadResList() {
+		t.Fatal("cannot load ./restable.dat")
+	}
+
+	os.Remove("./restable.dat")
+	fnCheckFullList("loaded")
+}
+
+/**
+ * @brief		/list 和 /live 的应答带有正确的签名(全量清单 + 增量清单 + 实时资源列表)，签名绑定了接口和清单版本号
+ */
+func TestListIsSigned(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objPublicKey, objPrivateKey, err := ed25519.GenerateKey(nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	objSvr := &FileSyncServer{Account: "admin", TokenSecret: []byte("0123456789abcdef"), ManifestSigningKey: objPrivateKey}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "a", MD5: "1"}}})
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: "a", MD5: "2"}}})
+	objSvr.SetLiveFile("SSE/MIN5_TODAY/MIN5_TODAY", ResDownload{TYPE: "sse.m5", URI: "SSE/MIN5_TODAY/MIN5_TODAY.20180410.930", MD5: "3"})
+
+	for _, objCase := range []struct {
+		sUrl      string
+		fnHandler http.HandlerFunc
+		sEndpoint string
+		nVersion  uint64
+	}{
+		{"/list", objSvr.handleList, "/list", 2},
+		{"/list?since=1", objSvr.handleList, "/list", 2},
+		{"/live", objSvr.handleLive, "/live", 0},
+	} {
+		objResp := doTestRequest(objSvr, objCase.fnHandler, objCase.sUrl)
+		bytesSignature, err := base64.StdEncoding.DecodeString(objResp.Header().Get(ManifestSignatureHeader))
+		if nil != err || false == ed25519.Verify(objPublicKey, manifestMessage(objCase.sEndpoint, objCase.nVersion, objResp.Body.Bytes()), bytesSignature) {
+			t.Errorf("%s : invalid signature", objCase.sUrl)
+		}
+
+		// 签名不能用于其它接口/其它版本
+		if true == ed25519.Verify(objPublicKey, objResp.Body.Bytes(), bytesSignature) || true == ed25519.Verify(objPublicKey, manifestMessage("/other", objCase.nVersion, objResp.Body.Bytes()), bytesSignature) ||
+			true == ed25519.Verify(objPublicKey, manifestMessage(objCase.sEndpoint, objCase.nVersion+1, objResp.Body.Bytes()), bytesSignature) {
+			t.Errorf("%s : signature should be bound to the endpoint and the version", objCase.sUrl)
+		}
+	}
+}
+
+/**
+ * @brief		/get 只允许下载资源列表中的，或SyncFolder目录内的文件
+ * @detail		路径穿越(../)、SyncFolder之外的绝对路径、指向SyncFolder之外的符号链接、
+ 				同级的暂存目录/退役目录(<SyncFolder>.staging / <SyncFolder>.retired) 都不允许下载
+ */
+func TestDownloadIsConfinedToSyncFolder(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objSvr := &FileSyncServer{Account: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	objRes := makeTestResource(t, "./SyncFolder/", 1)
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{objRes, {TYPE: "sse.d1", URI: "Listed/DAY.2", MD5: "2"}}})
+
+	for _, sFolder := range []string{"Outside", stagingFolderOf("./SyncFolder/"), retiredFolderOf("./SyncFolder/")} {
+		os.MkdirAll(sFolder, 0755)
+		ioutil.WriteFile(filepath.Join(sFolder, "secret"), []byte("secret"), 0644)
+	}
+
+	ioutil.WriteFile("SyncFolder/SSE/unlisted", []byte("unlisted"), 0644)
+	if err := os.Symlink(filepath.Join(sTempDir, "Outside", "secret"), "SyncFolder/SSE/link2file"); nil != err {
+		t.Skip("symlink is not supported : ", err.Error())
+	}
+
+	os.Symlink(filepath.Join(sTempDir, "Outside"), "SyncFolder/SSE/link2folder")
+
+	objSnapshot, sAbsInside, sAbsOutside := objSvr.loadSnapshot(), filepath.Join(sTempDir, "SyncFolder/SSE/unlisted"), filepath.Join(sTempDir, "Outside/secret")
+	for sFilePath, bAllowed := range map[string]bool{
+		objRes.URI:                                   true,  // 资源列表中的文件
+		"Listed/DAY.2":                               true,  // 资源列表中的文件(SyncFolder之外)
+		"SyncFolder/SSE/unlisted":                    true,  // SyncFolder目录内的文件
+		sAbsInside:                                   true,  // SyncFolder目录内的文件(绝对路径)
+		"../../etc/passwd":                           false, // 路径穿越
+		"SyncFolder/../../../../etc/passwd":          false, // 路径穿越
+		"SyncFolder/../Outside/secret":               false, // 路径穿越
+		"/etc/passwd":                                false, // SyncFolder之外的绝对路径
+		sAbsOutside:                                  false, // SyncFolder之外的绝对路径
+		"SyncFolder/SSE/link2file":                   false, // 指向SyncFolder之外的符号链接
+		"SyncFolder/SSE/link2folder/secret":          false, // 指向SyncFolder之外的符号链接(目录)
+		stagingFolderOf("./SyncFolder/") + "/secret": false, // 同级的暂存目录
+		retiredFolderOf("./SyncFolder/") + "/secret": false, // 同级的退役目录
+	} {
+		if bAllowed != objSvr.isDownloadAllowed(objSnapshot, sFilePath) {
+			t.Errorf("%s : expect allowed = %v", sFilePath, bAllowed)
+		}
+	}
+
+	// 通过 /get 请求: 不允许的文件应答403，且不下发内容
+	for _, sUri := range []string{"../../etc/passwd", "/etc/passwd", "SyncFolder/SSE/link2file", retiredFolderOf("./SyncFolder/") + "/secret"} {
+		if objResp := doTestRequest(objSvr, objSvr.handleDownload, "/get?uri="+sUri); http.StatusForbidden != objResp.Code {
+			t.Errorf("%s : unexpected status %d", sUri, objResp.Code)
+		}
+	}
+
+	if objResp := doTestRequest(objSvr, objSvr.handleDownload, "/get?uri="+objRes.URI); http.StatusOK != objResp.Code || "resource data 1" != objResp.Body.String() {
+		t.Errorf("%s : unexpected status %d", objRes.URI, objResp.Code)
+	}
+}
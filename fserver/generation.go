@@ -0,0 +1,159 @@
+/**
+ * @brief		资源文件的分代发布
+ * @detail		每次压缩生成的新一代压缩文件，先写入暂存目录(<SyncFolder>.staging，目录结构同SyncFolder)，
+ 				全部压缩完成后，再与新的资源清单一起发布(改名到SyncFolder，见 FileSyncServer.PublishGeneration());
+ 				被替换的旧一代文件移到退役目录(<SyncFolder>.retired/<发布时间>)，等旧一代的下载全部结束后再删除
+ * @note		暂存/退役目录与SyncFolder同级(同一个文件系统中才能改名)，且不在SyncFolder之内(不会被下载)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/**
+ * @brief		SyncFolder对应的暂存目录
+ */
+func stagingFolderOf(sSyncFolder string) string {
+	return filepath.Clean(sSyncFolder) + ".staging"
+}
+
+/**
+ * @brief		SyncFolder对应的退役目录
+ */
+func retiredFolderOf(sSyncFolder string) string {
+	return filepath.Clean(sSyncFolder) + ".retired"
+}
+
+/**
+ * @Class 		StagedFile
+ * @brief		暂存目录中一个待发布的文件
+ * @author		barry
+ */
+type StagedFile struct {
+	RelPath    string // 相对于 暂存目录/发布目录 的路径
+	StagedPath string // 暂存路径
+	LivePath   string // 发布后的路径(即资源URI)
+}
+
+/**
+ * @brief		列出暂存目录中全部待发布的文件
+ * @param[in]	sStagingFolder	暂存目录(不存在时，没有待发布的文件)
+ * @param[in]	sTargetFolder	发布目录
+ * @return		待发布的文件 + 错误
+ */
+func listStagedFiles(sStagingFolder string, sTargetFolder string) ([]StagedFile, error) {
+	var lstStaged []StagedFile
+
+	if _, err := os.Stat(sStagingFolder); true == os.IsNotExist(err) {
+		return lstStaged, nil
+	}
+
+	err := filepath.Walk(sStagingFolder, func(sPath string, objFileInfo os.FileInfo, err error) error {
+		if nil != err || true == objFileInfo.IsDir() {
+			return err
+		}
+
+		sRelPath, err := filepath.Rel(sStagingFolder, sPath)
+		if nil == err {
+			lstStaged = append(lstStaged, StagedFile{RelPath: sRelPath, StagedPath: sPath, LivePath: filepath.ToSlash(filepath.Join(sTargetFolder, sRelPath))})
+		}
+
+		return err
+	})
+
+	return lstStaged, err
+}
+
+/**
+ * @brief		把暂存的文件改名到发布目录(被替换的文件先移到退役目录)
+ * @param[in]	lstStaged		待发布的文件
+ * @param[in]	sRetiredFolder	本次的退役目录
+ * @return		true			全部改名成功
+ 				false			有改名失败(已经完成的改名倒序恢复原状)
+ * @note		被替换的文件可能正在下载中(Windows平台上，下载时以共享删除方式打开，见 openSharedFile())
+ */
+func swapStagedFiles(lstStaged []StagedFile, sRetiredFolder string) bool {
+	var lstDone [][2]string // 已经完成的改名(原路径, 新路径)
+
+	fnRename := func(sFrom, sTo string) bool {
+		err := os.MkdirAll(filepath.Dir(sTo), 0755)
+		if nil == err {
+			err = os.Rename(sFrom, sTo)
+		}
+
+		if nil != err {
+			log.Println("[ERR] swapStagedFiles() : cannot rename file :", sFrom, "--->", sTo, err.Error())
+			return false
+		}
+
+		lstDone = append(lstDone, [2]string{sFrom, sTo})
+		return true
+	}
+
+	for _, objStaged := range lstStaged {
+		bIsOk := true
+		if _, err := os.Stat(objStaged.LivePath); nil == err {
+			bIsOk = fnRename(objStaged.LivePath, filepath.Join(sRetiredFolder, objStaged.RelPath))
+		}
+
+		if false == bIsOk || false == fnRename(objStaged.StagedPath, objStaged.LivePath) {
+			for i := len(lstDone) - 1; i >= 0; i-- {
+				os.Rename(lstDone[i][1], lstDone[i][0])
+			}
+
+			return false
+		}
+	}
+
+	return true
+}
+
+/**
+ * @Class 		ResGeneration
+ * @brief		一代已发布的资源文件(统计正在下载这一代文件的请求)
+ * @author		barry
+ */
+type ResGeneration struct {
+	objDownloads sync.WaitGroup // 进行中的下载请求
+}
+
+/**
+ * @brief		开始下载这一代的文件
+ */
+func (pSelf *ResGeneration) beginDownload() {
+	if nil != pSelf {
+		pSelf.objDownloads.Add(1)
+	}
+}
+
+/**
+ * @brief		下载结束
+ */
+func (pSelf *ResGeneration) endDownload() {
+	if nil != pSelf {
+		pSelf.objDownloads.Done()
+	}
+}
+
+/**
+ * @brief		退役: 这一代的下载全部结束后，删除被替换下来的文件
+ * @param[in]	sRetiredFolder	被替换下来的文件所在的退役目录
+ * @note		只在新一代发布后调用(之后不会再有请求开始下载这一代的文件)
+ */
+func (pSelf *ResGeneration) retire(sRetiredFolder string) {
+	go func() {
+		if nil != pSelf {
+			pSelf.objDownloads.Wait()
+		}
+
+		if err := os.RemoveAll(sRetiredFolder); nil != err {
+			log.Println("[WARN] ResGeneration.retire() : cannot remove retired files :", sRetiredFolder, err.Error())
+		}
+	}()
+}
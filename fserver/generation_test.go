@@ -0,0 +1,177 @@
+/**
+ * @brief		资源文件分代发布的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		压缩到暂存目录的文件，发布前不可见; 发布后与资源清单一致，被替换的文件等旧一代的下载结束后才删除
+ */
+func TestPublishGeneration(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sArchive, sStagingFolder := "SyncFolder/SSE/DAY/DAY.20160000", stagingFolderOf("./SyncFolder/")
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	fnCheckDownload := func() {
+		objResp := doTestRequest(objSvr, objSvr.handleDownload, "/get?uri="+sArchive)
+		objRes, _ := objSvr.loadSnapshot().findResource(sArchive)
+		if http.StatusOK != objResp.Code || objRes.MD5 != fmt.Sprintf("%x", md5.Sum(objResp.Body.Bytes())) {
+			t.Fatalf("downloaded archive does not match the manifest : status=%d, %+v", objResp.Code, objRes)
+		}
+	}
+
+	fnPublish := func(fnBeforePublish func()) {
+		objCompressor := Compressor{TargetFolder: "./SyncFolder/", StagingFolder: sStagingFolder, StateFolder: "./buildstate/"}
+		lstRes, bIsOk := objCompressor.XCompress("sse.d1", &DataSourceConfig{MkID: "sse", Folder: "./DAY/"}, nil)
+		if false == bIsOk || 1 != len(lstRes) || sArchive != lstRes[0].URI {
+			t.Fatalf("unexpected resources : %+v", lstRes)
+		}
+
+		if _, err := os.Stat(sStagingFolder + "/SSE/DAY/DAY.20160000"); nil != err {
+			t.Fatal("archive is not staged : ", err.Error())
+		}
+
+		fnBeforePublish()
+
+		if false == objSvr.PublishGeneration("./SyncFolder/", sStagingFolder, &ResourceList{Download: lstRes}, false) {
+			t.Fatal("cannot publish generation")
+		}
+	}
+
+	os.MkdirAll("./DAY/", 0755)
+	writeOldSourceFile(t, "./DAY/600000.csv", "20160104,10,11,9,10.5,0,100,10,0,1,0\n", 5)
+	fnPublish(func() {
+		if _, err := os.Stat(sArchive); false == os.IsNotExist(err) {
+			t.Fatal("archive should not be visible before publishing")
+		}
+	})
+
+	fnCheckDownload()
+	if _, err := os.Stat(sStagingFolder); false == os.IsNotExist(err) {
+		t.Error("staging folder should be removed after publishing")
+	}
+
+	// 旧一代的下载进行中: 源文件有变化，重新压缩并发布新一代
+	refOldGeneration := objSvr.loadSnapshot().refGeneration
+	refOldGeneration.beginDownload()
+	writeOldSourceFile(t, "./DAY/600000.csv", "20160105,10.5,12,10,11,0,100,10,0,1,0\n", 4)
+	fnPublish(fnCheckDownload) // 发布前，下载的仍是与旧清单一致的旧文件
+	fnCheckDownload()
+
+	// 源文件没有变化: 已经发布的压缩文件与构建状态一致，不再重新生成
+	objCompressor := Compressor{TargetFolder: "./SyncFolder/", StagingFolder: sStagingFolder, StateFolder: "./buildstate/"}
+	if lstRes, _ := objCompressor.XCompress("sse.d1", &DataSourceConfig{MkID: "sse", Folder: "./DAY/"}, nil); 1 != len(lstRes) {
+		t.Fatalf("unexpected resources : %+v", lstRes)
+	} else if lstStaged, _ := listStagedFiles(sStagingFolder, "./SyncFolder/"); 0 != len(lstStaged) {
+		t.Fatalf("published archive should not be rebuilt : %+v", lstStaged)
+	}
+
+	sRetiredFile := retiredFolderOf("./SyncFolder/") + "/*/SSE/DAY/DAY.20160000"
+	time.Sleep(time.Millisecond * 50)
+	if lstFiles, _ := filepath.Glob(sRetiredFile); 1 != len(lstFiles) {
+		t.Fatalf("replaced archive should be kept until downloads drain : %v", lstFiles)
+	}
+
+	refOldGeneration.endDownload()
+	for i := 0; i < 100; i++ {
+		if lstFiles, _ := filepath.Glob(sRetiredFile); 0 == len(lstFiles) {
+			return
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Error("replaced archive should be removed after downloads drain")
+}
+
+/**
+ * @brief		文件改名失败时，不发布任何新快照(资源列表请求取到的仍是旧清单)
+ */
+func TestPublishGenerationFailureKeepsSnapshot(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sStagingFolder := stagingFolderOf("./SyncFolder/")
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{makeTestResource(t, "./SyncFolder/", 1)}})
+	refOldSnapshot := objSvr.loadSnapshot()
+	sOldList := doTestRequest(objSvr, objSvr.handleList, "/list").Body.String()
+
+	// 发布目录中同名的普通文件占住了目录位置: 暂存文件无法改名到发布目录
+	os.MkdirAll(sStagingFolder+"/SSE/BLOCKED/", 0755)
+	ioutil.WriteFile(sStagingFolder+"/SSE/BLOCKED/DAY.2", []byte("resource data 2"), 0644)
+	ioutil.WriteFile("./SyncFolder/SSE/BLOCKED", []byte("not a folder"), 0644)
+
+	lstRes := []ResDownload{{TYPE: "sse.d1", URI: "SyncFolder/SSE/BLOCKED/DAY.2", MD5: "none"}}
+	if true == objSvr.PublishGeneration("./SyncFolder/", sStagingFolder, &ResourceList{Download: lstRes}, true) {
+		t.Fatal("publishing should fail")
+	}
+
+	if refOldSnapshot != objSvr.loadSnapshot() {
+		t.Error("snapshot should not be replaced when publishing fails")
+	}
+
+	if sList := doTestRequest(objSvr, objSvr.handleList, "/list").Body.String(); sOldList != sList {
+		t.Errorf("unexpected resource list : %s", sList)
+	}
+
+	if false == fileExists(sStagingFolder+"/SSE/BLOCKED/DAY.2") {
+		t.Error("staged file should be kept when publishing fails")
+	}
+}
+
+/**
+ * @brief		下载进行中(文件已打开)时发布新一代: 被替换的文件照常移到退役目录，进行中的下载读到的仍是旧文件
+ */
+func TestPublishGenerationWhileFileIsOpen(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sArchive, sStagingFolder := "SyncFolder/SSE/DAY/DAY.1", stagingFolderOf("./SyncFolder/")
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetResList(&ResourceList{Download: []ResDownload{makeTestResource(t, "./SyncFolder/", 1)}})
+	bytesOldData, _ := ioutil.ReadFile(sArchive)
+
+	// 与 /get 相同的方式打开文件，并在发布结束后才读取
+	objReq := httptest.NewRequest("GET", "/get?uri="+sArchive, nil)
+	objReq.ParseForm()
+	objSnapshot, objFile, sZipName := objSvr.openDownloadFile(httptest.NewRecorder(), objReq, "admin")
+	if nil == objFile {
+		t.Fatal("cannot open archive 4 download")
+	}
+
+	os.MkdirAll(sStagingFolder+"/SSE/DAY/", 0755)
+	ioutil.WriteFile(sStagingFolder+"/SSE/DAY/DAY.1", []byte("resource data of new generation"), 0644)
+	bIsOk := objSvr.PublishGeneration("./SyncFolder/", sStagingFolder, &ResourceList{Download: []ResDownload{{TYPE: "sse.d1", URI: sArchive, MD5: "none"}}}, true)
+
+	bytesData, err := ioutil.ReadAll(objFile)
+	objFile.Close()
+	objSvr.releaseFile(sZipName)
+	objSnapshot.refGeneration.endDownload()
+
+	if false == bIsOk {
+		t.Fatal("publishing should not fail while a file is being downloaded")
+	}
+
+	if nil != err || string(bytesOldData) != string(bytesData) {
+		t.Errorf("download in progress should read the old file : %s, %v", bytesData, err)
+	}
+
+	if bytesData, _ = ioutil.ReadFile(sArchive); "resource data of new generation" != string(bytesData) {
+		t.Errorf("archive is not replaced : %s", bytesData)
+	}
+}
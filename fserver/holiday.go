@@ -0,0 +1,167 @@
+/**
+ * @brief		交易所休市日历
+ * @detail		各市场的休市日(节假日)从文件加载(<market id="SSE" holidays="holidays/sse.txt">，相对路径相对于配置文件所在目录)，文件格式:
+ 				每行一个日期(yyyymmdd)，或一个日期段(yyyymmdd~yyyymmdd)，'#'后为注释，如:
+ 					# 2018 元旦 / 春节
+ 					20180101
+ 					20180215~20180221
+ * @note		周六、周日总是休市，不需要写在文件中; 没有配置休市日历的市场，只按周末判断交易日
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	nRecentTradingDays       int = 12 // 最近n个交易日内的数据为近期数据(一天一个压缩文件)
+	nRecentTradingDays4KLine int = 13 // 日线、60分钟线: 最近n个交易日内的数据为近期数据
+)
+
+/**
+ * @Class 		HolidayCalendar
+ * @brief		某市场的休市日历
+ * @note 		nil 日历只按周末判断交易日
+ * @author		barry
+ */
+type HolidayCalendar struct {
+	File        string       // 休市日历文件路径
+	mapHolidays map[int]bool // 休市日(yyyymmdd，不含周末)
+}
+
+/**
+ * @brief		从文件加载休市日历
+ * @param[in]	sFile			休市日历文件路径
+ */
+func LoadHolidayCalendar(sFile string) (*HolidayCalendar, error) {
+	objFile, err := os.Open(sFile)
+	if nil != err {
+		return nil, err
+	}
+
+	defer objFile.Close()
+	objCalendar := &HolidayCalendar{File: sFile, mapHolidays: make(map[int]bool)}
+	objScanner := bufio.NewScanner(objFile)
+	for nLineNo := 1; objScanner.Scan(); nLineNo++ {
+		sLine := objScanner.Text()
+		if nPos := strings.Index(sLine, "#"); nPos >= 0 {
+			sLine = sLine[:nPos]
+		}
+
+		if sLine = strings.TrimSpace(sLine); "" == sLine {
+			continue
+		}
+
+		lstDateStr := strings.Split(sLine, "~")
+		objBegin, err := parseHolidayDate(lstDateStr[0])
+		objEnd := objBegin
+		if nil == err && 2 == len(lstDateStr) {
+			objEnd, err = parseHolidayDate(lstDateStr[1])
+		}
+
+		if nil != err || len(lstDateStr) > 2 || objEnd.Before(objBegin) {
+			return nil, fmt.Errorf("invalid holiday (yyyymmdd or yyyymmdd~yyyymmdd) at %s:%d : %s", sFile, nLineNo, sLine)
+		}
+
+		for objDate := objBegin; false == objDate.After(objEnd); objDate = objDate.AddDate(0, 0, 1) {
+			objCalendar.mapHolidays[dateOf(objDate)] = true
+		}
+	}
+
+	if err := objScanner.Err(); nil != err {
+		return nil, err
+	}
+
+	return objCalendar, nil
+}
+
+/**
+ * @brief		休市日数量(不含周末)
+ */
+func (pSelf *HolidayCalendar) Count() int {
+	if nil == pSelf {
+		return 0
+	}
+
+	return len(pSelf.mapHolidays)
+}
+
+/**
+ * @brief		判断某天是否为交易日(非周末，且不是休市日)
+ * @param[in]	objDate			日期
+ */
+func (pSelf *HolidayCalendar) IsTradingDay(objDate time.Time) bool {
+	if time.Saturday == objDate.Weekday() || time.Sunday == objDate.Weekday() {
+		return false
+	}
+
+	return nil == pSelf || false == pSelf.mapHolidays[dateOf(objDate)]
+}
+
+/**
+ * @brief		从某天(含)向前数，第n个交易日的日期
+ * @param[in]	objDate			日期
+ * @param[in]	nTradingDays	交易日数(>=1)
+ * @return		日期(yyyymmdd)
+ * @note		用于判断数据日期是否为"近期"(最近n个交易日内): 比按自然日判断，不受长假的影响
+ */
+func (pSelf *HolidayCalendar) NthTradingDayBack(objDate time.Time, nTradingDays int) int {
+	objDate = time.Date(objDate.Year(), objDate.Month(), objDate.Day(), 12, 0, 0, 0, time.Local)
+	for nCount, i := 0, 0; i < 3660; i++ { // 最多向前找10年(防止休市日历配置错误时死循环)
+		if true == pSelf.IsTradingDay(objDate) {
+			if nCount++; nCount >= nTradingDays {
+				break
+			}
+		}
+
+		objDate = objDate.AddDate(0, 0, -1)
+	}
+
+	return dateOf(objDate)
+}
+
+/**
+ * @brief		从某天(含)向后数，第一个交易日的日期
+ * @param[in]	objDate			日期
+ * @return		日期(yyyymmdd)
+ */
+func (pSelf *HolidayCalendar) NextTradingDay(objDate time.Time) int {
+	objDate = time.Date(objDate.Year(), objDate.Month(), objDate.Day(), 12, 0, 0, 0, time.Local)
+	for i := 0; i < 3660 && false == pSelf.IsTradingDay(objDate); i++ { // 最多向后找10年(防止休市日历配置错误时死循环)
+		objDate = objDate.AddDate(0, 0, 1)
+	}
+
+	return dateOf(objDate)
+}
+
+/**
+ * @brief		把yyyymmdd串转成日期
+ */
+func parseHolidayDate(sDate string) (time.Time, error) {
+	sDate = strings.TrimSpace(sDate)
+	nDate, err := strconv.Atoi(sDate)
+	if nil != err || 8 != len(sDate) {
+		return time.Time{}, fmt.Errorf("invalid date : %s", sDate)
+	}
+
+	objDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 12, 0, 0, 0, time.Local)
+	if dateOf(objDate) != nDate {
+		return time.Time{}, fmt.Errorf("invalid date : %s", sDate)
+	}
+
+	return objDate, nil
+}
+
+/**
+ * @brief		日期转成yyyymmdd
+ */
+func dateOf(objDate time.Time) int {
+	return objDate.Year()*10000 + int(objDate.Month())*100 + objDate.Day()
+}
@@ -0,0 +1,58 @@
+/**
+ * @brief		休市日历的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		休市日历文件: 单日 + 日期段 + 注释; 近期交易日的计算跳过周末和休市日
+ */
+func TestHolidayCalendar(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	sFile := filepath.Join(sTempDir, "sse.txt")
+	ioutil.WriteFile(sFile, []byte("# holidays\n20181231   # new year's eve\n20190101\n\n20190204~20190208 # spring festival\n"), 0644)
+	objCalendar, err := LoadHolidayCalendar(sFile)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	fnDate := func(nDate int) time.Time {
+		return time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 9, 30, 0, 0, time.Local)
+	}
+
+	for nDate, bIsTradingDay := range map[int]bool{20181228: true, 20181229: false, 20181231: false, 20190102: true, 20190206: false, 20190211: true} {
+		if objCalendar.IsTradingDay(fnDate(nDate)) != bIsTradingDay {
+			t.Errorf("IsTradingDay(%d) != %v", nDate, bIsTradingDay)
+		}
+	}
+
+	if true == (*HolidayCalendar)(nil).IsTradingDay(fnDate(20181229)) || false == (*HolidayCalendar)(nil).IsTradingDay(fnDate(20181231)) {
+		t.Error("calendar without holidays should only skip weekends")
+	}
+
+	// 2019/2/12 往前数3个交易日: 2/12 + 2/11 + 2/1 (春节休市 2/4~2/8)
+	if nDate := objCalendar.NthTradingDayBack(fnDate(20190212), 3); 20190201 != nDate {
+		t.Errorf("NthTradingDayBack() = %d, expect 20190201", nDate)
+	}
+
+	if nDate := objCalendar.NthTradingDayBack(fnDate(20190102), 2); 20181228 != nDate {
+		t.Errorf("NthTradingDayBack() = %d, expect 20181228", nDate)
+	}
+
+	for _, sContent := range []string{"2019010\n", "20190230\n", "20190208~20190204\n", "20190101~20190102~20190103\n"} {
+		ioutil.WriteFile(sFile, []byte(sContent), 0644)
+		if _, err := LoadHolidayCalendar(sFile); nil == err {
+			t.Errorf("invalid holiday should not be loaded : %s", sContent)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/**
+ * @brief		实时资源(盘中定时刷新的资源)
+ * @detail		任意市场 + 任意已注册的数据类型，都可以配置为实时资源(<market>节点下的<live>节点)，如:
+ 				<market id="SSE">
+ 					<live name="MIN5_TODAY" datatype="m5" folder="D:\HQHISDATA\SSE\MIN\" interval="300"/>
+ 					<live name="STATIC_TODAY" datatype="st" folder="D:\HQHISDATA\SSE\STATIC\" interval="600" window="0900~1530"/>
+ 				</market>
+ 				盘中每隔interval秒，把数据源中今天的数据压缩成新的一代文件(<SyncFolder>/<市场编号>/<别名>/<别名>.<date>.<hhmm>)，
+ 				客户端从 /live 取当前一代文件的URI下载，也可以通过固定的别名URI(<市场编号>/<别名>/<别名>)下载当前的一代(见 FileSyncServer.redirectURI())
+ * @note		生成时间窗口缺省为市场交易日的 开盘 ~ 收盘后n分钟(见 TradingSessions.InRealRebuildWindow());
+ 				旧的配置方式 <datatype name="real_m1"/> 等同于 <live name="MIN1_TODAY" datatype="real_m1" interval="300"/>
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nDefaultLiveInterval int = 300 // 实时资源缺省的刷新间隔(秒)
+)
+
+/**
+ * @Class 		LiveResourceConfig
+ * @brief		从配置文件加载的一个实时资源
+ * @author		barry
+ */
+type LiveResourceConfig struct {
+	Name     string           // 别名(如: MIN5_TODAY)
+	ResType  string           // 资源类型(市场编号.数据类型，如: sse.m5)
+	Interval time.Duration    // 刷新间隔
+	Window   TradingSessions  // 生成时间窗口(为空时，按市场的交易时段)
+	DataSrc  DataSourceConfig // 数据源(市场编号 + 目录 + 交易时段 + 休市日历)
+}
+
+/**
+ * @brief		xml配置文件中<market>节点下的<live>节点
+ */
+type xmlLiveConfig struct {
+	Name     string `xml:"name,attr"`
+	DataType string `xml:"datatype,attr"`
+	Folder   string `xml:"folder,attr"`
+	Interval string `xml:"interval,attr"`
+	Window   string `xml:"window,attr"`
+}
+
+/**
+ * @brief		解析<live>节点中的 别名 + 刷新间隔 + 生成时间窗口
+ * @param[in]	refXmlLive		<live>节点
+ * @note		数据类型和数据源目录由调用者登记(与<datatype>节点相同，需要通过记录格式注册表检查)
+ */
+func (pSelf *LiveResourceConfig) load(refXmlLive *xmlLiveConfig) error {
+	var nInterval int = nDefaultLiveInterval
+
+	pSelf.Name = strings.TrimSpace(refXmlLive.Name)
+	if "" == pSelf.Name || strings.ContainsAny(pSelf.Name, "./\\ ") {
+		return fmt.Errorf("invalid name of live resource : %s", refXmlLive.Name)
+	}
+
+	if sInterval := strings.TrimSpace(refXmlLive.Interval); "" != sInterval {
+		var err error
+		if nInterval, err = strconv.Atoi(sInterval); nil != err || nInterval < 1 {
+			return fmt.Errorf("invalid interval of live resource %s (seconds) : %s", pSelf.Name, refXmlLive.Interval)
+		}
+	}
+
+	pSelf.Interval = time.Duration(nInterval) * time.Second
+	for _, sWindow := range strings.Split(refXmlLive.Window, ",") {
+		if "" == strings.TrimSpace(sWindow) {
+			continue
+		}
+
+		var objWindow TradingSession
+		if err := objWindow.Parse(sWindow); nil != err {
+			return fmt.Errorf("invalid window of live resource %s : %s", pSelf.Name, err.Error())
+		}
+
+		pSelf.Window = append(pSelf.Window, objWindow)
+	}
+
+	return nil
+}
+
+/**
+ * @brief		别名URI(相对于SyncFolder，如: SSE/MIN5_TODAY/MIN5_TODAY)
+ */
+func (pSelf *LiveResourceConfig) AliasURI() string {
+	return strings.ToUpper(pSelf.DataSrc.MkID) + "/" + pSelf.Name + "/" + pSelf.Name
+}
+
+/**
+ * @brief		判断是否在生成时间窗口内(市场的交易日 + 配置的时间窗口，或 开盘 ~ 收盘后n分钟)
+ * @param[in]	objNow			当前时间
+ */
+func (pSelf *LiveResourceConfig) InWindow(objNow time.Time) bool {
+	if false == pSelf.DataSrc.Holidays.IsTradingDay(objNow) {
+		return false
+	}
+
+	nNowT := objNow.Hour()*10000 + objNow.Minute()*100 + objNow.Second()
+	if len(pSelf.Window) > 0 {
+		return pSelf.Window.Contains(nNowT)
+	}
+
+	return pSelf.DataSrc.Sessions.InRealRebuildWindow(nNowT)
+}
+
+/**
+ * @brief		判断是否需要重新生成
+ * @param[in]	objNow			当前时间
+ * @param[in]	objLastBuild	上一次生成的时间(还没有生成过时为零值)
+ * @param[in]	bPublished		是否已经发布过(服务启动后还没有发布过时，不论是否在时间窗口内都生成一次)
+ */
+func (pSelf *LiveResourceConfig) isDue(objNow time.Time, objLastBuild time.Time, bPublished bool) bool {
+	if objNow.Sub(objLastBuild) < pSelf.Interval {
+		return false
+	}
+
+	return false == bPublished || true == pSelf.InWindow(objNow)
+}
@@ -0,0 +1,176 @@
+/**
+ * @brief		实时资源的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		<live>节点定义的实时资源: 别名 + 任意数据类型 + 刷新间隔 + 生成时间窗口; 旧的 real_m1 配置等同于 MIN1_TODAY
+ */
+func TestLiveResourceConfiguration(t *testing.T) {
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objScheduler := FileScheduler{XmlCfgPath: filepath.Join(sTempDir, "configuration.xml")}
+	fnLoad := func(sMarket string) bool {
+		ioutil.WriteFile(objScheduler.XmlCfgPath, []byte(`<?xml version="1.0" encoding="UTF-8"?><cfg version="1.0.1">
+			<setting name="SyncFolder" value="./SyncFolder/"/>
+			<market id="SSE">`+sMarket+`</market>
+		</cfg>`), 0644)
+
+		return objScheduler.loadConfiguration(true)
+	}
+
+	if false == fnLoad(`<live name="MIN5_TODAY" datatype="m5" folder=".\MIN\" interval="60" window="0900~1130,1300~1530"/><datatype name="real_m1" folder="./MIN/"/>`) {
+		t.Fatal("cannot load configuration")
+	}
+
+	if 2 != len(objScheduler.LiveResources) || 0 != len(objScheduler.DataSrcCfg) {
+		t.Fatalf("unexpected live resources : %+v", objScheduler.LiveResources)
+	}
+
+	objMin1, objMin5 := objScheduler.LiveResources[0], objScheduler.LiveResources[1] // <datatype>节点先于<live>节点登记
+	if "SSE/MIN5_TODAY/MIN5_TODAY" != objMin5.AliasURI() || "sse.m5" != objMin5.ResType || "./MIN/" != objMin5.DataSrc.Folder || time.Minute != objMin5.Interval || 2 != len(objMin5.Window) {
+		t.Errorf("unexpected live resource : %+v", objMin5)
+	}
+
+	if "SSE/MIN1_TODAY/MIN1_TODAY" != objMin1.AliasURI() || "sse.real_m1" != objMin1.ResType || time.Duration(nDefaultLiveInterval)*time.Second != objMin1.Interval {
+		t.Errorf("unexpected live resource : %+v", objMin1)
+	}
+
+	// 生成时间窗口: 配置的窗口 / 缺省为 开盘 ~ 收盘后n分钟(含午间休市); 周末不生成
+	objNoon, objSaturday := time.Date(2018, 4, 10, 12, 0, 0, 0, time.Local), time.Date(2018, 4, 14, 10, 0, 0, 0, time.Local)
+	if true == objMin5.InWindow(objNoon) || false == objMin1.InWindow(objNoon) || true == objMin1.InWindow(objSaturday) {
+		t.Error("unexpected window of live resources")
+	}
+
+	// 刷新间隔未到时不生成; 尚未发布过时，不在时间窗口内也生成
+	if true == objMin1.isDue(objNoon, objNoon.Add(-time.Minute), true) || false == objMin1.isDue(objNoon, objNoon.Add(-time.Hour), true) || false == objMin5.isDue(objSaturday, time.Time{}, false) || true == objMin5.isDue(objSaturday, time.Time{}, true) {
+		t.Error("unexpected schedule of live resources")
+	}
+
+	for _, sInvalid := range []string{
+		`<live name="MIN5_TODAY" datatype="m7" folder="./MIN/"/>`,
+		`<live name="../MIN5" datatype="m5" folder="./MIN/"/>`,
+		`<live name="MIN5_TODAY" datatype="m5" folder="./MIN/" interval="0"/>`,
+		`<live name="MIN5_TODAY" datatype="m5" folder="./MIN/" window="0900-1130"/>`,
+		`<live name="MIN1_TODAY" datatype="m1" folder="./MIN/"/><datatype name="real_m1" folder="./MIN/"/>`,
+	} {
+		if true == fnLoad(sInvalid) {
+			t.Errorf("invalid live resource should not be accepted : %s", sInvalid)
+		}
+	}
+}
+
+/**
+ * @brief		实时资源只压缩今天的数据(含盘中未完成的k线)，通过固定的别名URI下载当前的一代文件
+ */
+func TestRebuildLiveResource(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objNow := time.Now()
+	nToday, nYesterday := dateOf(objNow), dateOf(objNow.AddDate(0, 0, -1))
+	os.MkdirAll("./MIN/", 0755)
+	ioutil.WriteFile(fmt.Sprintf("./MIN/MIN600000_%d.csv", objNow.Year()), []byte(fmt.Sprintf("%d,93100,10,11,9,10.5,0,100,10,0,1,0\n%d,93100,10,11,9,10.5,0,100,10,0,1,0\n%d,93200,10.5,12,10,11,0,100,10,0,1,0\n", nYesterday, nToday, nToday)), 0644)
+
+	sAliasURI := "SSE/MIN5_TODAY/MIN5_TODAY"
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	objScheduler := &FileScheduler{SyncFolder: "./SyncFolder/", RefSyncSvr: objSvr, LiveResources: []LiveResourceConfig{
+		{Name: "MIN5_TODAY", ResType: "sse.m5", Interval: time.Minute, DataSrc: DataSourceConfig{MkID: "sse", Folder: "./MIN/", Sessions: DefaultSessions}},
+	}}
+
+	objScheduler.rebuildLiveResources(objNow)
+	objRes, ok := objSvr.GetLiveFile(sAliasURI)
+	if sFile := fmt.Sprintf("SyncFolder/%s.%d.%d", sAliasURI, nToday, objNow.Hour()*100+objNow.Minute()); false == ok || sFile != objRes.URI || "sse.m5" != objRes.TYPE {
+		t.Fatalf("unexpected live file : %+v", objRes)
+	}
+
+	if lstFiles, _ := filepath.Glob("SyncFolder/SSE/MIN5_TODAY/*"); 1 != len(lstFiles) {
+		t.Fatalf("only data of today should be compressed : %v", lstFiles)
+	}
+
+	// 刷新间隔未到，不重新生成
+	objScheduler.rebuildLiveResources(objNow.Add(time.Second * 30))
+	if objNow != objScheduler.mapLiveBuilt[sAliasURI] {
+		t.Error("live resource should not be rebuilt before interval elapses")
+	}
+
+	// /live 列出当前一代文件的URI + 校验码
+	var objLiveList ResourceList
+	objResp := doTestRequest(objSvr, objSvr.handleLive, "/live")
+	if err := xml.Unmarshal(objResp.Body.Bytes(), &objLiveList); nil != err || 1 != len(objLiveList.Download) || objRes.URI != objLiveList.Download[0].URI {
+		t.Fatalf("unexpected live list : %s", objResp.Body.String())
+	} else if objLive := objLiveList.Download[0]; "" == objLive.MD5 || objRes.MD5 != objLive.MD5 || objRes.SHA256 != objLive.SHA256 || objRes.SIZE != objLive.SIZE {
+		t.Fatalf("live list should carry digests of the current generation : %+v, %+v", objLive, objRes)
+	}
+
+	// 又生成了新的一代: 按 /live 中的URI下载到的仍是列表中的那一代文件，与列表中的校验码一致
+	ioutil.WriteFile(objRes.URI+"9", []byte("live data of new generation"), 0644)
+	objSvr.SetLiveFile(sAliasURI, ResDownload{TYPE: "sse.m5", URI: objRes.URI + "9"})
+
+	// 今天的k线(含未完成的一根)，不含昨天的
+	objResp = doTestRequest(objSvr, objSvr.handleDownload, "/get?uri="+objLiveList.Download[0].URI)
+	if http.StatusOK != objResp.Code {
+		t.Fatalf("unexpected status of download : %d", objResp.Code)
+	}
+
+	if sSHA256 := fmt.Sprintf("%x", sha256.Sum256(objResp.Body.Bytes())); objLiveList.Download[0].SHA256 != sSHA256 {
+		t.Errorf("downloaded live file does not match the live list : %s", sSHA256)
+	}
+
+	objZlibReader, err := zlib.NewReader(bytes.NewReader(objResp.Body.Bytes()))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	objTarReader := tar.NewReader(objZlibReader)
+	if _, err = objTarReader.Next(); nil != err {
+		t.Fatal(err)
+	}
+
+	bytesData, _ := ioutil.ReadAll(objTarReader)
+	if false == strings.Contains(string(bytesData), fmt.Sprintf("%d,93500", nToday)) || true == strings.Contains(string(bytesData), fmt.Sprint(nYesterday)) {
+		t.Errorf("unexpected bars of live resource : %s", string(bytesData))
+	}
+}
+
+/**
+ * @brief		别名URI重定向到当前一代文件(多个别名匹配时取最长的一个); 某一代文件的URI不重定向，只取其资源类型
+ */
+func TestRedirectLiveURI(t *testing.T) {
+	objSvr := &FileSyncServer{Account: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetLiveFile("SSE/MIN5_TODAY/MIN5_TODAY", ResDownload{TYPE: "sse.m5", URI: "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.930"})
+	objSvr.SetLiveFile("MIN5_TODAY/MIN5_TODAY", ResDownload{TYPE: "cff.m5", URI: "SyncFolder/MIN5_TODAY/MIN5_TODAY.20180410.930"})
+
+	for i := 0; i < 20; i++ { // map的遍历顺序是随机的，多次重定向的结果应当一致
+		for _, lstCase := range [][3]string{
+			{"SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY", "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.930", "sse.m5"},
+			{"SSE/MIN5_TODAY/MIN5_TODAY", "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.930", "sse.m5"},
+			{"SyncFolder/MIN5_TODAY/MIN5_TODAY", "SyncFolder/MIN5_TODAY/MIN5_TODAY.20180410.930", "cff.m5"},
+			{"SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.925", "SyncFolder/SSE/MIN5_TODAY/MIN5_TODAY.20180410.925", "sse.m5"},
+			{"SyncFolder/SSE/DAY/DAY.1", "SyncFolder/SSE/DAY/DAY.1", ""},
+		} {
+			if sFile, sResType := objSvr.redirectURI(objSvr.loadSnapshot(), lstCase[0]); lstCase[1] != sFile || lstCase[2] != sResType {
+				t.Fatalf("%s : unexpected redirection %s, %s", lstCase[0], sFile, sResType)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/**
+ * @brief		资源清单签名
+ * @detail		用Ed25519私钥对 /list 和 /live 的应答体签名，签名放在应答头 X-Manifest-Signature 中(base64)，
+ 				客户端用配置的公钥验证清单确实来自本服务器(防止代理/镜像篡改资源和MD5)
+ * @note		签名覆盖 前缀 + 接口(/list 或 /live) + 清单版本号 + 完整的应答体字节(含xml头)，见 manifestMessage();
+ 				增量清单/按帐号过滤的清单/json格式的清单，都是对实际下发的字节签名;
+ 				接口和版本号都在签名内容中，镜像不能用其它接口的应答冒充资源列表(客户端还会拒绝版本回退的清单)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+const (
+	ManifestSignatureHeader string = "X-Manifest-Signature" // 清单签名的应答头
+	ManifestSignContext     string = "filesync-manifest-v1" // 签名内容的前缀(与其它用途的签名区分)
+)
+
+/**
+ * @brief		加载清单签名私钥
+ * @detail		密钥文件不存在时，随机生成一个密钥并保存到该文件，同时把公钥保存到 <密钥文件>.pub (配置到客户端)
+ * @param[in]	sKeyFile		密钥文件路径(内容为32字节种子的hex串)
+ * @return		私钥 (加载失败时返回nil)
+ */
+func LoadManifestSigningKey(sKeyFile string) ed25519.PrivateKey {
+	if bytesContent, err := ioutil.ReadFile(sKeyFile); nil == err {
+		bytesSeed, err := hex.DecodeString(strings.TrimSpace(string(bytesContent)))
+		if nil != err || ed25519.SeedSize != len(bytesSeed) {
+			log.Printf("[ERR] LoadManifestSigningKey() : invalid manifest signing key file (hex string of %d bytes seed) : %s", ed25519.SeedSize, sKeyFile)
+			return nil
+		}
+
+		objPrivateKey := ed25519.NewKeyFromSeed(bytesSeed)
+		log.Println("[INF] LoadManifestSigningKey() : manifest public key =", hex.EncodeToString(objPrivateKey.Public().(ed25519.PublicKey)))
+
+		return objPrivateKey
+	}
+
+	objPublicKey, objPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		log.Println("[ERR] LoadManifestSigningKey() : cannot generate manifest signing key :", err.Error())
+		return nil
+	}
+
+	if err := ioutil.WriteFile(sKeyFile, []byte(hex.EncodeToString(objPrivateKey.Seed())), 0600); nil != err {
+		log.Println("[ERR] LoadManifestSigningKey() : cannot save manifest signing key :", sKeyFile, err.Error())
+		return nil
+	}
+
+	if err := ioutil.WriteFile(sKeyFile+".pub", []byte(hex.EncodeToString(objPublicKey)), 0644); nil != err {
+		log.Println("[WARN] LoadManifestSigningKey() : cannot save manifest public key :", sKeyFile+".pub", err.Error())
+	}
+
+	log.Println("[INF] LoadManifestSigningKey() : a new manifest signing key has been generated :", sKeyFile, ", public key =", hex.EncodeToString(objPublicKey))
+
+	return objPrivateKey
+}
+
+/**
+ * @brief		清单签名的内容: 前缀 + 接口 + 清单版本号 + 应答体(客户端按同样的格式验证)
+ * @param[in]	sEndpoint		接口路径(/list 或 /live)
+ * @param[in]	nVersion		应答体中清单的版本号(/live 为0)
+ * @param[in]	bytesBody		完整的应答体
+ */
+func manifestMessage(sEndpoint string, nVersion uint64, bytesBody []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s\n%s\n%d\n", ManifestSignContext, sEndpoint, nVersion)), bytesBody...)
+}
+
+/**
+ * @brief		对清单应答体签名
+ * @param[in]	objPrivateKey	签名私钥(为nil时，不签名)
+ * @param[in]	sEndpoint		接口路径(/list 或 /live)
+ * @param[in]	nVersion		应答体中清单的版本号
+ * @param[in]	bytesBody		完整的应答体
+ * @return		base64签名串 (不签名时返回空串)
+ */
+func signManifest(objPrivateKey ed25519.PrivateKey, sEndpoint string, nVersion uint64, bytesBody []byte) string {
+	if nil == objPrivateKey {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(objPrivateKey, manifestMessage(sEndpoint, nVersion, bytesBody)))
+}
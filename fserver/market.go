@@ -0,0 +1,206 @@
+/**
+ * @brief		市场定义
+ * @detail		市场由配置文件定义(<market>节点): 市场编号 + 代码过滤器 + 交易时段 + 休市日历 + 支持的数据类型(及数据源目录) + 实时资源(见 liveresource.go)，如:
+ 				<market id="SHFE" holidays="holidays/shfe.txt">
+ 					<codefilter type="regex" value="^[a-z]{1,2}\d{3,4}$"/>
+ 					<session value="2100~0100"/>
+ 					<session value="0900~1130"/>
+ 					<datatype name="d1" folder="D:\HQHISDATA\SHFE\DAY\"/>
+ 				</market>
+ * @note		沪深两市为内置市场，兼容旧的 <setting name="SSE.coderange"/> / <setting name="SSE.d1"/> 配置方式
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	BuiltinMarkets []string = []string{"sse", "szse"} // 内置市场(不用<market>节点定义也可以使用)
+)
+
+/**
+ * @Class 		MarketCodeFilter
+ * @brief		某市场的代码过滤器: 数字代码段 + 正则表达式 (期货、北交所等市场的代码含字母，不能按数字代码段过滤)
+ * @note 		满足任一条件的代码即参与资源压缩
+ * @author		barry
+ */
+type MarketCodeFilter struct {
+	Ranges   CodeRangeClass   // 有效的数字代码段
+	Patterns []*regexp.Regexp // 有效代码的正则表达式
+}
+
+/**
+ * @brief		添加一个过滤条件
+ * @param[in]	sType			过滤类型 (range: 数字代码段，如 600000~609999 / regex: 正则表达式)
+ * @param[in]	sValue			过滤条件
+ */
+func (pSelf *MarketCodeFilter) Add(sType string, sValue string) error {
+	switch strings.ToLower(sType) {
+	case "", "range":
+		var objRange CodeRangeStruct
+		lstRangeStr := strings.Split(sValue, "~")
+		if len(lstRangeStr) != 2 || false == objRange.Fill(strings.TrimSpace(lstRangeStr[0]), strings.TrimSpace(lstRangeStr[1])) {
+			return fmt.Errorf("invalid code range : %s", sValue)
+		}
+
+		pSelf.Ranges = append(pSelf.Ranges, objRange)
+	case "regex":
+		objPattern, err := regexp.Compile(sValue)
+		if nil != err {
+			return fmt.Errorf("invalid code pattern : %s, %s", sValue, err.Error())
+		}
+
+		pSelf.Patterns = append(pSelf.Patterns, objPattern)
+	default:
+		return fmt.Errorf("unknown code filter type : %s", sType)
+	}
+
+	return nil
+}
+
+/**
+ * @brief		是否没有设置任何过滤条件(不过滤)
+ */
+func (pSelf *MarketCodeFilter) IsEmpty() bool {
+	return 0 == len(pSelf.Ranges) && 0 == len(pSelf.Patterns)
+}
+
+/**
+ * @brief		判断某代码是否满足过滤条件
+ * @note 		非数字代码只用正则表达式判断(不按数字代码段判断)
+ */
+func (pSelf *MarketCodeFilter) CodeInRange(sCodeNum string) bool {
+	for _, objPattern := range pSelf.Patterns {
+		if true == objPattern.MatchString(sCodeNum) {
+			return true
+		}
+	}
+
+	if _, err := strconv.Atoi(sCodeNum); nil != err {
+		return false
+	}
+
+	return pSelf.Ranges.CodeInRange(sCodeNum)
+}
+
+/**
+ * @Class 		MarketConfig
+ * @brief		从配置文件加载的某市场的定义
+ * @author		barry
+ */
+type MarketConfig struct {
+	MkID       string           // 市场编号(小写，如: sse / shfe)
+	CodeFilter MarketCodeFilter // 参与资源压缩的代码过滤器
+	Sessions   TradingSessions  // 交易时段(按交易日内的先后顺序)
+	Holidays   *HolidayCalendar // 休市日历(为nil时只按周末判断交易日)
+	DataTypes  []string         // 支持的数据类型(如: d1 / m60)
+}
+
+/**
+ * @brief		判断某时间是否在本市场的交易时段内
+ * @param[in]	nTime			时间(HHMMSS)
+ */
+func (pSelf *MarketConfig) InSession(nTime int) bool {
+	return pSelf.Sessions.Contains(nTime)
+}
+
+/**
+ * @brief		xml配置文件中的<market>节点
+ */
+type xmlMarketConfig struct {
+	ID         string `xml:"id,attr"`
+	Holidays   string `xml:"holidays,attr"`
+	CodeFilter []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"codefilter"`
+	Session []struct {
+		Value string `xml:"value,attr"`
+	} `xml:"session"`
+	DataType []struct {
+		Name   string `xml:"name,attr"`
+		Folder string `xml:"folder,attr"`
+	} `xml:"datatype"`
+	Live []xmlLiveConfig `xml:"live"`
+}
+
+/**
+ * @brief		把<market>节点的 代码过滤器 + 交易时段 + 休市日历 加载到市场定义中(数据类型由调用者逐个登记)
+ * @param[in]	sCfgFolder		配置文件所在目录(休市日历文件的相对路径，相对于该目录)
+ * @note		节点中配置了交易时段时，替换掉原有的(内置市场的默认)交易时段
+ */
+func (pSelf *MarketConfig) load(refXmlMarket *xmlMarketConfig, sCfgFolder string) bool {
+	for _, objFilter := range refXmlMarket.CodeFilter {
+		if err := pSelf.CodeFilter.Add(objFilter.Type, objFilter.Value); nil != err {
+			log.Printf("[WARN] MarketConfig.load() : [Xml.Market] %s : %s", pSelf.MkID, err.Error())
+			return false
+		}
+	}
+
+	var lstSessions TradingSessions
+	for _, objXmlSession := range refXmlMarket.Session {
+		var objSession TradingSession
+		if err := objSession.Parse(objXmlSession.Value); nil != err {
+			log.Printf("[WARN] MarketConfig.load() : [Xml.Market] %s : %s", pSelf.MkID, err.Error())
+			return false
+		}
+
+		lstSessions = append(lstSessions, objSession)
+	}
+
+	if len(lstSessions) > 0 {
+		pSelf.Sessions = lstSessions
+	}
+
+	if sHolidayFile := strings.Replace(strings.TrimSpace(refXmlMarket.Holidays), "\\", "/", -1); "" != sHolidayFile {
+		if false == filepath.IsAbs(sHolidayFile) {
+			sHolidayFile = filepath.Join(sCfgFolder, sHolidayFile)
+		}
+
+		objHolidays, err := LoadHolidayCalendar(sHolidayFile)
+		if nil != err {
+			log.Printf("[WARN] MarketConfig.load() : [Xml.Market] %s : cannot load holidays : %s", pSelf.MkID, err.Error())
+			return false
+		}
+
+		pSelf.Holidays = objHolidays
+	}
+
+	log.Printf("[INF] MarketConfig.load() : [Xml.Market] %s : %d code ranges, %d code patterns, sessions = %v, holidays = %d", pSelf.MkID, len(pSelf.CodeFilter.Ranges), len(pSelf.CodeFilter.Patterns), pSelf.Sessions, pSelf.Holidays.Count())
+
+	return true
+}
+
+/**
+ * @brief		从数据文件名中取出商品代码
+ * @param[in]	sFileName		数据文件路径 (如: .../MIN/MIN600000_2018.csv / .../DAY/DAYrb1810.csv)
+ * @param[in]	sPrefix			文件名前缀 (如: MIN / DAY)
+ * @param[in]	nSuffixLen		代码后面、扩展名前面的附加部分长度 (如: "_2018" 为5)
+ * @return		商品代码 (文件名不符合格式时返回空串)
+ * @note		代码可以含字母(期货合约等)，不能再用 strings.LastIndexAny(sFileName, "MIN") 定位代码
+ */
+func codeOfFileName(sFileName string, sPrefix string, nSuffixLen int) string {
+	sBaseName := sFileName[strings.LastIndexAny(sFileName, "/\\")+1:]
+	if false == strings.HasPrefix(sBaseName, sPrefix) {
+		return ""
+	}
+
+	sBaseName = sBaseName[len(sPrefix):]
+	if nEnd := strings.LastIndex(sBaseName, "."); nEnd >= 0 {
+		sBaseName = sBaseName[:nEnd]
+	}
+
+	if len(sBaseName) <= nSuffixLen {
+		return ""
+	}
+
+	return sBaseName[:len(sBaseName)-nSuffixLen]
+}
@@ -0,0 +1,104 @@
+/**
+ * @brief		市场定义的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		<market>节点定义的市场: 字母数字代码过滤 + 跨午夜的交易时段 + 支持的数据类型
+ */
+func TestMarketDefinedInConfiguration(t *testing.T) {
+	sSampleCfg, _ := filepath.Abs("../cfg/configuration.xml")
+	sTempDir, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	objScheduler := FileScheduler{XmlCfgPath: sSampleCfg}
+	if false == objScheduler.loadConfiguration(true) {
+		t.Fatal("cannot load the sample configuration")
+	}
+
+	if objHolidays := objScheduler.GetMarketHolidays("sse"); 0 == objHolidays.Count() || true == objHolidays.IsTradingDay(time.Date(2018, 12, 31, 10, 0, 0, 0, time.Local)) {
+		t.Error("holidays of the sample configuration are not loaded")
+	}
+
+	objScheduler.XmlCfgPath = filepath.Join(sTempDir, "configuration.xml")
+	ioutil.WriteFile(objScheduler.XmlCfgPath, []byte(`<?xml version="1.0" encoding="UTF-8"?><cfg version="1.0.1">
+		<setting name="SyncFolder" value="./SyncFolder/"/>
+		<market id="SHFE">
+			<codefilter type="regex" value="^[a-z]{1,2}[0-9]{4}$"/>
+			<session value="2100~0230"/>
+			<session value="0900~1015"/>
+			<datatype name="d1" folder="./SHFE/DAY/"/>
+		</market>
+		<setting name="SSE.coderange" value="600000~609999"/>
+		<setting name="SSE.d1" value="./SSE/DAY/"/>
+	</cfg>`), 0644)
+	if false == objScheduler.loadConfiguration(false) {
+		t.Fatal("cannot load configuration")
+	}
+
+	if _, ok := objScheduler.DataSrcCfg["shfe.d1"]; false == ok || 2 != len(objScheduler.DataSrcCfg) {
+		t.Fatalf("unexpected data sources : %+v", objScheduler.DataSrcCfg)
+	}
+
+	objFutures, objStock := objScheduler.GetCodeRangeFilter("shfe.d1"), objScheduler.GetCodeRangeFilter("sse.d1")
+	if nil == objFutures || false == objFutures.CodeInRange("rb1810") || true == objFutures.CodeInRange("600000") {
+		t.Error("unexpected code filter of shfe")
+	}
+
+	if nil == objStock || false == objStock.CodeInRange("600000") || true == objStock.CodeInRange("rb1810") {
+		t.Error("unexpected code filter of sse")
+	}
+
+	if nil != objScheduler.GetCodeRangeFilter("szse.d1") {
+		t.Error("market without code filter should not filter codes")
+	}
+
+	objMarket := objScheduler.mapMarkets["shfe"]
+	if false == objMarket.InSession(220000) || false == objMarket.InSession(13000) || true == objMarket.InSession(120000) {
+		t.Errorf("unexpected trading sessions : %+v", objMarket.Sessions)
+	}
+
+	ioutil.WriteFile(objScheduler.XmlCfgPath, []byte(`<?xml version="1.0" encoding="UTF-8"?><cfg version="1.0.1">
+		<market id="SHFE"><datatype name="participant" folder="./SHFE/"/></market>
+	</cfg>`), 0644)
+	if true == objScheduler.loadConfiguration(false) {
+		t.Fatal("data type of another market should not be accepted")
+	}
+
+	ioutil.WriteFile(objScheduler.XmlCfgPath, []byte(`<?xml version="1.0" encoding="UTF-8"?><cfg version="1.0.1">
+		<market id="BSE"><datatype name="m60" folder="./BSE/MIN/"/></market>
+	</cfg>`), 0644)
+	if true == objScheduler.loadConfiguration(false) {
+		t.Fatal("minute lines of market without trading sessions should not be accepted")
+	}
+}
+
+/**
+ * @brief		从数据文件名中取出(可能含字母的)商品代码
+ */
+func TestCodeOfFileName(t *testing.T) {
+	for _, objCase := range []struct {
+		sFileName  string
+		sPrefix    string
+		nSuffixLen int
+		sCode      string
+	}{
+		{"D:/HQHISDATA/SSE/MIN/MIN600000_2018.csv", "MIN", 5, "600000"},
+		{"D:/HQHISDATA/CZCE/MIN/MINMA809_2018.csv", "MIN", 5, "MA809"},
+		{"D:/HQHISDATA/CZCE/DAY/DAYTA809.csv", "DAY", 0, "TA809"},
+		{"D:/HQHISDATA/SHFE/DAY/rb1810.csv", "DAY", 0, ""},
+	} {
+		if sCode := codeOfFileName(objCase.sFileName, objCase.sPrefix, objCase.nSuffixLen); sCode != objCase.sCode {
+			t.Errorf("codeOfFileName(%s) = %s, expect %s", objCase.sFileName, sCode, objCase.sCode)
+		}
+	}
+}
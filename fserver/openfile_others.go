@@ -0,0 +1,20 @@
+// +build !windows
+
+/**
+ * @brief		打开待下发的文件(非Windows平台)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"os"
+)
+
+/**
+ * @brief		以只读方式打开待下发的文件
+ * @note		非Windows平台上，打开中的文件可以被改名/删除，直接用 os.Open()
+ */
+func openSharedFile(sFile string) (*os.File, error) {
+	return os.Open(sFile)
+}
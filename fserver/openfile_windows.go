@@ -0,0 +1,30 @@
+/**
+ * @brief		打开待下发的文件(Windows平台)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"os"
+	"syscall"
+)
+
+/**
+ * @brief		以只读方式打开待下发的文件，允许其它句柄 读/写/改名/删除 该文件
+ * @detail		os.Open() 打开的文件没有 FILE_SHARE_DELETE 共享权限，下载进行中时，发布新一代资源文件(见 swapStagedFiles())
+ 				无法把被替换的文件改名到退役目录，整个发布都会回滚; 带上 FILE_SHARE_DELETE 后，改名不影响进行中的下载
+ */
+func openSharedFile(sFile string) (*os.File, error) {
+	pPath, err := syscall.UTF16PtrFromString(sFile)
+	if nil != err {
+		return nil, &os.PathError{Op: "open", Path: sFile, Err: err}
+	}
+
+	hFile, err := syscall.CreateFile(pPath, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if nil != err {
+		return nil, &os.PathError{Op: "open", Path: sFile, Err: err}
+	}
+
+	return os.NewFile(uintptr(hFile), sFile), nil
+}
@@ -0,0 +1,125 @@
+/**
+ * @brief		实时资源文件的分代保留
+ * @detail		实时资源(如沪深今日内的1分钟线 MIN1_TODAY.<date>.<hhmm>)盘中每n分钟生成一代新文件;
+ 				保留最近n代，更早的一代只有在 没有进行中的下载(引用计数为0) 且 生成后超过保留时间 时才删除
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	nDefaultRealFileKeep int           = 3           // 实时资源文件缺省保留的代数(含当前一代)
+	nDefaultRealFileTTL  time.Duration = time.Minute // 实时资源文件缺省的最短保留时间(生成后)
+)
+
+/**
+ * @Class 		FileRefCounter
+ * @brief		文件的引用计数(进行中的下载请求数)
+ * @author		barry
+ */
+type FileRefCounter struct {
+	objLock sync.Mutex     // 引用计数锁
+	mapRefs map[string]int // 文件路径 -> 进行中的下载请求数
+}
+
+/**
+ * @brief		增加一个引用(开始下载)
+ */
+func (pSelf *FileRefCounter) Acquire(sPath string) {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	if nil == pSelf.mapRefs {
+		pSelf.mapRefs = make(map[string]int)
+	}
+
+	pSelf.mapRefs[sPath]++
+}
+
+/**
+ * @brief		减少一个引用(下载结束)
+ * @return		剩余的引用数
+ */
+func (pSelf *FileRefCounter) Release(sPath string) int {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	nRefs := pSelf.mapRefs[sPath] - 1
+	if nRefs <= 0 {
+		delete(pSelf.mapRefs, sPath)
+		return 0
+	}
+
+	pSelf.mapRefs[sPath] = nRefs
+	return nRefs
+}
+
+/**
+ * @brief		文件的引用数
+ */
+func (pSelf *FileRefCounter) Count(sPath string) int {
+	pSelf.objLock.Lock()
+	defer pSelf.objLock.Unlock()
+
+	return pSelf.mapRefs[sPath]
+}
+
+/**
+ * @Class 		RealFileGeneration
+ * @brief		一代实时资源文件
+ * @author		barry
+ */
+type RealFileGeneration struct {
+	Path        string    // 文件路径
+	PublishTime time.Time // 发布时间
+}
+
+/**
+ * @Class 		RealFileHistory
+ * @brief		某实时资源已经发布的各代文件(旧->新，最后一代为当前文件)
+ * @author		barry
+ */
+type RealFileHistory struct {
+	lstGenerations []RealFileGeneration // 尚未删除的各代文件
+}
+
+/**
+ * @brief		发布新的一代(与当前一代相同时忽略)
+ */
+func (pSelf *RealFileHistory) push(sPath string, objNow time.Time) {
+	if nLen := len(pSelf.lstGenerations); nLen > 0 && sPath == pSelf.lstGenerations[nLen-1].Path {
+		return
+	}
+
+	pSelf.lstGenerations = append(pSelf.lstGenerations, RealFileGeneration{Path: sPath, PublishTime: objNow})
+}
+
+/**
+ * @brief		取出可以删除的各代文件(从保留列表中去掉)
+ * @param[in]	nKeep			保留最近的代数(含当前一代)
+ * @param[in]	nTTL			最短保留时间(生成后)
+ * @param[in]	objNow			当前时间
+ * @param[in]	refFileRefs		文件的引用计数(有进行中的下载时不删除)
+ * @return		可以删除的文件路径
+ */
+func (pSelf *RealFileHistory) expire(nKeep int, nTTL time.Duration, objNow time.Time, refFileRefs *FileRefCounter) []string {
+	var lstExpired []string
+	var lstKept []RealFileGeneration
+
+	for i, objGeneration := range pSelf.lstGenerations {
+		if i < len(pSelf.lstGenerations)-nKeep && objNow.Sub(objGeneration.PublishTime) >= nTTL && 0 == refFileRefs.Count(objGeneration.Path) {
+			lstExpired = append(lstExpired, objGeneration.Path)
+		} else {
+			lstKept = append(lstKept, objGeneration)
+		}
+	}
+
+	pSelf.lstGenerations = lstKept
+
+	return lstExpired
+}
@@ -0,0 +1,74 @@
+/**
+ * @brief		实时资源文件分代保留的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		判断文件是否存在
+ */
+func fileExists(sFile string) bool {
+	_, err := os.Stat(sFile)
+
+	return nil == err
+}
+
+/**
+ * @brief		保留最近n代; 更早的一代没有进行中的下载且超过保留时间后才删除
+ */
+func TestRealFileRetention(t *testing.T) {
+	_, fnRestore := enterTempWorkDir(t)
+	defer fnRestore()
+
+	var lstFiles []string
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", SyncFolder: "./SyncFolder/", TokenSecret: []byte("0123456789abcdef")}
+	objSvr.SetRealFileRetention(2, time.Hour)
+	os.MkdirAll("./SyncFolder/SSE/MIN1_TODAY/", 0755)
+	for i := 0; i < 5; i++ {
+		lstFiles = append(lstFiles, fmt.Sprintf("SyncFolder/SSE/MIN1_TODAY/MIN1_TODAY.20180410.%d", 930+i))
+		ioutil.WriteFile(lstFiles[i], []byte(lstFiles[i]), 0644)
+	}
+
+	// 未超过保留时间: 全部保留
+	for i := 0; i < 3; i++ {
+		objSvr.SetLiveFile("SSE/MIN1_TODAY/MIN1_TODAY", ResDownload{TYPE: "sse.real_m1", URI: lstFiles[i]})
+	}
+
+	for i := 0; i < 3; i++ {
+		if false == fileExists(lstFiles[i]) {
+			t.Fatalf("%s should be kept before ttl expires", lstFiles[i])
+		}
+	}
+
+	// 超过保留时间: 只保留最近2代，及正在下载中的一代
+	objSvr.SetRealFileRetention(2, time.Millisecond)
+	objSvr.objFileRefs.Acquire(lstFiles[1])
+	time.Sleep(time.Millisecond * 5)
+	objSvr.SetLiveFile("SSE/MIN1_TODAY/MIN1_TODAY", ResDownload{TYPE: "sse.real_m1", URI: lstFiles[3]})
+	objSvr.SetLiveFile("SSE/MIN1_TODAY/MIN1_TODAY", ResDownload{TYPE: "sse.real_m1", URI: lstFiles[4]})
+	if true == fileExists(lstFiles[0]) || true == fileExists(lstFiles[2]) || false == fileExists(lstFiles[1]) || false == fileExists(lstFiles[3]) || false == fileExists(lstFiles[4]) {
+		t.Fatal("unexpected files are removed or kept")
+	}
+
+	// 下载结束后删除
+	objSvr.releaseFile(lstFiles[1])
+	if true == fileExists(lstFiles[1]) {
+		t.Errorf("%s should be removed after download", lstFiles[1])
+	}
+
+	// 通过 /get 下载的文件，下载结束后引用计数归零
+	objResp := doTestRequest(objSvr, objSvr.handleDownload, "/get?uri=SSE/MIN1_TODAY/MIN1_TODAY")
+	if http.StatusOK != objResp.Code || lstFiles[4] != objResp.Body.String() || 0 != objSvr.objFileRefs.Count(lstFiles[4]) {
+		t.Errorf("unexpected download : status=%d, refs=%d", objResp.Code, objSvr.objFileRefs.Count(lstFiles[4]))
+	}
+}
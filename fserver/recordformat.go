@@ -0,0 +1,113 @@
+/**
+ * @brief		资源记录格式注册表
+ * @detail		各 I_Record_IO 实现在自己文件的 init() 中注册: 支持的市场 + 数据类型 + 目标子目录/文件名前缀 + 是否按代码段过滤;
+ 				不限定市场的记录格式(如: k线)，可用于配置文件中定义的任意市场;
+ 				XCompress() 和 配置文件加载 都通过注册表查找资源类型(如 sse.d1)，新增市场/数据类型不用再修改压缩主流程
+ * @note		配置文件中出现未注册的资源类型时，配置加载失败(启动时即报错，而不是在夜间生成资源时才失败)
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"log"
+	"strings"
+)
+
+/**
+ * @Class 		RecordFormat
+ * @brief		某种资源记录格式的注册信息
+ * @author		barry
+ */
+type RecordFormat struct {
+	MkIDs        []string                               // 支持的市场编号 (如: hkse; 为空时表示支持所有市场)
+	DataType     string                                 // 数据类型 (如: d1/m60/participant)
+	DestPrefix   string                                 // 目标文件的子目录 + 文件名前缀 (相对于 目标根目录/市场编号，如: MIN60/MIN60.)
+	UseCodeRange bool                                   // 是否按市场的有效代码段过滤
+	NeedSessions bool                                   // 是否需要市场的交易时段(如: 分钟k线按交易时段切分)
+	NewRecordIO  func(objBase BaseRecordIO) I_Record_IO // 构造 提取+压缩 策略对象
+}
+
+const (
+	AnyMarket string = "*" // 不限定市场的记录格式，在注册表中的市场编号
+)
+
+var (
+	mapRecordFormats map[string]RecordFormat = make(map[string]RecordFormat) // 资源类型(市场编号.数据类型) -> 记录格式
+)
+
+///< ---------------------------- [Public 方法] --------------------------------------------------
+/**
+ * @brief		注册资源记录格式
+ * @param[in]	objFormat		记录格式 (每个支持的市场，各注册一个资源类型)
+ * @return		true			成功
+ 				false			注册信息不完整，或资源类型已经被注册过
+ */
+func RegisterRecordFormat(objFormat RecordFormat) bool {
+	if "" == objFormat.DataType || nil == objFormat.NewRecordIO {
+		log.Printf("[ERR] RegisterRecordFormat() : incomplete record format : %+v", objFormat)
+		return false
+	}
+
+	objFormat.DataType = strings.ToLower(objFormat.DataType)
+	lstMkIDs := objFormat.MkIDs
+	if 0 == len(lstMkIDs) {
+		lstMkIDs = []string{AnyMarket}
+	}
+
+	for _, sMkID := range lstMkIDs {
+		sResType := strings.ToLower(sMkID) + "." + objFormat.DataType
+		if _, ok := mapRecordFormats[sResType]; true == ok {
+			log.Println("[ERR] RegisterRecordFormat() : duplicate resource type :", sResType)
+			return false
+		}
+	}
+
+	for _, sMkID := range lstMkIDs {
+		mapRecordFormats[strings.ToLower(sMkID)+"."+objFormat.DataType] = objFormat
+	}
+
+	return true
+}
+
+/**
+ * @brief		根据资源类型查找记录格式
+ * @param[in]	sResType		资源类型 (市场编号.数据类型，不区分大小写，如: SSE.m60 / HKSE.Participant)
+ * @return		记录格式 + 是否已注册
+ * @note		先找限定了该市场的记录格式，再找不限定市场的记录格式(调用者需要确认市场已经定义)
+ */
+func LookupRecordFormat(sResType string) (RecordFormat, bool) {
+	sResType = strings.ToLower(sResType)
+	if objFormat, ok := mapRecordFormats[sResType]; true == ok {
+		return objFormat, true
+	}
+
+	nDotPos := strings.Index(sResType, ".")
+	if nDotPos < 0 {
+		return RecordFormat{}, false
+	}
+
+	objFormat, ok := mapRecordFormats[AnyMarket+sResType[nDotPos:]]
+
+	return objFormat, ok
+}
+
+/**
+ * @brief		构造某资源类型的 提取+压缩 策略对象
+ * @param[in]	sResType		资源类型
+ * @param[in]	codeRange 		对应市场的有效代码过滤器 (记录格式不按代码段过滤时忽略)
+ * @param[in]	refDataSrc		数据源配置 (对应市场的交易时段 + 休市日历; 实时资源的目标前缀 + 日期)
+ * @return		策略对象 + 目标文件的子目录和文件名前缀
+ */
+func (pSelf *RecordFormat) createRecordIO(sResType string, codeRange I_CodeRange_Filter, refDataSrc *DataSourceConfig) (I_Record_IO, string) {
+	objBase := BaseRecordIO{DataType: strings.ToLower(sResType), Sessions: refDataSrc.Sessions, Holidays: refDataSrc.Holidays, LiveDate: refDataSrc.LiveDate}
+	if true == pSelf.UseCodeRange {
+		objBase.CodeRangeFilter = codeRange
+	}
+
+	if "" != refDataSrc.DestPrefix { // 实时资源: 压缩到别名目录
+		return pSelf.NewRecordIO(objBase), refDataSrc.DestPrefix
+	}
+
+	return pSelf.NewRecordIO(objBase), pSelf.DestPrefix
+}
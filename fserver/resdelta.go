@@ -0,0 +1,213 @@
+/**
+ * @brief		资源清单的增量比较 + 已删除资源的墓碑项
+ * @detail		比较两个版本的资源清单，生成增量清单(新增/变化/删除的资源项)，供 /list?since=<版本号> 使用;
+ 				资源被删除(如半月资源包被合并进年资源包)时，在清单中保留一段时间的墓碑项(removed="true" + supersededby=<取代它的资源>)，
+ 				客户端据此删除本地缓存中已经作废的资源文件
+ * @note		墓碑项只在增量清单中下发(全量清单 和 ./restable.dat 中都不带墓碑项)，
+ 				旧版本客户端不认识removed属性，会把墓碑项当作普通资源去下载
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	nManifestHistorySize int = 32 // 保留的历史清单版本数(超出时，客户端取全量清单)
+)
+
+var (
+	nTombstoneLifetime time.Duration = time.Hour * 24 * 30 // 墓碑项在清单中的保留时间(超出后，从清单中去掉)
+)
+
+const (
+	RS_Added   string = "added"   // 新增的资源
+	RS_Changed string = "changed" // 变化的资源(md5/生成日期/类型不同)
+	RS_Removed string = "removed" // 已经删除的资源
+)
+
+/**
+ * @brief		比较两个版本的资源清单，生成增量清单
+ * @param[in]	refOldList		旧版本的资源清单(客户端已经应用的版本)
+ * @param[in]	refNewList		新版本的资源清单
+ * @return		增量清单: Since=旧版本号，Version=新版本号;
+ 				新增和变化的项按新清单中的顺序在前，删除的项按旧清单中的顺序在后(带上新清单墓碑项中的取代资源)
+ * @note		墓碑项本身不参与比较
+ */
+func diffResList(refOldList, refNewList *ResourceList) ResourceList {
+	var objDeltaList ResourceList = ResourceList{Version: refNewList.Version, Since: refOldList.Version}
+	var mapOldRes map[string]ResDownload = make(map[string]ResDownload, len(refOldList.Download))
+	var mapNewRes map[string]bool = make(map[string]bool, len(refNewList.Download))
+	var mapTombstone map[string]ResDownload = make(map[string]ResDownload)
+
+	for _, objRes := range refOldList.Download {
+		if false == objRes.Removed {
+			mapOldRes[objRes.URI] = objRes
+		}
+	}
+
+	for _, objRes := range refNewList.Download {
+		if true == objRes.Removed {
+			mapTombstone[objRes.URI] = objRes
+			continue
+		}
+
+		mapNewRes[objRes.URI] = true
+		objOldRes, ok := mapOldRes[objRes.URI]
+		if false == ok {
+			objRes.STATUS = RS_Added
+			objDeltaList.Download = append(objDeltaList.Download, objRes)
+		} else if objOldRes.MD5 != objRes.MD5 || objOldRes.UPDATE != objRes.UPDATE || objOldRes.TYPE != objRes.TYPE {
+			objRes.STATUS = RS_Changed
+			objDeltaList.Download = append(objDeltaList.Download, objRes)
+		}
+	}
+
+	for _, objRes := range refOldList.Download {
+		if false == objRes.Removed && false == mapNewRes[objRes.URI] {
+			objRes.STATUS = RS_Removed
+			objRes.Removed = true
+			objRes.SupersededBy = mapTombstone[objRes.URI].SupersededBy
+			objDeltaList.Download = append(objDeltaList.Download, objRes)
+		}
+	}
+
+	return objDeltaList
+}
+
+/**
+ * @brief		生成新清单的墓碑项
+ * @detail		旧清单中有、新清单中没有的资源 ---> 新的墓碑项(生成日期为删除时间);
+ 				旧清单中的墓碑项，未超出保留时间且未被重新发布的 ---> 保留
+ * @param[in]	refOldList		当前已经发布的资源清单
+ * @param[in]	lstNewDownload	新的资源清单(可能带有旧的墓碑项，会被重新生成)
+ * @param[in]	objNow			当前时间
+ * @return		新的资源清单: 墓碑项插在同类型的最后一项之后(客户端按类型连续分组下载)
+ */
+func mergeTombstones(refOldList *ResourceList, lstNewDownload []ResDownload, objNow time.Time) []ResDownload {
+	var lstMerged []ResDownload
+	var mapLiveRes map[string]bool = make(map[string]bool, len(lstNewDownload))
+	var mapTombstone map[string]bool = make(map[string]bool)
+
+	for _, objRes := range lstNewDownload {
+		if false == objRes.Removed {
+			mapLiveRes[objRes.URI] = true
+			lstMerged = append(lstMerged, objRes)
+		}
+	}
+
+	nLiveCount := len(lstMerged)
+	for _, objRes := range refOldList.Download {
+		if true == mapLiveRes[objRes.URI] || true == mapTombstone[objRes.URI] {
+			continue
+		}
+
+		if true == objRes.Removed { // 旧的墓碑项: 超出保留时间的丢弃
+			objRemoveTime, err := time.ParseInLocation("2006-01-02 15:04:05", objRes.UPDATE, time.Local)
+			if nil != err || objNow.Sub(objRemoveTime) > nTombstoneLifetime {
+				continue
+			}
+		} else { // 新删除的资源
+			objRes = ResDownload{TYPE: objRes.TYPE, URI: objRes.URI, MD5: objRes.MD5, UPDATE: objNow.Format("2006-01-02 15:04:05"), Removed: true}
+			objRes.SupersededBy = findSuperseder(&objRes, lstMerged[:nLiveCount])
+		}
+
+		mapTombstone[objRes.URI] = true
+		lstMerged = insertAfterSameType(lstMerged, objRes)
+	}
+
+	return lstMerged
+}
+
+/**
+ * @brief		去掉资源清单中的墓碑项(生成下发给客户端的全量清单)
+ * @return		不带墓碑项的资源清单 + 是否有墓碑项被去掉
+ */
+func stripTombstones(refResList *ResourceList) (ResourceList, bool) {
+	var objFullList ResourceList = ResourceList{Version: refResList.Version, Since: refResList.Since}
+	var bStripped bool = false
+
+	for _, objRes := range refResList.Download {
+		if true == objRes.Removed {
+			bStripped = true
+		} else {
+			objFullList.Download = append(objFullList.Download, objRes)
+		}
+	}
+
+	return objFullList, bStripped
+}
+
+/**
+ * @brief		把资源项插入到同类型的最后一项之后(没有同类型的项时，追加到末尾)
+ */
+func insertAfterSameType(lstDownload []ResDownload, objRes ResDownload) []ResDownload {
+	var nInsertPos int = len(lstDownload)
+	for i := len(lstDownload) - 1; i >= 0; i-- {
+		if lstDownload[i].TYPE == objRes.TYPE {
+			nInsertPos = i + 1
+			break
+		}
+	}
+
+	lstDownload = append(lstDownload, ResDownload{})
+	copy(lstDownload[nInsertPos+1:], lstDownload[nInsertPos:])
+	lstDownload[nInsertPos] = objRes
+
+	return lstDownload
+}
+
+/**
+ * @brief		拆分资源URI: 路径前缀 + 末尾的8位日期
+ * @detail		资源包的日期: yyyy0000 = 按年的资源包; yyyymm00 = 上半月(1~15日); yyyymm15 = 下半月(16日~月末); 其余 = 按天的资源包
+ */
+func splitResURI(sURI string) (string, int, bool) {
+	if len(sURI) < 8 {
+		return "", 0, false
+	}
+
+	nDate, err := strconv.Atoi(sURI[len(sURI)-8:])
+	if nil != err || nDate < 10000000 {
+		return "", 0, false
+	}
+
+	return sURI[:len(sURI)-8], nDate, true
+}
+
+/**
+ * @brief		在新清单中，查找取代某个被删除资源的资源包(同类型、同路径前缀，且日期范围包含被删除资源的)
+ * @return		取代资源的URI，找不到时返回空串
+ */
+func findSuperseder(refRemovedRes *ResDownload, lstLiveRes []ResDownload) string {
+	sPrefix, nOldDate, ok := splitResURI(refRemovedRes.URI)
+	if false == ok {
+		return ""
+	}
+
+	for _, objRes := range lstLiveRes {
+		sNewPrefix, nNewDate, ok := splitResURI(objRes.URI)
+		if false == ok || objRes.TYPE != refRemovedRes.TYPE || sNewPrefix != sPrefix || nNewDate == nOldDate {
+			continue
+		}
+
+		switch {
+		case 0 == nNewDate%10000: // 年资源包
+			if nNewDate/10000 == nOldDate/10000 {
+				return objRes.URI
+			}
+		case 0 == nNewDate%100: // 上半月资源包
+			if nNewDate/100 == nOldDate/100 && nOldDate%100 <= 15 {
+				return objRes.URI
+			}
+		case 15 == nNewDate%100: // 下半月资源包
+			if nNewDate/100 == nOldDate/100 && nOldDate%100 > 15 {
+				return objRes.URI
+			}
+		}
+	}
+
+	return ""
+}
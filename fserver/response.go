@@ -0,0 +1,115 @@
+/**
+ * @brief		网络服务的应答封装
+ * @detail		所有接口共用的应答结构(成功/失败)，并根据请求头 Accept 输出 xml(默认) 或 json
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+/**
+ * @Class 		ActionResult
+ * @brief		应答结果描述结构
+ * @detail		xml格式与旧版本保持兼容: <action><result status="failure" desc="..."/></action>
+ * @author		barry
+ */
+type ActionResult struct {
+	XMLName xml.Name `xml:"result" json:"-"`
+	Status  string   `xml:"status,attr" json:"status"`                     // success / failure
+	Code    int      `xml:"code,attr,omitempty" json:"code"`               // http状态码
+	Desc    string   `xml:"desc,attr" json:"desc"`                         // 描述信息
+	Token   string   `xml:"token,attr,omitempty" json:"token,omitempty"`   // 登录令牌(仅 POST /login 成功时)
+	Expire  int64    `xml:"expire,attr,omitempty" json:"expire,omitempty"` // 令牌过期时间(unix秒)
+}
+
+/**
+ * @Class 		ActionResponse
+ * @brief		应答信封(各接口共用)
+ * @detail		xml根节点名即为接口名(login/authenticate/download/list)
+ * @author		barry
+ */
+type ActionResponse struct {
+	XMLName xml.Name     `json:"-"`
+	Action  string       `xml:"-" json:"action"` // 接口名
+	Result  ActionResult `json:"result"`         // 应答结果
+}
+
+/**
+ * @brief		判断客户端是否要求json格式的应答
+ * @note		请求头 Accept 中含有 application/json 时返回json，否则返回xml(兼容旧客户端)
+ */
+func acceptJSON(req *http.Request) bool {
+	return strings.Contains(strings.ToLower(req.Header.Get("Accept")), "application/json")
+}
+
+/**
+ * @brief		按客户端要求的格式(xml/json)序列化一个对象
+ * @param[in]	objBody			待输出的对象(需同时支持xml和json的序列化)
+ * @return		应答体(xml格式时带xml头) + Content-Type + 错误
+ */
+func marshalObject(req *http.Request, objBody interface{}) ([]byte, string, error) {
+	if true == acceptJSON(req) {
+		bytesData, err := json.Marshal(objBody)
+		return bytesData, "application/json; charset=utf-8", err
+	}
+
+	bytesData, err := xml.Marshal(objBody)
+	if nil == err {
+		bytesData = append([]byte(xml.Header), bytesData...)
+	}
+
+	return bytesData, "text/xml; charset=utf-8", err
+}
+
+/**
+ * @brief		按客户端要求的格式(xml/json)输出一个对象
+ * @param[in]	nStatusCode		http状态码
+ * @param[in]	objBody			待输出的对象(需同时支持xml和json的序列化)
+ */
+func writeObject(resp http.ResponseWriter, req *http.Request, nStatusCode int, objBody interface{}) {
+	bytesData, sContentType, err := marshalObject(req, objBody)
+	resp.Header().Set("Content-Type", sContentType)
+	if nil != err {
+		log.Println("[ERR] writeObject() : cannot marshal response object :", err.Error())
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(nStatusCode)
+	resp.Write(bytesData)
+}
+
+/**
+ * @brief		输出一个接口的应答结果
+ * @param[in]	nStatusCode		http状态码
+ * @param[in]	sAction			接口名(xml根节点名)
+ * @param[in]	sStatus			success / failure
+ * @param[in]	sDesc			描述信息
+ */
+func writeResult(resp http.ResponseWriter, req *http.Request, nStatusCode int, sAction, sStatus, sDesc string) {
+	objResponse := ActionResponse{XMLName: xml.Name{Local: sAction}, Action: sAction}
+	objResponse.Result.Status = sStatus
+	objResponse.Result.Code = nStatusCode
+	objResponse.Result.Desc = sDesc
+
+	writeObject(resp, req, nStatusCode, &objResponse)
+}
+
+/**
+ * @brief		输出一个接口的失败应答
+ * @param[in]	nStatusCode		http状态码 (400/401/403/404/500 ...)
+ * @param[in]	sAction			接口名(xml根节点名)
+ * @param[in]	sDesc			失败描述信息
+ */
+func writeError(resp http.ResponseWriter, req *http.Request, nStatusCode int, sAction, sDesc string) {
+	log.Printf("[INF] [%s] ---> [FAILURE] (%d) %s", sAction, nStatusCode, sDesc)
+	writeResult(resp, req, nStatusCode, sAction, "failure", fmt.Sprintf("[WARNING] Oops! %s", sDesc))
+}
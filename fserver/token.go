@@ -0,0 +1,116 @@
+/**
+ * @brief		登录令牌(Token)
+ * @detail		HMAC-SHA256签名的无状态令牌: base64url(帐号|过期时间) + "." + base64url(签名)
+ *				服务器重启后，只要签名密钥不变，已发放的令牌依然有效
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nDefaultTokenLifetime time.Duration = time.Hour * 10 // 令牌默认有效期(与cookie session的有效期相同)
+)
+
+/**
+ * @brief		加载令牌签名密钥
+ * @detail		密钥文件不存在时，随机生成一个密钥并保存到该文件(以便服务重启后，已发放的令牌仍然有效)
+ * @param[in]	sKeyFile		密钥文件路径(内容为hex串)
+ * @return		密钥 (加载失败时返回nil)
+ */
+func LoadTokenSecret(sKeyFile string) []byte {
+	if bytesContent, err := ioutil.ReadFile(sKeyFile); nil == err {
+		bytesSecret, err := hex.DecodeString(strings.TrimSpace(string(bytesContent)))
+		if nil != err || len(bytesSecret) < 16 {
+			log.Println("[ERR] LoadTokenSecret() : invalid token secret file (hex string, 16 bytes at least) :", sKeyFile)
+			return nil
+		}
+
+		return bytesSecret
+	}
+
+	bytesSecret := make([]byte, 32)
+	if _, err := rand.Read(bytesSecret); nil != err {
+		log.Println("[ERR] LoadTokenSecret() : cannot generate token secret :", err.Error())
+		return nil
+	}
+
+	if err := ioutil.WriteFile(sKeyFile, []byte(hex.EncodeToString(bytesSecret)), 0600); nil != err {
+		log.Println("[WARN] LoadTokenSecret() : cannot save token secret, tokens will be invalid after restart :", sKeyFile, err.Error())
+	} else {
+		log.Println("[INF] LoadTokenSecret() : a new token secret has been generated :", sKeyFile)
+	}
+
+	return bytesSecret
+}
+
+/**
+ * @brief		计算令牌载荷的签名
+ */
+func signTokenPayload(bytesSecret []byte, sPayload string) string {
+	objMac := hmac.New(sha256.New, bytesSecret)
+	objMac.Write([]byte(sPayload))
+
+	return base64.RawURLEncoding.EncodeToString(objMac.Sum(nil))
+}
+
+/**
+ * @brief		签发令牌
+ * @param[in]	bytesSecret		签名密钥
+ * @param[in]	sAccount		帐号
+ * @param[in]	objExpire		过期时间
+ */
+func issueToken(bytesSecret []byte, sAccount string, objExpire time.Time) string {
+	sPayload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", sAccount, objExpire.Unix())))
+
+	return sPayload + "." + signTokenPayload(bytesSecret, sPayload)
+}
+
+/**
+ * @brief		校验令牌
+ * @param[in]	bytesSecret		签名密钥
+ * @param[in]	sToken			令牌串
+ * @return		帐号 + 是否有效(签名正确且未过期)
+ */
+func verifyToken(bytesSecret []byte, sToken string) (string, bool) {
+	lstParts := strings.Split(sToken, ".")
+	if len(bytesSecret) == 0 || len(lstParts) != 2 {
+		return "", false
+	}
+
+	if false == hmac.Equal([]byte(signTokenPayload(bytesSecret, lstParts[0])), []byte(lstParts[1])) {
+		return "", false
+	}
+
+	bytesPayload, err := base64.RawURLEncoding.DecodeString(lstParts[0])
+	if nil != err {
+		return "", false
+	}
+
+	// 帐号中可能含有'|'，以最后一个'|'分隔过期时间
+	sPayload := string(bytesPayload)
+	nSep := strings.LastIndex(sPayload, "|")
+	if nSep <= 0 {
+		return "", false
+	}
+
+	nExpire, err := strconv.ParseInt(sPayload[nSep+1:], 10, 64)
+	if nil != err || time.Now().Unix() >= nExpire {
+		return "", false
+	}
+
+	return sPayload[:nSep], true
+}
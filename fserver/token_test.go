@@ -0,0 +1,117 @@
+/**
+ * @brief		登录令牌的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		签发的令牌能校验通过; 载荷/签名被篡改、已过期、密钥不同 的令牌都校验失败
+ */
+func TestVerifyToken(t *testing.T) {
+	bytesSecret, objExpire := []byte("0123456789abcdef"), time.Now().Add(time.Hour)
+	sToken := issueToken(bytesSecret, "admin", objExpire)
+	lstParts := strings.Split(sToken, ".")
+
+	// 篡改载荷: 换成另一个帐号，保留原签名
+	sTamperedPayload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("root|%d", objExpire.Unix()))) + "." + lstParts[1]
+	// 篡改签名: 改动签名的第一个字符
+	sFirstChar := "A"
+	if "A" == lstParts[1][:1] {
+		sFirstChar = "B"
+	}
+	sTamperedSignature := lstParts[0] + "." + sFirstChar + lstParts[1][1:]
+
+	for _, objCase := range []struct {
+		sDesc       string
+		bytesSecret []byte
+		sToken      string
+		sAccount    string
+		bValid      bool
+	}{
+		{"round trip", bytesSecret, sToken, "admin", true},
+		{"account with '|'", bytesSecret, issueToken(bytesSecret, "ops|team", objExpire), "ops|team", true},
+		{"tampered payload", bytesSecret, sTamperedPayload, "", false},
+		{"tampered signature", bytesSecret, sTamperedSignature, "", false},
+		{"expired", bytesSecret, issueToken(bytesSecret, "admin", time.Now().Add(-time.Second)), "", false},
+		{"wrong secret", []byte("fedcba9876543210"), sToken, "", false},
+		{"empty secret", nil, sToken, "", false},
+		{"malformed", bytesSecret, lstParts[0], "", false},
+		{"extra part", bytesSecret, sToken + ".x", "", false},
+	} {
+		if sAccount, bValid := verifyToken(objCase.bytesSecret, objCase.sToken); objCase.bValid != bValid || objCase.sAccount != sAccount {
+			t.Errorf("%s : unexpected result, account=%s, valid=%v", objCase.sDesc, sAccount, bValid)
+		}
+	}
+}
+
+/**
+ * @brief		POST /login 只从请求体中读取帐号密码并返回令牌; url中的明文密码不被令牌登录接受
+ * @detail		GET /login 仍是旧的cookie session登录(不返回令牌)
+ */
+func TestTokenLogin(t *testing.T) {
+	objSvr := &FileSyncServer{Account: "admin", Password: "admin", TokenSecret: []byte("0123456789abcdef")}
+	fnLogin := func(sMethod, sUrl string, objBody url.Values) (int, ActionResult) {
+		var objResponse struct {
+			Result ActionResult `xml:"result"`
+		}
+
+		objReq := httptest.NewRequest(sMethod, sUrl, strings.NewReader(objBody.Encode()))
+		if "POST" == sMethod {
+			objReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		objResp := httptest.NewRecorder()
+		objSvr.handleLogin(objResp, objReq)
+		if err := xml.Unmarshal(objResp.Body.Bytes(), &objResponse); nil != err {
+			t.Fatalf("%s %s : invalid xml : %s", sMethod, sUrl, err.Error())
+		}
+
+		return objResp.Code, objResponse.Result
+	}
+
+	// 请求体中的帐号密码: 返回令牌，令牌可用于 /list
+	nCode, objResult := fnLogin("POST", "/login", url.Values{"account": {"admin"}, "password": {"admin"}})
+	if sAccount, bValid := verifyToken(objSvr.TokenSecret, objResult.Token); http.StatusOK != nCode || false == bValid || "admin" != sAccount || objResult.Expire <= time.Now().Unix() {
+		t.Fatalf("unexpected login result : %d, %+v", nCode, objResult)
+	}
+
+	objReq := httptest.NewRequest("GET", "/list", nil)
+	objReq.Header.Set("Authorization", "Bearer "+objResult.Token)
+	objResp := httptest.NewRecorder()
+	objSvr.handleList(objResp, objReq)
+	if http.StatusOK != objResp.Code {
+		t.Errorf("token is not accepted by /list : %d", objResp.Code)
+	}
+
+	// 错误的密码
+	if nCode, objResult = fnLogin("POST", "/login", url.Values{"account": {"admin"}, "password": {"guess"}}); http.StatusUnauthorized != nCode || "" != objResult.Token {
+		t.Errorf("wrong password : %d, %+v", nCode, objResult)
+	}
+
+	// url中的帐号密码被忽略(只有请求体中的有效)
+	if nCode, objResult = fnLogin("POST", "/login?account=admin&password=admin", nil); http.StatusUnauthorized != nCode || "" != objResult.Token {
+		t.Errorf("credentials in url query should be ignored : %d, %+v", nCode, objResult)
+	}
+
+	if nCode, objResult = fnLogin("POST", "/login?account=admin&password=guess", url.Values{"account": {"admin"}, "password": {"admin"}}); http.StatusOK != nCode || "" == objResult.Token {
+		t.Errorf("credentials in request body should be used : %d, %+v", nCode, objResult)
+	}
+
+	// GET: 旧的session登录，不返回令牌
+	if nCode, objResult = fnLogin("GET", "/login?account=admin&password=admin", nil); http.StatusOK != nCode || "" != objResult.Token {
+		t.Errorf("unexpected session login : %d, %+v", nCode, objResult)
+	}
+}
@@ -0,0 +1,286 @@
+/**
+ * @brief		交易时段日历
+ * @detail		由市场定义中的交易时段推算: 分钟k线的切分时间点(60分钟线/5分钟线等)、当天数据是否已经完整(可以加载今天的数据)、
+ 				实时资源的生成时间窗口; 取代原来写死的A股时间(103000/113000/140000/150000, 93000~153000 等)
+ * @note		交易日从第一个交易时段开始计算(期货夜盘 21:00 开始的交易时段，属于下一个交易日，见 TradingDayOf());
+ 				k线不跨越交易时段，每个交易时段的最后一根k线在时段结束时切断(如: 港股上午 09:30~12:00 的60分钟线为 10:30/11:30/12:00);
+ 				不支持按日期覆盖交易时段(半日市 / 节前无夜盘): 这些日子按正常的交易时段切分k线，没有数据的时段不会生成k线，
+ 				只是当天数据完整的时间(IsDayClosed())仍按正常的收盘时间计算
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultSessions         TradingSessions = TradingSessions{{Begin: 93000, End: 113000}, {Begin: 130000, End: 150000}} // 内置市场(沪深)默认的交易时段
+	nPreOpenMinutes         int             = 150                                                                        // 开盘前n分钟起，认为新的交易日已经开始(不再加载今天的历史数据)
+	nPostCloseMinutes       int             = 420                                                                        // 收盘后n分钟起，认为当天的数据已经完整(可以加载今天的历史数据)
+	nRealRebuildTailMinutes int             = 30                                                                         // 收盘后继续生成实时资源的分钟数
+)
+
+/**
+ * @class 		TradingSession
+ * @brief		某市场的一个交易时段
+ * @note 		结束时间小于开始时间时，表示跨越午夜的时段(如: 期货夜盘 21:00 ~ 01:00)
+ * @author		barry
+ */
+type TradingSession struct {
+	Begin int // 时段开始时间(HHMMSS)
+	End   int // 时段结束时间(HHMMSS)
+}
+
+/**
+ * @brief		解析交易时段串
+ * @param[in]	sSession		时段串 (HHMM~HHMM，如: 0930~1130 / 2100~0230)
+ */
+func (pSelf *TradingSession) Parse(sSession string) error {
+	lstTimeStr := strings.Split(strings.Replace(sSession, ":", "", -1), "~")
+	if len(lstTimeStr) != 2 {
+		return fmt.Errorf("invalid trading session (HHMM~HHMM) : %s", sSession)
+	}
+
+	var lstTime [2]int
+	for i, sTime := range lstTimeStr {
+		nTime, err := strconv.Atoi(strings.TrimSpace(sTime))
+		if nil != err || nTime < 0 || nTime/100 > 24 || nTime%100 >= 60 {
+			return fmt.Errorf("invalid trading session (HHMM~HHMM) : %s", sSession)
+		}
+
+		lstTime[i] = nTime * 100
+	}
+
+	if lstTime[0] == lstTime[1] {
+		return fmt.Errorf("empty trading session : %s", sSession)
+	}
+
+	pSelf.Begin, pSelf.End = lstTime[0], lstTime[1]
+
+	return nil
+}
+
+/**
+ * @brief		判断某时间是否在本交易时段内
+ * @param[in]	nTime			时间(HHMMSS)
+ */
+func (pSelf *TradingSession) Contains(nTime int) bool {
+	if pSelf.Begin <= pSelf.End {
+		return nTime >= pSelf.Begin && nTime <= pSelf.End
+	}
+
+	return nTime >= pSelf.Begin || nTime <= pSelf.End
+}
+
+/**
+ * @Class 		TradingSessions
+ * @brief		某市场一个交易日内的全部交易时段(按先后顺序)
+ * @author		barry
+ */
+type TradingSessions []TradingSession
+
+/**
+ * @brief		判断某时间是否在任一交易时段内
+ * @param[in]	nTime			时间(HHMMSS)
+ */
+func (pSelf TradingSessions) Contains(nTime int) bool {
+	for _, objSession := range pSelf {
+		if true == objSession.Contains(nTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+ * @brief		某时间距离交易日开始(第一个交易时段的开始时间)的分钟数 [0, 1440)
+ */
+func (pSelf TradingSessions) offsetOf(nTime int) int {
+	nMinutes := nTime/10000*60 + nTime/100%100
+	nOpenMinutes := pSelf[0].Begin/10000*60 + pSelf[0].Begin/100%100
+
+	return ((nMinutes-nOpenMinutes)%1440 + 1440) % 1440
+}
+
+/**
+ * @brief		交易日开始后的第n分钟，对应的时间(HHMMSS)
+ */
+func (pSelf TradingSessions) timeOf(nOffset int) int {
+	nMinutes := (pSelf[0].Begin/10000*60 + pSelf[0].Begin/100%100 + nOffset) % 1440
+
+	return nMinutes/60*10000 + nMinutes%60*100
+}
+
+/**
+ * @brief		收盘时间(最后一个交易时段的结束时间)距离交易日开始的分钟数
+ */
+func (pSelf TradingSessions) closeOffset() int {
+	return pSelf.offsetOf(pSelf[len(pSelf)-1].End)
+}
+
+/**
+ * @brief		交易日的开始时间(HHMMSS): 收盘 ~ 下一交易日开盘 的中点之后(与 BarCalendar.BarOf() 对休市时间的划分一致)
+ */
+func (pSelf TradingSessions) dayStartTime() int {
+	nCloseOffset := pSelf.closeOffset()
+
+	return pSelf.timeOf(nCloseOffset + (1440-nCloseOffset)/2 + 1)
+}
+
+/**
+ * @brief		某记录所属的交易日
+ * @detail		交易日从前一个自然日的晚上开始时(如: 期货夜盘 21:00 ~ 02:30)，交易日开始时间之后的记录属于下一个自然日的交易日，
+ 				跨越午夜后的记录属于当天的交易日; 算出的日期不是交易日时顺延(如: 周五夜盘 + 周六凌晨的记录，属于下周一的交易日)
+ * @param[in]	nDate			记录的日期(yyyymmdd)
+ * @param[in]	nTime			记录的时间(HHMMSS)
+ * @param[in]	refHolidays		休市日历(nil时只按周末判断交易日)
+ * @return		交易日(yyyymmdd); 交易日不跨越午夜的市场(如: A股)，即为记录的日期
+ */
+func (pSelf TradingSessions) TradingDayOf(nDate int, nTime int, refHolidays *HolidayCalendar) int {
+	if 0 == len(pSelf) {
+		return nDate
+	}
+
+	nDayStart := pSelf.dayStartTime()
+	if nDayStart <= pSelf[len(pSelf)-1].End { // 交易日在收盘后的当天午夜之后才开始(不跨越午夜)
+		return nDate
+	}
+
+	objDate := time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100, 12, 0, 0, 0, time.Local)
+	if nTime >= nDayStart {
+		objDate = objDate.AddDate(0, 0, 1)
+	}
+
+	return refHolidays.NextTradingDay(objDate)
+}
+
+/**
+ * @brief		判断当天的数据是否已经完整(收盘后一段时间 ~ 下一个交易日开盘前一段时间)
+ * @param[in]	nNowTime		当前时间(HHMMSS)
+ * @note		没有交易时段时，认为数据总是完整的
+ */
+func (pSelf TradingSessions) IsDayClosed(nNowTime int) bool {
+	if 0 == len(pSelf) {
+		return true
+	}
+
+	nOffset, nCloseOffset := pSelf.offsetOf(nNowTime), pSelf.closeOffset()
+	if nOffset <= nCloseOffset {
+		return false
+	}
+
+	nPostClose := Min(nPostCloseMinutes, (1440-nCloseOffset)/2)
+
+	return nOffset-nCloseOffset >= nPostClose && 1440-nOffset >= nPreOpenMinutes
+}
+
+/**
+ * @brief		判断是否在实时资源的生成时间窗口内(开盘 ~ 收盘后n分钟，包括午间休市)
+ * @param[in]	nNowTime		当前时间(HHMMSS)
+ */
+func (pSelf TradingSessions) InRealRebuildWindow(nNowTime int) bool {
+	if 0 == len(pSelf) {
+		return false
+	}
+
+	return pSelf.offsetOf(nNowTime) <= pSelf.closeOffset()+nRealRebuildTailMinutes
+}
+
+/**
+ * @Class 		BarCalendar
+ * @brief		按交易时段切分的某周期k线的时间表
+ * @author		barry
+ */
+type BarCalendar struct {
+	refSessions  TradingSessions // 交易时段
+	lstBarEnds   []int           // 各k线的结束时间距离交易日开始的分钟数(升序)
+	mapCloseBars map[int]bool    // 在交易时段结束时切断的k线(结束时间 = 时段结束时间，该时刻的记录也属于这根k线)
+}
+
+/**
+ * @brief		生成某周期k线的时间表
+ * @param[in]	nPeriodMinutes	k线周期(分钟)
+ */
+func (pSelf TradingSessions) NewBarCalendar(nPeriodMinutes int) BarCalendar {
+	objCalendar := BarCalendar{refSessions: pSelf, mapCloseBars: make(map[int]bool)}
+	if nPeriodMinutes <= 0 {
+		return objCalendar
+	}
+
+	for _, objSession := range pSelf {
+		nBegin, nEnd := pSelf.offsetOf(objSession.Begin), pSelf.offsetOf(objSession.End)
+		for nBarEnd := nBegin + nPeriodMinutes; nBarEnd < nEnd; nBarEnd += nPeriodMinutes {
+			objCalendar.lstBarEnds = append(objCalendar.lstBarEnds, nBarEnd)
+		}
+
+		objCalendar.lstBarEnds = append(objCalendar.lstBarEnds, nEnd)
+		objCalendar.mapCloseBars[nEnd] = true
+	}
+
+	return objCalendar
+}
+
+/**
+ * @brief		k线数量
+ */
+func (pSelf *BarCalendar) Count() int {
+	return len(pSelf.lstBarEnds)
+}
+
+/**
+ * @brief		第n根k线的结束时间(HHMMSS)
+ */
+func (pSelf *BarCalendar) EndOf(nIndex int) int {
+	return pSelf.refSessions.timeOf(pSelf.lstBarEnds[nIndex])
+}
+
+/**
+ * @brief		某时刻(1分钟线的时间)的记录所属的k线
+ * @param[in]	nTime			记录时间(HHMMSS)
+ * @return		k线序号 + k线结束时间(HHMMSS); 没有k线时返回 -1
+ * @note		休市期间的记录归入下一根k线; 收盘后~下一交易日开盘前的记录，前一半时间归入最后一根k线，后一半时间(如集合竞价)归入第一根k线
+ */
+func (pSelf *BarCalendar) BarOf(nTime int) (int, int) {
+	nCount := len(pSelf.lstBarEnds)
+	if 0 == nCount {
+		return -1, 0
+	}
+
+	nOffset, nCloseOffset := pSelf.refSessions.offsetOf(nTime), pSelf.lstBarEnds[nCount-1]
+	if nOffset > nCloseOffset {
+		if nOffset-nCloseOffset <= (1440-nCloseOffset)/2 {
+			nOffset = nCloseOffset
+		} else {
+			nOffset = 0
+		}
+	}
+
+	for i, nBarEnd := range pSelf.lstBarEnds {
+		if nBarEnd > nOffset || (nBarEnd == nOffset && true == pSelf.mapCloseBars[nBarEnd]) {
+			return i, pSelf.EndOf(i)
+		}
+	}
+
+	return nCount - 1, pSelf.EndOf(nCount - 1)
+}
+
+/**
+ * @brief		某记录所属k线的结束日期
+ * @detail		k线跨越午夜时(如: 夜盘 23:00 ~ 01:00 的120分钟线)，午夜前的记录取下一个自然日，同一根k线只有一个日期
+ * @param[in]	nDate			记录的日期(yyyymmdd)
+ * @param[in]	nTime			记录的时间(HHMMSS)
+ * @param[in]	nBarTime		所属k线的结束时间(HHMMSS，见 BarOf())
+ */
+func (pSelf *BarCalendar) EndDateOf(nDate int, nTime int, nBarTime int) int {
+	if nBarTime >= nTime || pSelf.refSessions.offsetOf(nBarTime) <= pSelf.refSessions.offsetOf(nTime) { // 收盘后归入最后一根k线的记录，不跨越午夜
+		return nDate
+	}
+
+	return dateOf(time.Date(nDate/10000, time.Month(nDate%10000/100), nDate%100+1, 12, 0, 0, 0, time.Local))
+}
@@ -0,0 +1,230 @@
+/**
+ * @brief		交易时段日历的测试
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * @brief		距离今天n天的日期串(yyyymmdd)
+ */
+func todayDateStr(nDays int) string {
+	return time.Now().AddDate(0, 0, nDays).Format("20060102")
+}
+
+/**
+ * @brief		日期(yyyymmdd)转为日期串
+ */
+func itoaDate(nDate int) string {
+	return strconv.Itoa(nDate)
+}
+
+/**
+ * @brief		解析配置中的交易时段串
+ */
+func parseTestSessions(t *testing.T, lstSessionStr ...string) TradingSessions {
+	var lstSessions TradingSessions
+	for _, sSession := range lstSessionStr {
+		var objSession TradingSession
+		if err := objSession.Parse(sSession); nil != err {
+			t.Fatal(err)
+		}
+
+		lstSessions = append(lstSessions, objSession)
+	}
+
+	return lstSessions
+}
+
+/**
+ * @brief		按交易时段切分k线: A股(与原来写死的60分钟线时间一致) / 港股午间休市 / 期货夜盘跨越午夜
+ */
+func TestBarCalendar(t *testing.T) {
+	for _, objCase := range []struct {
+		lstSessions TradingSessions
+		nPeriod     int
+		lstBarEnds  []int
+		mapBarOf    map[int]int
+	}{
+		{DefaultSessions, 60, []int{103000, 113000, 140000, 150000},
+			map[int]int{92500: 103000, 93000: 103000, 102900: 103000, 103000: 113000, 113000: 113000, 120000: 140000, 130000: 140000, 140000: 150000, 150000: 150000, 153000: 150000}},
+		{parseTestSessions(t, "0930~1200", "1300~1600"), 60, []int{103000, 113000, 120000, 140000, 150000, 160000},
+			map[int]int{113500: 120000, 120000: 120000, 123000: 140000}},
+		{parseTestSessions(t, "2100~0230", "0900~1130", "1330~1500"), 60, []int{220000, 230000, 0, 10000, 20000, 23000, 100000, 110000, 113000, 143000, 150000},
+			map[int]int{205900: 220000, 235900: 0, 10000: 20000, 23000: 23000, 90000: 100000, 145900: 150000}},
+		{DefaultSessions, 5, nil, map[int]int{93000: 93500, 93400: 93500, 93500: 94000, 112900: 113000, 113000: 113000, 145900: 150000}},
+	} {
+		objBars := objCase.lstSessions.NewBarCalendar(objCase.nPeriod)
+		if nil != objCase.lstBarEnds {
+			var lstBarEnds []int
+			for i := 0; i < objBars.Count(); i++ {
+				lstBarEnds = append(lstBarEnds, objBars.EndOf(i))
+			}
+
+			if false == reflect.DeepEqual(lstBarEnds, objCase.lstBarEnds) {
+				t.Errorf("bar ends of %v = %v, expect %v", objCase.lstSessions, lstBarEnds, objCase.lstBarEnds)
+			}
+		}
+
+		for nTime, nBarEnd := range objCase.mapBarOf {
+			if _, nEnd := objBars.BarOf(nTime); nEnd != nBarEnd {
+				t.Errorf("bar of %d in %v = %d, expect %d", nTime, objCase.lstSessions, nEnd, nBarEnd)
+			}
+		}
+	}
+}
+
+/**
+ * @brief		当天数据是否完整 + 实时资源的生成时间窗口
+ */
+func TestSessionWindows(t *testing.T) {
+	for nTime, bClosed := range map[int]bool{70000: true, 70100: false, 93000: false, 150000: false, 215900: false, 220000: true, 220: true} {
+		if DefaultSessions.IsDayClosed(nTime) != bClosed {
+			t.Errorf("IsDayClosed(%d) != %v", nTime, bClosed)
+		}
+	}
+
+	for nTime, bInWindow := range map[int]bool{92900: false, 93000: true, 120000: true, 153000: true, 153100: false} {
+		if DefaultSessions.InRealRebuildWindow(nTime) != bInWindow {
+			t.Errorf("InRealRebuildWindow(%d) != %v", nTime, bInWindow)
+		}
+	}
+
+	lstNightSessions := parseTestSessions(t, "2100~0230", "0900~1500")
+	if false == lstNightSessions.InRealRebuildWindow(233000) || true == lstNightSessions.InRealRebuildWindow(180000) {
+		t.Error("unexpected real rebuild window of night sessions")
+	}
+}
+
+/**
+ * @brief		5分钟线按交易时段切分，每次返回一天的数据(下一天的第一条记录不丢失)
+ */
+func TestMinutes5LoadFromFile(t *testing.T) {
+	objFormat, _ := LookupRecordFormat("sse.m5")
+	objRecordIO, _ := objFormat.createRecordIO("sse.m5", nil, &DataSourceConfig{MkID: "sse", Sessions: DefaultSessions})
+	sDate1, sDate2 := todayDateStr(-2), todayDateStr(-1)
+	bytesData := []byte(strings.Join([]string{
+		sDate1 + ",93000,10,11,9,10.5,0,100,10,0,1,0",
+		sDate1 + ",93100,10.5,12,8,11,0,100,10,0,1,0",
+		sDate1 + ",93500,11,11,11,11,0,100,10,0,1,0",
+		sDate2 + ",93000,20,20,20,20,0,100,10,0,1,0",
+	}, "\n") + "\n")
+
+	bytesBars, nDate, nOffset := objRecordIO.LoadFromFile(bytesData)
+	lstBars := strings.Split(strings.TrimSpace(string(bytesBars)), "\n")
+	if sDate1 != itoaDate(nDate) || 2 != len(lstBars) {
+		t.Fatalf("unexpected 5 minutes lines of day 1 : %d, %v", nDate, lstBars)
+	}
+
+	if false == strings.HasPrefix(lstBars[0], sDate1+",93500,10.000000,12.000000,8.000000,11.000000,") || false == strings.HasPrefix(lstBars[1], sDate1+",94000,11.") {
+		t.Errorf("unexpected 5 minutes lines of day 1 : %v", lstBars)
+	}
+
+	bytesBars, nDate, _ = objRecordIO.LoadFromFile(bytesData[nOffset:])
+	if sDate2 != itoaDate(nDate) || false == strings.HasPrefix(string(bytesBars), sDate2+",93500,20.") {
+		t.Errorf("unexpected 5 minutes lines of day 2 : %d, %s", nDate, bytesBars)
+	}
+}
+
+/**
+ * @brief		记录所属的交易日: 夜盘开始后的记录属于下一个交易日(周五夜盘 -> 下周一); 交易日不跨越午夜的市场为记录的日期
+ */
+func TestTradingDayOf(t *testing.T) {
+	lstNightSessions := parseTestSessions(t, "2100~0230", "0900~1015", "1030~1130", "1330~1500")
+	for _, objCase := range []struct {
+		lstSessions TradingSessions
+		nDate       int
+		nTime       int
+		nTradingDay int
+	}{
+		{DefaultSessions, 20180410, 93100, 20180410},
+		{DefaultSessions, 20180410, 235900, 20180410},
+		{DefaultSessions, 20180414, 93100, 20180414}, // 不跨越午夜的市场，不按交易日顺延
+		{lstNightSessions, 20180410, 90100, 20180410},
+		{lstNightSessions, 20180410, 150000, 20180410},
+		{lstNightSessions, 20180410, 180000, 20180410}, // 收盘后的前一半时间，归入当天
+		{lstNightSessions, 20180410, 205900, 20180411}, // 夜盘开盘前(集合竞价)
+		{lstNightSessions, 20180410, 210100, 20180411},
+		{lstNightSessions, 20180410, 235900, 20180411},
+		{lstNightSessions, 20180411, 1000, 20180411},
+		{lstNightSessions, 20180411, 23000, 20180411},
+		{lstNightSessions, 20180413, 210100, 20180416}, // 周五夜盘
+		{lstNightSessions, 20180414, 3000, 20180416},   // 周六凌晨
+	} {
+		if nTradingDay := objCase.lstSessions.TradingDayOf(objCase.nDate, objCase.nTime, nil); objCase.nTradingDay != nTradingDay {
+			t.Errorf("trading day of %d %d in %v = %d, expect %d", objCase.nDate, objCase.nTime, objCase.lstSessions, nTradingDay, objCase.nTradingDay)
+		}
+	}
+}
+
+/**
+ * @brief		夜盘的分钟线按交易日分组: 夜盘(含跨越午夜的部分)与下一个交易日的日盘合成在一起，跨越午夜的k线只有一根
+ * @detail		上期所交易时段 21:00~02:30 + 日盘，120分钟线: 23:00 / 01:00 / 02:30 / 10:15 / 11:30 / 15:00
+ */
+func TestNightSessionLoadFromFile(t *testing.T) {
+	objFormat, _ := LookupRecordFormat("shfe.m120")
+	objRecordIO, _ := objFormat.createRecordIO("shfe.m120", nil, &DataSourceConfig{MkID: "shfe", Sessions: parseTestSessions(t, "2100~0230", "0900~1015", "1030~1130", "1330~1500")})
+
+	// 至少一周前的 周四 ~ 下周一
+	objFriday := time.Now().AddDate(0, 0, -7)
+	for time.Friday != objFriday.Weekday() {
+		objFriday = objFriday.AddDate(0, 0, -1)
+	}
+
+	sThu, sFri, sSat, sMon := objFriday.AddDate(0, 0, -1).Format("20060102"), objFriday.Format("20060102"), objFriday.AddDate(0, 0, 1).Format("20060102"), objFriday.AddDate(0, 0, 3).Format("20060102")
+	bytesData := []byte(strings.Join([]string{
+		sThu + ",210100,10,11,9,10,0,100,100,0,1,0",
+		sThu + ",230100,10,12,9,11,0,100,100,0,1,0",
+		sThu + ",235900,11,13,10,12,0,100,100,0,1,0",
+		sFri + ",000100,12,12,8,9,0,100,100,0,1,0",
+		sFri + ",023000,9,9,9,9,0,100,100,0,1,0",
+		sFri + ",090100,9,9,9,9,0,100,100,0,1,0",
+		sFri + ",150000,9,9,9,9,0,100,100,0,1,0",
+		sFri + ",210100,20,20,20,20,0,100,100,0,1,0",
+		sSat + ",003000,20,20,20,20,0,100,100,0,1,0",
+		sMon + ",090100,20,20,20,20,0,100,100,0,1,0",
+	}, "\n") + "\n")
+
+	fnCheckBars := func(bytesBars []byte, lstExpected []string) {
+		lstBars := strings.Split(strings.TrimSpace(string(bytesBars)), "\n")
+		if len(lstExpected) != len(lstBars) {
+			t.Fatalf("unexpected bars : %v, expect %v", lstBars, lstExpected)
+		}
+
+		for i, sExpected := range lstExpected {
+			if false == strings.HasPrefix(lstBars[i], sExpected) {
+				t.Errorf("unexpected bar : %s, expect %s", lstBars[i], sExpected)
+			}
+		}
+	}
+
+	// 周五的交易日: 周四夜盘 + 周五凌晨 + 周五日盘; 23:00~01:00 的k线跨越午夜，只有一根(日期为结束时间的日期)
+	bytesBars, nDate, nOffset := objRecordIO.LoadFromFile(bytesData)
+	if sFri != itoaDate(nDate) {
+		t.Fatalf("unexpected trading day : %d, expect %s", nDate, sFri)
+	}
+
+	fnCheckBars(bytesBars, []string{
+		sThu + ",230000,10.000000,11.000000,9.000000,10.000000,0.000000,100.000000,100,",
+		sFri + ",10000,10.000000,13.000000,8.000000,9.000000,0.000000,300.000000,300,",
+		sFri + ",23000,",
+		sFri + ",101500,",
+		sFri + ",150000,",
+	})
+
+	// 周一的交易日: 周五夜盘 + 周六凌晨 + 周一日盘
+	bytesBars, nDate, _ = objRecordIO.LoadFromFile(bytesData[nOffset:])
+	if sMon != itoaDate(nDate) {
+		t.Fatalf("unexpected trading day : %d, expect %s", nDate, sMon)
+	}
+
+	fnCheckBars(bytesBars, []string{sFri + ",230000,20.", sSat + ",10000,20.", sMon + ",101500,20."})
+}
@@ -0,0 +1,203 @@
+/**
+ * @brief		用户帐号管理
+ * @detail		多帐号 + 加盐哈希密码 + 每个帐号可下载的资源类型(TYPE)白名单
+ * @author		barry
+ * @date		2018/4/10
+ */
+package fserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	nPasswordHashRounds int = 4096 // 密码哈希的迭代次数
+)
+
+/**
+ * @Interface	I_UserStore
+ * @brief		用户帐号存储接口(可替换为数据库等其它实现)
+ * @author		barry
+ */
+type I_UserStore interface {
+	/**
+	 * @brief	验证帐号和密码
+	 * @return	true	帐号密码正确
+	 */
+	Authenticate(sAccount, sPassword string) bool
+
+	/**
+	 * @brief	判断某帐号是否有权下载某资源类型(如: sse.d1 / hkse.shsz_detail)
+	 */
+	IsEntitled(sAccount, sResType string) bool
+}
+
+/**
+ * @brief		生成加盐的密码哈希串
+ * @param[in]	sPassword		明文密码
+ * @param[in]	sSalt			盐(为空时随机生成)
+ * @return		哈希串，格式: sha256$迭代次数$盐$哈希值
+ */
+func HashPassword(sPassword, sSalt string) string {
+	if "" == sSalt {
+		bytesSalt := make([]byte, 8)
+		rand.Read(bytesSalt)
+		sSalt = hex.EncodeToString(bytesSalt)
+	}
+
+	return fmt.Sprintf("sha256$%d$%s$%s", nPasswordHashRounds, sSalt, hashPasswordRounds(sPassword, sSalt, nPasswordHashRounds))
+}
+
+/**
+ * @brief		按迭代次数计算密码哈希值
+ */
+func hashPasswordRounds(sPassword, sSalt string, nRounds int) string {
+	bytesHash := sha256.Sum256([]byte(sSalt + ":" + sPassword))
+	for i := 1; i < nRounds; i++ {
+		bytesHash = sha256.Sum256(bytesHash[:])
+	}
+
+	return hex.EncodeToString(bytesHash[:])
+}
+
+/**
+ * @brief		校验明文密码与哈希串是否匹配
+ * @param[in]	sPassword		明文密码
+ * @param[in]	sHashString		HashPassword()生成的哈希串
+ */
+func VerifyPassword(sPassword, sHashString string) bool {
+	lstFields := strings.Split(sHashString, "$")
+	if len(lstFields) != 4 || "sha256" != lstFields[0] {
+		return false
+	}
+
+	nRounds, err := strconv.Atoi(lstFields[1])
+	if nil != err || nRounds <= 0 {
+		return false
+	}
+
+	sHash := hashPasswordRounds(sPassword, lstFields[2], nRounds)
+
+	return 1 == subtle.ConstantTimeCompare([]byte(sHash), []byte(lstFields[3]))
+}
+
+/**
+ * @brief		判断资源类型是否与白名单中的某一项匹配
+ * @param[in]	sPattern		白名单项，支持: * (全部) / sse.* (前缀) / hkse.shsz_detail (精确)
+ * @param[in]	sResType		资源类型
+ */
+func matchResType(sPattern, sResType string) bool {
+	sPattern = strings.ToLower(strings.TrimSpace(sPattern))
+	sResType = strings.ToLower(sResType)
+
+	if "*" == sPattern {
+		return true
+	}
+
+	if strings.HasSuffix(sPattern, "*") {
+		return strings.HasPrefix(sResType, sPattern[:len(sPattern)-1])
+	}
+
+	return sPattern == sResType
+}
+
+/**
+ * @Class 		UserAccount
+ * @brief		某一个用户帐号的描述
+ * @author		barry
+ */
+type UserAccount struct {
+	XMLName  xml.Name `xml:"user"`
+	Account  string   `xml:"account,attr"`  // 帐号
+	Password string   `xml:"password,attr"` // 密码哈希串(由HashPassword()生成)
+	Allow    []struct {
+		Type string `xml:"type,attr"` // 允许下载的资源类型 (* / sse.* / hkse.shsz_detail)
+	} `xml:"allow"`
+}
+
+/**
+ * @Class 		XmlUserStore
+ * @brief		从xml文件加载的用户帐号表
+ * @detail		文件格式:
+ 				<users>
+ 					<user account="guest" password="sha256$4096$salt$hash">
+ 						<allow type="sse.*"/>
+ 						<allow type="hkse.shsz_detail"/>
+ 					</user>
+ 				</users>
+ * @author		barry
+ */
+type XmlUserStore struct {
+	mapAccounts map[string]UserAccount // 帐号表
+}
+
+/**
+ * @brief		从xml文件加载用户帐号表
+ * @param[in]	sFilePath		xml文件路径
+ * @return		true			加载成功
+ */
+func (pSelf *XmlUserStore) LoadFromFile(sFilePath string) bool {
+	var objUsers struct {
+		XMLName xml.Name      `xml:"users"`
+		User    []UserAccount `xml:"user"`
+	}
+
+	sXmlContent, err := ioutil.ReadFile(sFilePath)
+	if err != nil {
+		log.Println("[WARN] XmlUserStore.LoadFromFile() : cannot load user store file :", sFilePath, err.Error())
+		return false
+	}
+
+	if err = xml.Unmarshal(sXmlContent, &objUsers); err != nil {
+		log.Println("[WARN] XmlUserStore.LoadFromFile() : cannot parse user store file :", sFilePath, err.Error())
+		return false
+	}
+
+	pSelf.mapAccounts = make(map[string]UserAccount)
+	for _, objUser := range objUsers.User {
+		pSelf.mapAccounts[objUser.Account] = objUser
+	}
+
+	log.Printf("[INF] XmlUserStore.LoadFromFile() : [OK] %d accounts loaded from %s", len(pSelf.mapAccounts), sFilePath)
+
+	return true
+}
+
+/**
+ * @brief		验证帐号和密码
+ */
+func (pSelf *XmlUserStore) Authenticate(sAccount, sPassword string) bool {
+	objUser, ok := pSelf.mapAccounts[sAccount]
+	if false == ok {
+		return false
+	}
+
+	return VerifyPassword(sPassword, objUser.Password)
+}
+
+/**
+ * @brief		判断某帐号是否有权下载某资源类型
+ */
+func (pSelf *XmlUserStore) IsEntitled(sAccount, sResType string) bool {
+	objUser, ok := pSelf.mapAccounts[sAccount]
+	if false == ok {
+		return false
+	}
+
+	for _, objAllow := range objUser.Allow {
+		if true == matchResType(objAllow.Type, sResType) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -12,6 +12,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var (
@@ -22,6 +25,13 @@ var (
 	sAccount  string // Login Name
 	sPassword string // Login Password
 	sXmlCfg   string // Xml Configuration Path
+	sUsersCfg string // Xml Users Store Path
+	sHashPswd string // Password 2 Hash (print hash string && exit)
+	sTokenKey string // Secret Key File 4 Signing Login Tokens
+	sSignKey  string // Ed25519 Key File 4 Signing Resource Manifest
+	sTLSCert  string // TLS Certificate File (PEM)
+	sTLSKey   string // TLS Private Key File (PEM)
+	sTLSCA    string // CA File (PEM) 4 Verifying Client Certificates
 )
 
 // Package Initialization
@@ -36,11 +46,24 @@ func init() {
 	flag.StringVar(&sXmlCfg, "cfg", "./cfg/configuration.xml", "configuration 4 files sync scheduler")
 	flag.StringVar(&sAccount, "account", "", "login user name (default: '' ")
 	flag.StringVar(&sPassword, "password", "", "login password () default : '' ")
+	flag.StringVar(&sUsersCfg, "users", "./cfg/users.xml", "multi-account user store, loaded if exists (default:./cfg/users.xml)")
+	flag.StringVar(&sTokenKey, "tokenkey", "./cfg/token.key", "secret key file 4 signing login tokens, generated if not exists (default:./cfg/token.key)")
+	flag.StringVar(&sSignKey, "manifestkey", "./cfg/manifest.key", "ed25519 key file 4 signing resource list, generated if not exists (public key in <file>.pub), '' means unsigned (default:./cfg/manifest.key)")
+	flag.StringVar(&sTLSCert, "tls-cert", "", "certificate file (PEM) 4 https, enable https with -tls-key (default: '')")
+	flag.StringVar(&sTLSKey, "tls-key", "", "private key file (PEM) 4 https (default: '')")
+	flag.StringVar(&sTLSCA, "tls-client-ca", "", "CA file (PEM) 4 verifying client certificates, enable mutual tls (default: '')")
+	flag.StringVar(&sHashPswd, "hashpassword", "", "print the salted hash of a password 4 users store && exit")
 	flag.Parse()
 }
 
 // Program Entry Function
 func main() {
+	/////////////// 生成密码哈希串(用于填写users.xml)
+	if "" != sHashPswd {
+		fmt.Println(fserver.HashPassword(sHashPswd, ""))
+		return
+	}
+
 	/////////////// 设置日志输出方式
 	if true == bDumpLog {
 		oLogFile, oLogErr := os.OpenFile(sLogFile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
@@ -56,15 +79,62 @@ func main() {
 	log.Println("[INF] [Begin] ##################################")
 
 	objFileScheduler := &fserver.FileScheduler{XmlCfgPath: sXmlCfg}
-	objSyncSvr := &fserver.FileSyncServer{ServerHost: fmt.Sprintf("%s:%d", sIP, nPort), Account: sAccount, Password: sPassword}
+	objSyncSvr := &fserver.FileSyncServer{ServerHost: fmt.Sprintf("%s:%d", sIP, nPort), Account: sAccount, Password: sPassword, TLSCertFile: sTLSCert, TLSKeyFile: sTLSKey, TLSClientCAFile: sTLSCA}
+
+	if objSyncSvr.TokenSecret = fserver.LoadTokenSecret(sTokenKey); nil == objSyncSvr.TokenSecret {
+		log.Fatal("[ERR] main() : a fatal error occur while loading token secret ! ", sTokenKey)
+	}
+
+	if "" != sSignKey {
+		if objSyncSvr.ManifestSigningKey = fserver.LoadManifestSigningKey(sSignKey); nil == objSyncSvr.ManifestSigningKey {
+			log.Fatal("[ERR] main() : a fatal error occur while loading manifest signing key ! ", sSignKey)
+		}
+	}
+
+	if _, err := os.Stat(sUsersCfg); nil == err {
+		objUserStore := &fserver.XmlUserStore{}
+		if objUserStore.LoadFromFile(sUsersCfg) == false {
+			log.Fatal("[ERR] main() : a fatal error occur while loading users store ! ", sUsersCfg)
+		}
+
+		objSyncSvr.UserStore = objUserStore
+	}
 
 	objFileScheduler.RefSyncSvr = objSyncSvr
 	if objFileScheduler.Active() == false {
 		log.Fatal("[ERR] main() : a fatal error occur while initialize file scheduler engine ! ")
 	} else {
 		objSyncSvr.SyncFolder = objFileScheduler.SyncFolder
+		go handleSignals(objFileScheduler, objSyncSvr)
 		objSyncSvr.RunServer()
+		objFileScheduler.Stop(time.Minute * 10) // 等待进行中的资源压缩完成或中止
 	}
 
 	log.Println("[INF] [ End ] ##################################")
 }
+
+/**
+ * @brief		系统信号处理
+ * @detail		SIGHUP: 重新加载配置文件(不影响客户端连接)
+ *				SIGTERM/SIGINT: 通知停止资源生成(进行中的压缩完成或中止) + 等待进行中的下载完成后退出
+ */
+func handleSignals(objFileScheduler *fserver.FileScheduler, objSyncSvr *fserver.FileSyncServer) {
+	objSignalChan := make(chan os.Signal, 1)
+	signal.Notify(objSignalChan, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+
+	for objSignal := range objSignalChan {
+		if syscall.SIGHUP == objSignal {
+			log.Println("[INF] handleSignals() : SIGHUP received, reloading configuration .........")
+			if false == objFileScheduler.Reload() {
+				log.Println("[WARN] handleSignals() : cannot reload configuration, keep the old one.")
+			}
+			continue
+		}
+
+		log.Println("[INF] handleSignals() : signal received, shutting down .........", objSignal)
+		signal.Stop(objSignalChan)
+		go objFileScheduler.Stop(time.Minute * 10)
+		objSyncSvr.Shutdown(time.Minute * 6)
+		return
+	}
+}